@@ -14,6 +14,40 @@ import (
 	"github.com/goadesign/goa"
 )
 
+// OAuth2 token introspection response, see https://tools.ietf.org/html/rfc7662#section-2.2 (default view)
+//
+// Identifier: application/vnd.goa.example.oauth2.introspection+json; view=default
+type IntrospectionMedia struct {
+	// Whether the token is currently active
+	Active bool `form:"active" json:"active" xml:"active"`
+	// The audience of the token
+	Aud []string `form:"aud,omitempty" json:"aud,omitempty" xml:"aud,omitempty"`
+	// The authorization details granted to the token, see https://tools.ietf.org/html/rfc9396#section-9.2
+	AuthorizationDetails []map[string]interface{} `form:"authorization_details,omitempty" json:"authorization_details,omitempty" xml:"authorization_details,omitempty"`
+	// The identifier of the client the token was issued to
+	ClientID *string `form:"client_id,omitempty" json:"client_id,omitempty" xml:"client_id,omitempty"`
+	// The confirmation of the key the token is bound to, see https://tools.ietf.org/html/rfc9449#section-6.2
+	Cnf map[string]string `form:"cnf,omitempty" json:"cnf,omitempty" xml:"cnf,omitempty"`
+	// The expiration time of the token in seconds since the epoch
+	Exp *int `form:"exp,omitempty" json:"exp,omitempty" xml:"exp,omitempty"`
+	// The time the token was issued in seconds since the epoch
+	Iat *int `form:"iat,omitempty" json:"iat,omitempty" xml:"iat,omitempty"`
+	// The issuer identifier of the authorization server
+	Iss *string `form:"iss,omitempty" json:"iss,omitempty" xml:"iss,omitempty"`
+	// The scope of the token
+	Scope *string `form:"scope,omitempty" json:"scope,omitempty" xml:"scope,omitempty"`
+	// The identifier of the resource owner
+	Sub *string `form:"sub,omitempty" json:"sub,omitempty" xml:"sub,omitempty"`
+	// The type of the token, e.g. "Bearer"
+	TokenType *string `form:"token_type,omitempty" json:"token_type,omitempty" xml:"token_type,omitempty"`
+}
+
+// Validate validates the IntrospectionMedia media type instance.
+func (mt *IntrospectionMedia) Validate() (err error) {
+
+	return
+}
+
 // OAuth2 error response, see https://tools.ietf.org/html/rfc6749#section-5.2 (default view)
 //
 // Identifier: application/vnd.goa.example.oauth2.error+json; view=default
@@ -31,8 +65,26 @@ func (mt *OAuth2ErrorMedia) Validate() (err error) {
 	if mt.Error == "" {
 		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "error"))
 	}
-	if !(mt.Error == "invalid_request" || mt.Error == "invalid_client" || mt.Error == "invalid_grant" || mt.Error == "unauthorized_client" || mt.Error == "unsupported_grant_type") {
-		err = goa.MergeErrors(err, goa.InvalidEnumValueError(`response.error`, mt.Error, []interface{}{"invalid_request", "invalid_client", "invalid_grant", "unauthorized_client", "unsupported_grant_type"}))
+	if !(mt.Error == "invalid_request" || mt.Error == "invalid_client" || mt.Error == "invalid_grant" || mt.Error == "unauthorized_client" || mt.Error == "unsupported_grant_type" || mt.Error == "invalid_scope" || mt.Error == "invalid_target" || mt.Error == "access_denied" || mt.Error == "unsupported_response_type" || mt.Error == "invalid_request_uri" || mt.Error == "invalid_request_object" || mt.Error == "request_not_supported" || mt.Error == "request_uri_not_supported" || mt.Error == "invalid_authorization_details" || mt.Error == "invalid_dpop_proof" || mt.Error == "use_dpop_nonce" || mt.Error == "login_required" || mt.Error == "consent_required" || mt.Error == "interaction_required") {
+		err = goa.MergeErrors(err, goa.InvalidEnumValueError(`response.error`, mt.Error, []interface{}{"invalid_request", "invalid_client", "invalid_grant", "unauthorized_client", "unsupported_grant_type", "invalid_scope", "invalid_target", "access_denied", "unsupported_response_type", "invalid_request_uri", "invalid_request_object", "request_not_supported", "request_uri_not_supported", "invalid_authorization_details", "invalid_dpop_proof", "use_dpop_nonce", "login_required", "consent_required", "interaction_required"}))
+	}
+	return
+}
+
+// OAuth2 pushed authorization request successful response, see https://tools.ietf.org/html/rfc9126#section-2.2 (default view)
+//
+// Identifier: application/vnd.goa.example.oauth2.par+json; view=default
+type PushedAuthorizationMedia struct {
+	// The lifetime in seconds of the request URI
+	ExpiresIn int `form:"expires_in" json:"expires_in" xml:"expires_in"`
+	// The request URI to use in the authorization request
+	RequestURI string `form:"request_uri" json:"request_uri" xml:"request_uri"`
+}
+
+// Validate validates the PushedAuthorizationMedia media type instance.
+func (mt *PushedAuthorizationMedia) Validate() (err error) {
+	if mt.RequestURI == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "request_uri"))
 	}
 	return
 }
@@ -43,8 +95,14 @@ func (mt *OAuth2ErrorMedia) Validate() (err error) {
 type TokenMedia struct {
 	// The access token issued by the authorization server
 	AccessToken string `form:"access_token" json:"access_token" xml:"access_token"`
+	// The authorization details granted to the access token, see https://tools.ietf.org/html/rfc9396#section-7
+	AuthorizationDetails []map[string]interface{} `form:"authorization_details,omitempty" json:"authorization_details,omitempty" xml:"authorization_details,omitempty"`
 	// The lifetime in seconds of the access token
 	ExpiresIn *int `form:"expires_in,omitempty" json:"expires_in,omitempty" xml:"expires_in,omitempty"`
+	// The ID token issued for OpenID Connect requests, see https://openid.net/specs/openid-connect-core-1_0.html#TokenResponse
+	IDToken *string `form:"id_token,omitempty" json:"id_token,omitempty" xml:"id_token,omitempty"`
+	// The identifier of the type of the token issued in response to a token exchange request
+	IssuedTokenType *string `form:"issued_token_type,omitempty" json:"issued_token_type,omitempty" xml:"issued_token_type,omitempty"`
 	// The refresh token
 	RefreshToken *string `form:"refresh_token,omitempty" json:"refresh_token,omitempty" xml:"refresh_token,omitempty"`
 	// The scope of the access token
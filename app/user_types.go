@@ -14,20 +14,39 @@ import (
 	"github.com/goadesign/goa"
 )
 
-// Payload sent by client to obtain refresh and access token or to refresh an access token.
-// see https://tools.ietf.org/html/rfc6749#section-4.1.3 and https://tools.ietf.org/html/rfc6749#section-6
+// Payload sent by client to obtain refresh and access token, to refresh an access token or to exchange a token.
+// see https://tools.ietf.org/html/rfc6749#section-4.1.3, https://tools.ietf.org/html/rfc6749#section-6 and https://tools.ietf.org/html/rfc8693#section-2.1
 type tokenPayload struct {
+	// The security token that represents the identity of the acting party, used for token exchange
+	ActorToken *string `form:"actor_token,omitempty" json:"actor_token,omitempty" xml:"actor_token,omitempty"`
+	// The identifier of the type of the actor token, required when actor_token is present, used for token exchange
+	ActorTokenType *string `form:"actor_token_type,omitempty" json:"actor_token_type,omitempty" xml:"actor_token_type,omitempty"`
+	// The logical names of the target services where the client intends to use the requested token, used for token exchange
+	Audience []string `form:"audience,omitempty" json:"audience,omitempty" xml:"audience,omitempty"`
+	// JSON array of the authorization details requested for the access token, see https://tools.ietf.org/html/rfc9396#section-6
+	AuthorizationDetails *string `form:"authorization_details,omitempty" json:"authorization_details,omitempty" xml:"authorization_details,omitempty"`
 	// The authorization code received from the authorization server, used for initial refresh and access token request
 	Code *string `form:"code,omitempty" json:"code,omitempty" xml:"code,omitempty"`
+	// The PKCE code verifier matching the code challenge sent in the authorize request, used for initial refresh and access token request
+	CodeVerifier *string `form:"code_verifier,omitempty" json:"code_verifier,omitempty" xml:"code_verifier,omitempty"`
 	// Value MUST be set to "authorization_code" when obtaining initial refresh and access token.
 	// Value MUST be set to "refresh_token" when refreshing an access token.
+	// Value MUST be set to "urn:ietf:params:oauth:grant-type:token-exchange" when exchanging a token.
 	GrantType *string `form:"grant_type,omitempty" json:"grant_type,omitempty" xml:"grant_type,omitempty"`
 	// The redirect_uri parameter specified when making the authorize request to obtain the authorization code, used for initial refresh and access token request
 	RedirectURI *string `form:"redirect_uri,omitempty" json:"redirect_uri,omitempty" xml:"redirect_uri,omitempty"`
 	// The refresh token issued to the client, used for refreshing an access token
 	RefreshToken *string `form:"refresh_token,omitempty" json:"refresh_token,omitempty" xml:"refresh_token,omitempty"`
-	// The scope of the access request, used for refreshing an access token
+	// The identifier of the type of the requested security token, used for token exchange
+	RequestedTokenType *string `form:"requested_token_type,omitempty" json:"requested_token_type,omitempty" xml:"requested_token_type,omitempty"`
+	// The URIs of the target services or resources where the client intends to use the requested token, see https://tools.ietf.org/html/rfc8707#section-2.2 and https://tools.ietf.org/html/rfc8693#section-2.1
+	Resource []string `form:"resource,omitempty" json:"resource,omitempty" xml:"resource,omitempty"`
+	// The scope of the access request, used for refreshing or exchanging an access token
 	Scope *string `form:"scope,omitempty" json:"scope,omitempty" xml:"scope,omitempty"`
+	// The security token that represents the identity of the party on behalf of whom the request is being made, used for token exchange
+	SubjectToken *string `form:"subject_token,omitempty" json:"subject_token,omitempty" xml:"subject_token,omitempty"`
+	// The identifier of the type of the subject token, used for token exchange
+	SubjectTokenType *string `form:"subject_token_type,omitempty" json:"subject_token_type,omitempty" xml:"subject_token_type,omitempty"`
 }
 
 // Validate validates the tokenPayload type instance.
@@ -36,8 +55,8 @@ func (ut *tokenPayload) Validate() (err error) {
 		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "grant_type"))
 	}
 	if ut.GrantType != nil {
-		if !(*ut.GrantType == "authorization_code" || *ut.GrantType == "refresh_token") {
-			err = goa.MergeErrors(err, goa.InvalidEnumValueError(`response.grant_type`, *ut.GrantType, []interface{}{"authorization_code", "refresh_token"}))
+		if !(*ut.GrantType == "authorization_code" || *ut.GrantType == "refresh_token" || *ut.GrantType == "urn:ietf:params:oauth:grant-type:token-exchange") {
+			err = goa.MergeErrors(err, goa.InvalidEnumValueError(`response.grant_type`, *ut.GrantType, []interface{}{"authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:token-exchange"}))
 		}
 	}
 	return
@@ -46,9 +65,24 @@ func (ut *tokenPayload) Validate() (err error) {
 // Publicize creates TokenPayload from tokenPayload
 func (ut *tokenPayload) Publicize() *TokenPayload {
 	var pub TokenPayload
+	if ut.ActorToken != nil {
+		pub.ActorToken = ut.ActorToken
+	}
+	if ut.ActorTokenType != nil {
+		pub.ActorTokenType = ut.ActorTokenType
+	}
+	if ut.Audience != nil {
+		pub.Audience = ut.Audience
+	}
+	if ut.AuthorizationDetails != nil {
+		pub.AuthorizationDetails = ut.AuthorizationDetails
+	}
 	if ut.Code != nil {
 		pub.Code = ut.Code
 	}
+	if ut.CodeVerifier != nil {
+		pub.CodeVerifier = ut.CodeVerifier
+	}
 	if ut.GrantType != nil {
 		pub.GrantType = *ut.GrantType
 	}
@@ -58,26 +92,57 @@ func (ut *tokenPayload) Publicize() *TokenPayload {
 	if ut.RefreshToken != nil {
 		pub.RefreshToken = ut.RefreshToken
 	}
+	if ut.RequestedTokenType != nil {
+		pub.RequestedTokenType = ut.RequestedTokenType
+	}
+	if ut.Resource != nil {
+		pub.Resource = ut.Resource
+	}
 	if ut.Scope != nil {
 		pub.Scope = ut.Scope
 	}
+	if ut.SubjectToken != nil {
+		pub.SubjectToken = ut.SubjectToken
+	}
+	if ut.SubjectTokenType != nil {
+		pub.SubjectTokenType = ut.SubjectTokenType
+	}
 	return &pub
 }
 
-// Payload sent by client to obtain refresh and access token or to refresh an access token.
-// see https://tools.ietf.org/html/rfc6749#section-4.1.3 and https://tools.ietf.org/html/rfc6749#section-6
+// Payload sent by client to obtain refresh and access token, to refresh an access token or to exchange a token.
+// see https://tools.ietf.org/html/rfc6749#section-4.1.3, https://tools.ietf.org/html/rfc6749#section-6 and https://tools.ietf.org/html/rfc8693#section-2.1
 type TokenPayload struct {
+	// The security token that represents the identity of the acting party, used for token exchange
+	ActorToken *string `form:"actor_token,omitempty" json:"actor_token,omitempty" xml:"actor_token,omitempty"`
+	// The identifier of the type of the actor token, required when actor_token is present, used for token exchange
+	ActorTokenType *string `form:"actor_token_type,omitempty" json:"actor_token_type,omitempty" xml:"actor_token_type,omitempty"`
+	// The logical names of the target services where the client intends to use the requested token, used for token exchange
+	Audience []string `form:"audience,omitempty" json:"audience,omitempty" xml:"audience,omitempty"`
+	// JSON array of the authorization details requested for the access token, see https://tools.ietf.org/html/rfc9396#section-6
+	AuthorizationDetails *string `form:"authorization_details,omitempty" json:"authorization_details,omitempty" xml:"authorization_details,omitempty"`
 	// The authorization code received from the authorization server, used for initial refresh and access token request
 	Code *string `form:"code,omitempty" json:"code,omitempty" xml:"code,omitempty"`
+	// The PKCE code verifier matching the code challenge sent in the authorize request, used for initial refresh and access token request
+	CodeVerifier *string `form:"code_verifier,omitempty" json:"code_verifier,omitempty" xml:"code_verifier,omitempty"`
 	// Value MUST be set to "authorization_code" when obtaining initial refresh and access token.
 	// Value MUST be set to "refresh_token" when refreshing an access token.
+	// Value MUST be set to "urn:ietf:params:oauth:grant-type:token-exchange" when exchanging a token.
 	GrantType string `form:"grant_type" json:"grant_type" xml:"grant_type"`
 	// The redirect_uri parameter specified when making the authorize request to obtain the authorization code, used for initial refresh and access token request
 	RedirectURI *string `form:"redirect_uri,omitempty" json:"redirect_uri,omitempty" xml:"redirect_uri,omitempty"`
 	// The refresh token issued to the client, used for refreshing an access token
 	RefreshToken *string `form:"refresh_token,omitempty" json:"refresh_token,omitempty" xml:"refresh_token,omitempty"`
-	// The scope of the access request, used for refreshing an access token
+	// The identifier of the type of the requested security token, used for token exchange
+	RequestedTokenType *string `form:"requested_token_type,omitempty" json:"requested_token_type,omitempty" xml:"requested_token_type,omitempty"`
+	// The URIs of the target services or resources where the client intends to use the requested token, see https://tools.ietf.org/html/rfc8707#section-2.2 and https://tools.ietf.org/html/rfc8693#section-2.1
+	Resource []string `form:"resource,omitempty" json:"resource,omitempty" xml:"resource,omitempty"`
+	// The scope of the access request, used for refreshing or exchanging an access token
 	Scope *string `form:"scope,omitempty" json:"scope,omitempty" xml:"scope,omitempty"`
+	// The security token that represents the identity of the party on behalf of whom the request is being made, used for token exchange
+	SubjectToken *string `form:"subject_token,omitempty" json:"subject_token,omitempty" xml:"subject_token,omitempty"`
+	// The identifier of the type of the subject token, used for token exchange
+	SubjectTokenType *string `form:"subject_token_type,omitempty" json:"subject_token_type,omitempty" xml:"subject_token_type,omitempty"`
 }
 
 // Validate validates the TokenPayload type instance.
@@ -85,8 +150,8 @@ func (ut *TokenPayload) Validate() (err error) {
 	if ut.GrantType == "" {
 		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "grant_type"))
 	}
-	if !(ut.GrantType == "authorization_code" || ut.GrantType == "refresh_token") {
-		err = goa.MergeErrors(err, goa.InvalidEnumValueError(`response.grant_type`, ut.GrantType, []interface{}{"authorization_code", "refresh_token"}))
+	if !(ut.GrantType == "authorization_code" || ut.GrantType == "refresh_token" || ut.GrantType == "urn:ietf:params:oauth:grant-type:token-exchange") {
+		err = goa.MergeErrors(err, goa.InvalidEnumValueError(`response.grant_type`, ut.GrantType, []interface{}{"authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:token-exchange"}))
 	}
 	return
 }
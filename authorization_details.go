@@ -0,0 +1,249 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/goadesign/goa"
+)
+
+// Kinds of the JSON values of authorization details fields, see AuthorizationDetailType.
+const (
+	DetailFieldString  = "string"
+	DetailFieldNumber  = "number"
+	DetailFieldBoolean = "boolean"
+	DetailFieldObject  = "object"
+	DetailFieldArray   = "array"
+)
+
+// commonDetailFields lists the authorization details fields defined for all types by
+// https://tools.ietf.org/html/rfc9396#section-2.2 and the kind of their values.
+var commonDetailFields = map[string]string{
+	"type":       DetailFieldString,
+	"locations":  DetailFieldArray,
+	"actions":    DetailFieldArray,
+	"datatypes":  DetailFieldArray,
+	"identifier": DetailFieldString,
+	"privileges": DetailFieldArray,
+}
+
+type (
+	// AuthorizationDetail is an entry of the "authorization_details" parameter of rich
+	// authorization requests as described in https://tools.ietf.org/html/rfc9396#section-2.
+	// It maps the field names to their decoded JSON values.
+	AuthorizationDetail map[string]interface{}
+
+	// AuthorizationDetailsGranter is the interface optionally implemented by providers that
+	// can report the authorization details of the grants they issue. When the provider
+	// implements it the controller includes the authorization details granted to the access
+	// tokens in the token responses.
+	AuthorizationDetailsGranter interface {
+		// AccessTokenAuthorizationDetails returns the authorization details granted to
+		// the given access token if any. Upon failure the error should implement Error
+		// otherwise a generic error HTTP response is sent back to the client.
+		AccessTokenAuthorizationDetails(ctx context.Context, accessToken string) ([]AuthorizationDetail, error)
+	}
+
+	// AuthorizationDetailTypes records the authorization details types accepted by the
+	// authorization server together with the schema of their type specific fields.
+	AuthorizationDetailTypes struct {
+		lock  sync.RWMutex
+		types map[string]*AuthorizationDetailType
+	}
+
+	// AuthorizationDetailType describes a registered authorization details type.
+	AuthorizationDetailType struct {
+		// Type is the value of the "type" field of the authorization details.
+		Type string
+		// Description is a human readable description of the type.
+		Description string
+		// Fields lists the type specific fields and the kind of their values, one of
+		// DetailFieldString, DetailFieldNumber, DetailFieldBoolean, DetailFieldObject or
+		// DetailFieldArray. The common fields defined by RFC 9396 ("locations",
+		// "actions", "datatypes", "identifier" and "privileges") are always allowed.
+		Fields map[string]string
+		// Required lists the fields that must be present.
+		Required []string
+		// Validate is an optional function that performs additional validations once the
+		// fields have been checked against the schema. It should return an error that
+		// implements Error.
+		Validate func(AuthorizationDetail) error
+	}
+)
+
+// Type returns the value of the "type" field of the authorization details.
+func (d AuthorizationDetail) Type() string {
+	t, _ := d["type"].(string)
+	return t
+}
+
+// NewAuthorizationDetailTypes creates an empty authorization details type registry.
+func NewAuthorizationDetailTypes() *AuthorizationDetailTypes {
+	return &AuthorizationDetailTypes{types: make(map[string]*AuthorizationDetailType)}
+}
+
+// WithAuthorizationDetailTypes enables rich authorization requests as described in
+// https://tools.ietf.org/html/rfc9396. The "authorization_details" parameter of authorization,
+// pushed authorization and token requests is validated against the types registered in the
+// given registry and passed to the provider in AuthorizationRequest.AuthorizationDetails,
+// CodeGrant.AuthorizationDetails and ExchangeRequest.AuthorizationDetails. Requests with
+// authorization details are rejected if no registry is configured.
+func WithAuthorizationDetailTypes(r *AuthorizationDetailTypes) ProviderOption {
+	return func(c *ProviderController) {
+		c.detailTypes = r
+	}
+}
+
+// Register registers the given authorization details type. Registering a type that already
+// exists overrides its definition.
+func (r *AuthorizationDetailTypes) Register(t *AuthorizationDetailType) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.types[t.Type] = t
+}
+
+// Type returns the definition of the authorization details type with the given name, nil if
+// there is none.
+func (r *AuthorizationDetailTypes) Type(name string) *AuthorizationDetailType {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.types[name]
+}
+
+// Names returns the sorted names of all the registered types.
+func (r *AuthorizationDetailTypes) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	names := make([]string, 0, len(r.types))
+	for n := range r.types {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parse parses the JSON array of an "authorization_details" parameter and validates each entry
+// against the schema of its type. It returns an "invalid_authorization_details" error if the
+// value is malformed, if an entry has an unknown type or if it does not match the schema.
+func (r *AuthorizationDetailTypes) Parse(value string) ([]AuthorizationDetail, error) {
+	var details []AuthorizationDetail
+	if err := json.Unmarshal([]byte(value), &details); err != nil {
+		return nil, NewError(ErrInvalidAuthorizationDetails, "malformed authorization details", "")
+	}
+	if len(details) == 0 {
+		return nil, NewError(ErrInvalidAuthorizationDetails, "authorization details must not be empty", "")
+	}
+	for _, d := range details {
+		if err := r.validate(d); err != nil {
+			return nil, err
+		}
+	}
+	return details, nil
+}
+
+// validate validates the given authorization details against the schema of its type.
+func (r *AuthorizationDetailTypes) validate(d AuthorizationDetail) error {
+	if d == nil {
+		return NewError(ErrInvalidAuthorizationDetails, "authorization details must be objects", "")
+	}
+	t := r.Type(d.Type())
+	if t == nil {
+		return NewError(ErrInvalidAuthorizationDetails, fmt.Sprintf("unknown authorization details type %q", d.Type()), "")
+	}
+	for name, v := range d {
+		kind, common := commonDetailFields[name]
+		if !common {
+			var ok bool
+			if kind, ok = t.Fields[name]; !ok {
+				return NewError(ErrInvalidAuthorizationDetails, fmt.Sprintf("unknown field %q in %q authorization details", name, t.Type), "")
+			}
+		}
+		if !detailFieldKind(v, kind, common) {
+			return NewError(ErrInvalidAuthorizationDetails, fmt.Sprintf("field %q of %q authorization details must be a JSON %s", name, t.Type, kind), "")
+		}
+	}
+	for _, name := range t.Required {
+		if _, ok := d[name]; !ok {
+			return NewError(ErrInvalidAuthorizationDetails, fmt.Sprintf("missing field %q in %q authorization details", name, t.Type), "")
+		}
+	}
+	if t.Validate != nil {
+		return t.Validate(d)
+	}
+	return nil
+}
+
+// detailFieldKind returns true if the given decoded JSON value is of the given kind. The values
+// of the common array fields must be arrays of strings.
+func detailFieldKind(v interface{}, kind string, common bool) bool {
+	switch kind {
+	case DetailFieldString:
+		_, ok := v.(string)
+		return ok
+	case DetailFieldNumber:
+		_, ok := v.(float64)
+		return ok
+	case DetailFieldBoolean:
+		_, ok := v.(bool)
+		return ok
+	case DetailFieldObject:
+		_, ok := v.(map[string]interface{})
+		return ok
+	case DetailFieldArray:
+		vs, ok := v.([]interface{})
+		if ok && common {
+			for _, e := range vs {
+				if _, ok = e.(string); !ok {
+					break
+				}
+			}
+		}
+		return ok
+	}
+	return false
+}
+
+// authorizationDetails parses and validates the given "authorization_details" parameter value.
+// It returns nil if the value is empty.
+func (c *ProviderController) authorizationDetails(value string) ([]AuthorizationDetail, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if c.detailTypes == nil {
+		return nil, NewError(ErrInvalidAuthorizationDetails, "authorization details are not supported", "")
+	}
+	return c.detailTypes.Parse(value)
+}
+
+// grantedAuthorizationDetails returns the authorization details granted to the given access
+// token if the provider implements AuthorizationDetailsGranter, nil otherwise. The details are
+// returned in the form used by app.TokenMedia. The tokens are already issued when the details
+// are looked up so failures are logged and the details are omitted from the response rather
+// than discarding the tokens.
+func (c *ProviderController) grantedAuthorizationDetails(ctx context.Context, accessToken string) []map[string]interface{} {
+	granter, ok := c.provider.(AuthorizationDetailsGranter)
+	if !ok {
+		return nil
+	}
+	details, err := granter.AccessTokenAuthorizationDetails(ctx, accessToken)
+	if err != nil {
+		goa.LogError(ctx, "failed to retrieve granted authorization details", "err", err)
+		return nil
+	}
+	return detailsMedia(details)
+}
+
+// detailsMedia converts the given authorization details into the form used by the media types.
+func detailsMedia(details []AuthorizationDetail) []map[string]interface{} {
+	if len(details) == 0 {
+		return nil
+	}
+	res := make([]map[string]interface{}, len(details))
+	for i, d := range details {
+		res[i] = d
+	}
+	return res
+}
@@ -0,0 +1,50 @@
+package oauth2
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+// requestAuthorizer is a provider that implements RequestAuthorizer.
+type requestAuthorizer struct {
+	Provider
+}
+
+func (requestAuthorizer) AuthorizeRequest(ctx context.Context, req *AuthorizationRequest) (string, error) {
+	return "code", nil
+}
+
+func TestAuthorizationDetailsRequireRequestAuthorizer(t *testing.T) {
+	types := NewAuthorizationDetailTypes()
+	types.Register(&AuthorizationDetailType{Type: "account_information"})
+	params := url.Values{
+		"client_id":             {"client"},
+		"response_type":         {"code"},
+		"redirect_uri":          {"https://client.example.com/cb"},
+		"authorization_details": {`[{"type":"account_information"}]`},
+	}
+	cases := []struct {
+		Name     string
+		Provider Provider
+		Valid    bool
+	}{
+		{"authorizer", struct{ Provider }{}, false},
+		{"request authorizer", requestAuthorizer{}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := NewProviderController(newTestService(), tc.Provider, WithAuthorizationDetailTypes(types))
+			a, m, err := c.validateAuthorization(context.Background(), params, requestOrigin{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.Valid && (m != nil || len(a.request.AuthorizationDetails) != 1) {
+				t.Errorf("got error %v, expected the authorization details to be accepted", m)
+			}
+			if !tc.Valid && (m == nil || m.Error != string(ErrInvalidAuthorizationDetails)) {
+				t.Errorf("got error %v, expected %q", m, ErrInvalidAuthorizationDetails)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/goadesign/goa"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// DefaultLogoutTokenLifetime is the lifetime of the logout tokens sent to the back-channel logout
+// URIs of clients.
+const DefaultLogoutTokenLifetime = 2 * time.Minute
+
+// DefaultLogoutRetries is the number of retries of failed logout token deliveries of the default
+// sender, see WithBackChannelLogout.
+const DefaultLogoutRetries = 2
+
+// DefaultLogoutRequestTimeout is the timeout of the HTTP requests made by the default sender to
+// deliver logout tokens, see NewHTTPLogoutTokenSender.
+const DefaultLogoutRequestTimeout = 5 * time.Second
+
+// logoutDeliveryTimeout is the maximum time spent delivering a logout token including retries.
+const logoutDeliveryTimeout = time.Minute
+
+// DefaultLogoutRetryBackoff is the delay before the first retry of a failed logout token delivery
+// unless configured otherwise with NewHTTPLogoutTokenSender, the delay doubles on each retry.
+const DefaultLogoutRetryBackoff = time.Second
+
+// BackChannelLogoutEvent is the member of the "events" claim of logout tokens that identifies
+// them as such, see https://openid.net/specs/openid-connect-backchannel-1_0.html#LogoutToken
+const BackChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+type (
+	// LogoutTokenSender delivers the logout tokens described in
+	// https://openid.net/specs/openid-connect-backchannel-1_0.html#LogoutToken to the
+	// back-channel logout URIs of clients, see WithBackChannelLogout.
+	LogoutTokenSender interface {
+		// SendLogoutToken delivers the given logout token to the given back-channel
+		// logout URI.
+		SendLogoutToken(ctx context.Context, uri, token string) error
+	}
+
+	// LogoutTokenSenderFunc is a function that implements LogoutTokenSender.
+	LogoutTokenSenderFunc func(ctx context.Context, uri, token string) error
+
+	// httpLogoutTokenSender is a LogoutTokenSender that posts logout tokens with HTTP requests.
+	httpLogoutTokenSender struct {
+		client  *http.Client
+		retries int
+		backoff time.Duration
+	}
+
+	// detachedContext is a context that carries the values of its parent but is never
+	// canceled so that logout tokens are delivered after the logout request completes.
+	detachedContext struct {
+		context.Context
+	}
+
+	// logoutTokenClaims are the claims of logout tokens.
+	logoutTokenClaims struct {
+		jwt.Claims
+		SessionID string                 `json:"sid,omitempty"`
+		Events    map[string]interface{} `json:"events"`
+	}
+)
+
+// SendLogoutToken calls f.
+func (f LogoutTokenSenderFunc) SendLogoutToken(ctx context.Context, uri, token string) error {
+	return f(ctx, uri, token)
+}
+
+// NewHTTPLogoutTokenSender creates a LogoutTokenSender that posts logout tokens to back-channel
+// logout URIs as described in
+// https://openid.net/specs/openid-connect-backchannel-1_0.html#BCRequest using the given HTTP
+// client, a client with a DefaultLogoutRequestTimeout timeout if nil. Deliveries that fail with
+// a network error, a 429 or a 5xx status are retried up to the given number of times. The delay
+// before the first retry is given by backoff, DefaultLogoutRetryBackoff if zero, and doubles on
+// each retry.
+func NewHTTPLogoutTokenSender(client *http.Client, retries int, backoff time.Duration) LogoutTokenSender {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultLogoutRequestTimeout}
+	}
+	if backoff == 0 {
+		backoff = DefaultLogoutRetryBackoff
+	}
+	return &httpLogoutTokenSender{client: client, retries: retries, backoff: backoff}
+}
+
+// WithBackChannelLogout enables the back-channel logout described in
+// https://openid.net/specs/openid-connect-backchannel-1_0.html: when a session ends at the end
+// session endpoint the controller sends a logout token with the given sender to each client of the
+// session that registered a back-channel logout URI, see Client.BackchannelLogoutURI. The tokens
+// are delivered in the background once the logout response is sent, each delivery including
+// retries is canceled after one minute. The sender defaults to
+// NewHTTPLogoutTokenSender(nil, DefaultLogoutRetries, 0) if nil. Back-channel logout
+// requires a session store, an issuer and signing keys, see WithSessionStore, WithIssuer and
+// WithSigningKeys.
+func WithBackChannelLogout(sender LogoutTokenSender) ProviderOption {
+	return func(c *ProviderController) {
+		if sender == nil {
+			sender = NewHTTPLogoutTokenSender(nil, DefaultLogoutRetries, 0)
+		}
+		c.logoutSender = sender
+	}
+}
+
+// SendLogoutToken implements LogoutTokenSender.
+func (s *httpLogoutTokenSender) SendLogoutToken(ctx context.Context, uri, token string) error {
+	var (
+		backoff = s.backoff
+		err     error
+	)
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		if retry, err = s.post(ctx, uri, token); err == nil || !retry || attempt == s.retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends the given logout token to the given URI once. It returns true together with the
+// error if the delivery may succeed when retried.
+func (s *httpLogoutTokenSender) post(ctx context.Context, uri, token string) (bool, error) {
+	body := url.Values{"logout_token": {token}}.Encode()
+	req, err := http.NewRequest("POST", uri, strings.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNoContent:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("back-channel logout URI %q returned status %d", uri, resp.StatusCode)
+	}
+	return false, fmt.Errorf("back-channel logout URI %q returned status %d", uri, resp.StatusCode)
+}
+
+// Deadline implements context.Context.
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+// Done implements context.Context.
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+// Err implements context.Context.
+func (detachedContext) Err() error { return nil }
+
+// sendLogoutTokens delivers the given logout tokens indexed by client to the back-channel logout
+// URIs of the clients in the background. The deliveries outlive the given request context and
+// are bounded by logoutDeliveryTimeout. Failed deliveries are logged.
+func (c *ProviderController) sendLogoutTokens(ctx context.Context, tokens map[*Client]string) {
+	for client, token := range tokens {
+		go func(client *Client, token string) {
+			ctx, cancel := context.WithTimeout(detachedContext{ctx}, logoutDeliveryTimeout)
+			defer cancel()
+			if err := c.logoutSender.SendLogoutToken(ctx, client.BackchannelLogoutURI, token); err != nil {
+				goa.LogError(ctx, "back-channel logout failed", "client", client.ID, "err", err)
+			}
+		}(client, token)
+	}
+}
+
+// logoutToken issues a logout token for the given client and session. The token always includes
+// the session identifier so that it satisfies clients that require it, and the given subject if
+// not empty.
+func (c *ProviderController) logoutToken(client *Client, sid, subject string) (string, error) {
+	jti, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := logoutTokenClaims{
+		Claims: jwt.Claims{
+			Issuer:   c.issuer,
+			Subject:  subject,
+			Audience: jwt.Audience{client.ID},
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(DefaultLogoutTokenLifetime)),
+			ID:       jti,
+		},
+		SessionID: sid,
+		Events:    map[string]interface{}{BackChannelLogoutEvent: struct{}{}},
+	}
+	return c.keys.signWithType("logout+jwt", claims)
+}
@@ -0,0 +1,238 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+type (
+	// ClientRegistry gives access to the registered clients. When the controller is given a
+	// registry with WithClientRegistry it enforces the redirect URI matching policy of the
+	// clients instead of leaving it to the provider.
+	ClientRegistry interface {
+		// Client returns the client with the given identifier. It returns
+		// ErrClientNotFound if there is no such client.
+		Client(ctx context.Context, id string) (*Client, error)
+	}
+
+	// Client is a registered client.
+	Client struct {
+		// ID is the client identifier.
+		ID string
+		// RedirectURIs lists the registered redirection endpoints. Authorization requests
+		// must use one of these URIs exactly unless AllowLoopbackPort is set. Authorization
+		// requests may omit the redirect URI if there is exactly one registered URI, see
+		// https://tools.ietf.org/html/rfc6749#section-3.1.2.3
+		RedirectURIs []string
+		// AllowLoopbackPort allows authorization requests to use any port with registered
+		// loopback redirect URIs such as "http://127.0.0.1/callback" as required for
+		// native apps by https://tools.ietf.org/html/rfc8252#section-7.3
+		AllowLoopbackPort bool
+		// Native indicates that the client is a native app. Authorization requests made by
+		// native apps must use PKCE, see https://tools.ietf.org/html/rfc8252#section-6
+		// PKCE is also required for requests that use a loopback or private-use URI scheme
+		// redirect URI regardless of Native if the provider supports PKCE.
+		Native bool
+		// ResponseMode is the response mode used by authorization requests made by the
+		// client that do not specify one, it defaults to ResponseModeQuery. ResponseModeQuery
+		// is ignored for response types that include tokens which use ResponseModeFragment
+		// instead.
+		ResponseMode string
+		// ResponseTypes lists the response types the client may use such as "code" or
+		// "code id_token", see AllowsResponseType. It defaults to "code" only: the implicit
+		// and hybrid flows must be enabled explicitly for each client.
+		ResponseTypes []string
+		// RequirePushedRequests requires the client to push its authorization requests
+		// to the pushed authorization request endpoint, see
+		// https://tools.ietf.org/html/rfc9126#section-6
+		RequirePushedRequests bool
+		// JWKS contains the public keys of the client used to verify its signed request
+		// objects, see https://tools.ietf.org/html/rfc9101, and to encrypt the JWTs sent to
+		// the client.
+		JWKS *jose.JSONWebKeySet
+		// RequireSignedRequestObject requires the client to send its authorization
+		// request parameters in a signed request object.
+		RequireSignedRequestObject bool
+		// RequestURIs lists the URIs of the request objects the client may pass by
+		// reference with the "request_uri" parameter, see
+		// https://openid.net/specs/openid-connect-registration-1_0.html#ClientMetadata
+		// The controller only retrieves request objects from registered URIs.
+		RequestURIs []string
+		// ResponseEncryptionAlg is the JWE key management algorithm such as "RSA-OAEP-256"
+		// used to encrypt the JWTs sent by the JWT response modes with the client key, see
+		// https://openid.net/specs/oauth-v2-jarm.html#section-3 The JWTs are only signed if
+		// empty.
+		ResponseEncryptionAlg string
+		// ResponseEncryptionEnc is the JWE content encryption algorithm used with
+		// ResponseEncryptionAlg, it defaults to "A128CBC-HS256".
+		ResponseEncryptionEnc string
+		// PostLogoutRedirectURIs lists the URIs where the user agent may be redirected
+		// after a logout initiated by the client, see
+		// https://openid.net/specs/openid-connect-rpinitiated-1_0.html#ClientMetadata
+		PostLogoutRedirectURIs []string
+		// BackchannelLogoutURI is the URI where the controller sends logout tokens when
+		// a session the client takes part in ends, see
+		// https://openid.net/specs/openid-connect-backchannel-1_0.html#BCRegistration
+		BackchannelLogoutURI string
+		// BackchannelLogoutSessionRequired is true if the client requires the "sid" claim
+		// in logout tokens.
+		BackchannelLogoutSessionRequired bool
+		// FrontchannelLogoutURI is the URI rendered in an iframe by the logout page when a
+		// session the client takes part in ends, see
+		// https://openid.net/specs/openid-connect-frontchannel-1_0.html#RPLogout
+		FrontchannelLogoutURI string
+		// FrontchannelLogoutSessionRequired is true if the client requires the "iss" and
+		// "sid" query parameters in the front-channel logout URI.
+		FrontchannelLogoutSessionRequired bool
+	}
+
+	// memoryClientRegistry is an in-memory implementation of ClientRegistry.
+	memoryClientRegistry struct {
+		lock    sync.RWMutex
+		clients map[string]*Client
+	}
+)
+
+// ErrClientNotFound is the error returned by ClientRegistry implementations when a client does
+// not exist.
+var ErrClientNotFound = errors.New("client not found")
+
+// NewMemoryClientRegistry creates a ClientRegistry that keeps the given clients in memory.
+func NewMemoryClientRegistry(clients ...*Client) ClientRegistry {
+	r := &memoryClientRegistry{clients: make(map[string]*Client, len(clients))}
+	for _, c := range clients {
+		r.clients[c.ID] = c
+	}
+	return r
+}
+
+// WithClientRegistry configures the controller to look up clients in the given registry and to
+// enforce their redirect URI matching policy.
+func WithClientRegistry(r ClientRegistry) ProviderOption {
+	return func(c *ProviderController) {
+		c.clients = r
+	}
+}
+
+// DefaultRedirectURI returns the redirect URI used by requests that do not specify one: the
+// registered URI if there is exactly one, the empty string otherwise.
+func (c *Client) DefaultRedirectURI() string {
+	if len(c.RedirectURIs) == 1 {
+		return c.RedirectURIs[0]
+	}
+	return ""
+}
+
+// MatchRedirectURI returns true if the given redirect URI is one of the registered URIs. The
+// comparison is an exact string comparison except that the port of loopback redirect URIs is
+// ignored if AllowLoopbackPort is true.
+func (c *Client) MatchRedirectURI(redirectURI string) bool {
+	for _, r := range c.RedirectURIs {
+		if r == redirectURI {
+			return true
+		}
+	}
+	if !c.AllowLoopbackPort {
+		return false
+	}
+	u, err := url.Parse(redirectURI)
+	if err != nil || !isLoopback(u) {
+		return false
+	}
+	for _, r := range c.RedirectURIs {
+		ru, err := url.Parse(r)
+		if err != nil || !isLoopback(ru) {
+			continue
+		}
+		if ru.Hostname() == u.Hostname() && ru.Path == u.Path && ru.RawQuery == u.RawQuery && u.Fragment == "" && u.User == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPostLogoutRedirectURI returns true if the given URI is one of the registered post logout
+// redirect URIs. The comparison is an exact string comparison.
+func (c *Client) MatchPostLogoutRedirectURI(uri string) bool {
+	for _, r := range c.PostLogoutRedirectURIs {
+		if r == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchRequestURI returns true if the given URI is one of the registered request URIs. The
+// comparison is an exact string comparison.
+func (c *Client) MatchRequestURI(uri string) bool {
+	for _, r := range c.RequestURIs {
+		if r == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptionKey returns the first key of the client JWKS that may be used for encryption with the
+// given key management algorithm, nil if there is none.
+func (c *Client) encryptionKey(alg string) *jose.JSONWebKey {
+	if c.JWKS == nil {
+		return nil
+	}
+	for i, k := range c.JWKS.Keys {
+		if (k.Use == "" || k.Use == "enc") && (k.Algorithm == "" || k.Algorithm == alg) {
+			return &c.JWKS.Keys[i]
+		}
+	}
+	return nil
+}
+
+// validRedirectURI returns true if the given redirect URI is an absolute URL with a host or
+// uses a private-use URI scheme as described in
+// https://tools.ietf.org/html/rfc8252#section-7.1. Redirect URIs must not contain a fragment.
+func validRedirectURI(u *url.URL) bool {
+	if u.Scheme == "" || u.Fragment != "" {
+		return false
+	}
+	return u.Host != "" || isPrivateUseScheme(u)
+}
+
+// isNativeRedirect returns true if the given redirect URI is a loopback or private-use URI
+// scheme redirect URI which are only used by native apps.
+func isNativeRedirect(u *url.URL) bool {
+	return isLoopback(u) || isPrivateUseScheme(u)
+}
+
+// isPrivateUseScheme returns true if the given URL uses a private-use URI scheme based on a
+// reverse domain name such as "com.example.app:/callback" or "com.example.app://callback" as
+// required by https://tools.ietf.org/html/rfc8252#section-7.1
+func isPrivateUseScheme(u *url.URL) bool {
+	return strings.Contains(u.Scheme, ".")
+}
+
+// isLoopback returns true if the given URL is a loopback redirect URI as defined by
+// https://tools.ietf.org/html/rfc8252#section-7.3
+func isLoopback(u *url.URL) bool {
+	if u.Scheme != "http" {
+		return false
+	}
+	ip := net.ParseIP(u.Hostname())
+	return ip != nil && ip.IsLoopback()
+}
+
+// Client implements ClientRegistry.
+func (r *memoryClientRegistry) Client(ctx context.Context, id string) (*Client, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	c, ok := r.clients[id]
+	if !ok {
+		return nil, ErrClientNotFound
+	}
+	return c, nil
+}
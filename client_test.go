@@ -0,0 +1,104 @@
+package oauth2
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestIsNativeRedirect(t *testing.T) {
+	cases := map[string]bool{
+		"com.example.app:/callback":  true,
+		"com.example.app://callback": true,
+		"http://127.0.0.1/callback":  true,
+		"http://[::1]:8080/callback": true,
+		"https://app.example.com/cb": false,
+		"http://localhost/callback":  false,
+		"myapp://callback":           false,
+		"https://127.0.0.1/callback": false,
+	}
+	for uri, expected := range cases {
+		u, err := url.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := isNativeRedirect(u); actual != expected {
+			t.Errorf("%s: got %v, expected %v", uri, actual, expected)
+		}
+	}
+}
+
+func TestMatchRedirectURI(t *testing.T) {
+	registered := []string{
+		"https://client.example.com/cb",
+		"http://127.0.0.1/cb",
+		"http://[::1]:8080/cb?app=1",
+		"http://localhost/cb",
+	}
+	cases := []struct {
+		URI          string
+		Exact        bool
+		LoopbackPort bool
+	}{
+		{"https://client.example.com/cb", true, true},
+		{"https://client.example.com/cb/", false, false},
+		{"https://client.example.com:8443/cb", false, false},
+		{"http://client.example.com/cb", false, false},
+		{"http://127.0.0.1/cb", true, true},
+		{"http://127.0.0.1:51004/cb", false, true},
+		{"http://127.0.0.1:51004/other", false, false},
+		{"http://127.0.0.1:51004/cb?x=1", false, false},
+		{"http://user@127.0.0.1:51004/cb", false, false},
+		{"https://127.0.0.1:51004/cb", false, false},
+		{"http://[::1]:51004/cb?app=1", false, true},
+		{"http://127.0.0.2:51004/cb", false, false},
+		{"http://localhost/cb", true, true},
+		{"http://localhost:51004/cb", false, false},
+	}
+	for _, tc := range cases {
+		c := &Client{ID: "client", RedirectURIs: registered}
+		if m := c.MatchRedirectURI(tc.URI); m != tc.Exact {
+			t.Errorf("%s: got %v, expected %v", tc.URI, m, tc.Exact)
+		}
+		c.AllowLoopbackPort = true
+		if m := c.MatchRedirectURI(tc.URI); m != tc.LoopbackPort {
+			t.Errorf("%s: got %v with AllowLoopbackPort, expected %v", tc.URI, m, tc.LoopbackPort)
+		}
+	}
+}
+
+func TestDefaultRedirectURI(t *testing.T) {
+	cases := []struct {
+		Name       string
+		Registered []string
+		Expected   string
+	}{
+		{"none", nil, ""},
+		{"one", []string{"https://client.example.com/cb"}, "https://client.example.com/cb"},
+		{"several", []string{"https://client.example.com/cb", "https://client.example.com/other"}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			client := &Client{ID: "client", RedirectURIs: tc.Registered}
+			if uri := client.DefaultRedirectURI(); uri != tc.Expected {
+				t.Errorf("got default redirect URI %q, expected %q", uri, tc.Expected)
+			}
+			c := NewProviderController(newTestService(), struct{ Provider }{},
+				WithClientRegistry(NewMemoryClientRegistry(client)))
+			params := url.Values{"client_id": {"client"}, "response_type": {"code"}}
+			a, m, err := c.validateAuthorization(context.Background(), params, requestOrigin{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.Expected == "" {
+				if m == nil || m.Error != MissingRedirect.Error {
+					t.Errorf("got error %v, expected the redirect URI to be required", m)
+				}
+				return
+			}
+			if m != nil || a.request.RedirectURI != tc.Expected {
+				t.Errorf("got error %v, expected the redirect URI to default to %q", m, tc.Expected)
+			}
+		})
+	}
+}
@@ -1,12 +1,22 @@
 package oauth2
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Private type used to key context.
 type key int
 
-// Context key value
-const clientIDKey key = 1
+// Context key values
+const (
+	clientIDKey key = iota + 1
+	subjectKey
+	dpopKey
+	authTimeKey
+	acrKey
+	sessionIDKey
+)
 
 // WithClientID creates a new context containing the given client ID that can be retrieved with
 // ContextClientID.
@@ -21,3 +31,82 @@ func ContextClientID(ctx context.Context) string {
 	}
 	return ""
 }
+
+// WithSubject creates a new context containing the given resource owner identifier that can be
+// retrieved with ContextSubject. Services set the subject in the context given to Authorize once
+// the resource owner has been authenticated.
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey, subject)
+}
+
+// ContextSubject extracts the resource owner identifier from the given context.
+func ContextSubject(ctx context.Context) string {
+	if sub := ctx.Value(subjectKey); sub != nil {
+		return sub.(string)
+	}
+	return ""
+}
+
+// WithAuthTime creates a new context containing the time when the resource owner authenticated
+// that can be retrieved with ContextAuthTime. Services set it in the context given to Authorize
+// together with the subject, it is used to enforce the "max_age" parameter and as the
+// "auth_time" claim of ID tokens.
+func WithAuthTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, authTimeKey, t)
+}
+
+// ContextAuthTime extracts the time when the resource owner authenticated from the given
+// context, the zero time if unknown.
+func ContextAuthTime(ctx context.Context) time.Time {
+	if t := ctx.Value(authTimeKey); t != nil {
+		return t.(time.Time)
+	}
+	return time.Time{}
+}
+
+// WithACR creates a new context containing the authentication context class reference satisfied
+// by the authentication of the resource owner that can be retrieved with ContextACR. It is used
+// as the "acr" claim of ID tokens.
+func WithACR(ctx context.Context, acr string) context.Context {
+	return context.WithValue(ctx, acrKey, acr)
+}
+
+// ContextACR extracts the authentication context class reference from the given context.
+func ContextACR(ctx context.Context) string {
+	if acr := ctx.Value(acrKey); acr != nil {
+		return acr.(string)
+	}
+	return ""
+}
+
+// WithSessionID creates a new context containing the identifier of the session of the resource
+// owner with the authorization server that can be retrieved with ContextSessionID. Services set
+// it in the contexts given to Authorize and EndSession, it is used as the "sid" claim of ID
+// tokens and logout tokens and to track the clients that take part in the session, see
+// WithSessionStore.
+func WithSessionID(ctx context.Context, sid string) context.Context {
+	return context.WithValue(ctx, sessionIDKey, sid)
+}
+
+// ContextSessionID extracts the session identifier from the given context.
+func ContextSessionID(ctx context.Context) string {
+	if sid := ctx.Value(sessionIDKey); sid != nil {
+		return sid.(string)
+	}
+	return ""
+}
+
+// WithDPoPThumbprint creates a new context containing the given DPoP key thumbprint that can be
+// retrieved with ContextDPoPThumbprint.
+func WithDPoPThumbprint(ctx context.Context, jkt string) context.Context {
+	return context.WithValue(ctx, dpopKey, jkt)
+}
+
+// ContextDPoPThumbprint extracts the JWK SHA-256 thumbprint of the key used to sign the DPoP
+// proof of the request from the given context, see WithDPoP and NewDPoPMiddleware.
+func ContextDPoPThumbprint(ctx context.Context) string {
+	if jkt := ctx.Value(dpopKey); jkt != nil {
+		return jkt.(string)
+	}
+	return ""
+}
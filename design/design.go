@@ -3,9 +3,33 @@ package design
 import (
 	. "github.com/goadesign/goa/design"
 	. "github.com/goadesign/goa/design/apidsl"
+	"github.com/goadesign/goa/dslengine"
 	. "github.com/goadesign/oauth2/design/public"
 )
 
+// impliedScopes records the scope implications declared with ScopeImplies.
+var impliedScopes = make(map[string][]string)
+
+// parEndpoint is the request path of the pushed authorization request endpoint declared with
+// PushedAuthorizationEndpoint if any.
+var parEndpoint string
+
+// introspectionEndpoint is the request path of the token introspection endpoint declared with
+// IntrospectionEndpoint if any.
+var introspectionEndpoint string
+
+// metadataEndpoint is true if the authorization server metadata endpoint was declared with
+// AuthorizationServerMetadata.
+var metadataEndpoint bool
+
+// discoveryEndpoint is true if the OpenID Connect discovery endpoint was declared with
+// OpenIDConfiguration.
+var discoveryEndpoint bool
+
+// endSessionEndpoint is the request path of the end session endpoint declared with
+// EndSessionEndpoint if any.
+var endSessionEndpoint string
+
 // OAuth2 initializes the design definitions needed to implement a OAuth2 provider.
 // This function defines the OAuth2Provider resource which is implemented by the
 // OAuth2ProviderController defined in the parent package. This controller implements the
@@ -39,26 +63,49 @@ func OAuth2(authorizationEndpoint, tokenEndpoint string, dsl ...func()) *Securit
 	// The resource that implements the OAuth2 standard defined by RFC 6749.
 	// See https://tools.ietf.org/html/rfc6749
 	var _ = Resource("oauth2_provider", func() {
-		Description("This resource implements the OAuth2 authorization code flow")
+		Description("This resource implements the OAuth2 authorization code, implicit and OpenID Connect hybrid flows")
 
 		Action("authorize", func() {
 			Description("Authorize OAuth2 client")
 			Routing(GET(authorizationEndpoint))
 			Params(func() {
-				Param("response_type", String, `Value MUST be set to "code"`, func() {
-					Enum("code")
-				})
+				Param("response_type", String, `Space-delimited list of "code", "token" and "id_token", e.g. "code" or "code id_token"`)
 				Param("client_id", String, "The client identifier")
 				Param("redirect_uri", String, "Redirection endpoint")
 				Param("scope", String, "The scope of the access request")
 				Param("state", String, "An opaque value used by the client to maintain state between the request and callback")
-				Required("response_type", "client_id")
+				Param("code_challenge", String, "The PKCE code challenge derived from the code verifier, see https://tools.ietf.org/html/rfc7636#section-4.2")
+				Param("code_challenge_method", String, `The method used to derive the PKCE code challenge, defaults to "plain"`, func() {
+					Enum("plain", "S256")
+				})
+				Param("response_mode", String, "The mechanism used to return the authorization response parameters to the client", func() {
+					Enum("query", "fragment", "form_post", "query.jwt", "fragment.jwt", "form_post.jwt", "jwt")
+				})
+				Param("nonce", String, `OpenID Connect value used to associate a client session with an ID token, required when the response type includes "id_token"`)
+				Param("prompt", String, `Space-delimited list of "none", "login", "consent" and "select_account" specifying whether the resource owner must be prompted for authentication and consent`)
+				Param("max_age", Integer, "Maximum elapsed time in seconds since the last active authentication of the resource owner", func() {
+					Minimum(0)
+				})
+				Param("login_hint", String, "Hint about the login identifier the resource owner might use to log in")
+				Param("id_token_hint", String, "ID token previously issued to the client, used as a hint about the current authenticated session of the resource owner")
+				Param("ui_locales", String, "Space-separated list of the preferred languages of the resource owner for the user interface, as BCP47 language tags")
+				Param("acr_values", String, "Space-separated list of the requested authentication context class references in order of preference")
+				Param("resource", ArrayOf(String), "The URIs of the resource servers where the client intends to use the requested access token, see https://tools.ietf.org/html/rfc8707#section-2.1")
+				Param("authorization_details", String, "JSON array of the authorization details requested by the client, see https://tools.ietf.org/html/rfc9396#section-2")
+				Param("request", String, "Signed request object containing the authorization request parameters, see https://tools.ietf.org/html/rfc9101")
+				Param("request_uri", String, "Reference to a pushed authorization request or to a signed request object, see https://tools.ietf.org/html/rfc9126 and https://tools.ietf.org/html/rfc9101")
+				// response_type may come from a pushed authorization request or request object
+				Required("client_id")
 			})
 			Response(Found, func() {
 				Headers(func() {
-					Header("Location", String, "Redirect URL containing the authorization code and state param if any")
+					Header("Location", String, "Redirect URL containing the authorization code, tokens and state param if any")
 				})
 			})
+			Response(OK, func() {
+				Description("Auto-submitting HTML form used by the form_post response mode")
+				Media("text/html")
+			})
 			Response(BadRequest, OAuth2ErrorMedia)
 		})
 
@@ -70,6 +117,80 @@ func OAuth2(authorizationEndpoint, tokenEndpoint string, dsl ...func()) *Securit
 			Response(OK, OAuth2TokenMedia)
 			Response(BadRequest, OAuth2ErrorMedia)
 		})
+
+		// The pushed authorization request endpoint is optional, see
+		// PushedAuthorizationEndpoint.
+		if parEndpoint != "" {
+			Action("par", func() {
+				Description("Push authorization request, see https://tools.ietf.org/html/rfc9126")
+				Routing(POST(parEndpoint))
+				Security(OAuth2ClientBasicAuth)
+				Response(Created, OAuth2PushedAuthorizationMedia)
+				Response(BadRequest, OAuth2ErrorMedia)
+			})
+		}
+
+		// The token introspection endpoint is optional, see IntrospectionEndpoint.
+		if introspectionEndpoint != "" {
+			Action("introspect", func() {
+				Description("Introspect access or refresh token, see https://tools.ietf.org/html/rfc7662")
+				Routing(POST(introspectionEndpoint))
+				Security(OAuth2ClientBasicAuth)
+				Response(OK, OAuth2IntrospectionMedia)
+				Response(BadRequest, OAuth2ErrorMedia)
+			})
+		}
+
+		// The authorization server metadata endpoint is optional, see
+		// AuthorizationServerMetadata.
+		if metadataEndpoint {
+			Action("metadata", func() {
+				Description("Get authorization server metadata, see https://tools.ietf.org/html/rfc8414")
+				Routing(GET("/.well-known/oauth-authorization-server"))
+				Response(OK, func() {
+					Description("Authorization server metadata JSON document")
+					Media("application/json")
+				})
+			})
+		}
+
+		// The OpenID Connect discovery endpoint is optional, see OpenIDConfiguration.
+		if discoveryEndpoint {
+			Action("openid_configuration", func() {
+				Description("Get OpenID Connect provider configuration, see https://openid.net/specs/openid-connect-discovery-1_0.html")
+				Routing(GET("/.well-known/openid-configuration"))
+				Response(OK, func() {
+					Description("OpenID Connect provider configuration JSON document")
+					Media("application/json")
+				})
+			})
+		}
+
+		// The end session endpoint is optional, see EndSessionEndpoint.
+		if endSessionEndpoint != "" {
+			Action("end_session", func() {
+				Description("Log out the resource owner, see https://openid.net/specs/openid-connect-rpinitiated-1_0.html")
+				Routing(GET(endSessionEndpoint), POST(endSessionEndpoint))
+				Params(func() {
+					Param("id_token_hint", String, "ID token previously issued to the client, used as a hint about the current authenticated session of the resource owner")
+					Param("logout_hint", String, "Hint about the resource owner that is logging out")
+					Param("client_id", String, "The client identifier")
+					Param("post_logout_redirect_uri", String, "URI where the user agent is redirected after logout, must be registered for the client")
+					Param("state", String, "An opaque value used by the client to maintain state between the logout request and the redirect")
+					Param("ui_locales", String, "Space-separated list of the preferred languages of the resource owner for the user interface, as BCP47 language tags")
+				})
+				Response(Found, func() {
+					Headers(func() {
+						Header("Location", String, "Post logout redirect URI containing the state param if any")
+					})
+				})
+				Response(OK, func() {
+					Description("HTML page confirming the logout or asking the resource owner to confirm it")
+					Media("text/html")
+				})
+				Response(BadRequest, OAuth2ErrorMedia)
+			})
+		}
 	})
 
 	// Define security scheme
@@ -86,6 +207,137 @@ func OAuth2(authorizationEndpoint, tokenEndpoint string, dsl ...func()) *Securit
 
 }
 
+// ScopeImplies declares that the given scope implies the other given scopes: access tokens granted
+// with the scope may be used wherever one of the implied scopes is required. ScopeImplies must
+// appear in the OAuth2 DSL. The scopegen goagen plugin uses the implications to generate the scope
+// registry.
+//
+// Example:
+//
+//    var OAuth2Sec = OAuth2("/oauth2/auth", "/oauth2/token", func() {
+//        Scope("api:read", "Scope granting read access")
+//        Scope("api:write", "Scope granting write access")
+//        ScopeImplies("api:write", "api:read")
+//    })
+//
+func ScopeImplies(scope string, implied ...string) {
+	if _, ok := dslengine.CurrentDefinition().(*SecuritySchemeDefinition); !ok {
+		dslengine.IncompatibleDSL()
+		return
+	}
+	impliedScopes[scope] = append(impliedScopes[scope], implied...)
+}
+
+// PushedAuthorizationEndpoint defines the "par" action which implements the pushed authorization
+// request endpoint described in https://tools.ietf.org/html/rfc9126 at the given request path.
+// Clients push the parameters of their authorization requests to the endpoint and receive a
+// request URI to use in the authorization request instead. PushedAuthorizationEndpoint must
+// appear in the OAuth2 DSL.
+//
+// Example:
+//
+//    var OAuth2Sec = OAuth2("/oauth2/auth", "/oauth2/token", func() {
+//        PushedAuthorizationEndpoint("/oauth2/par")
+//        Scope("api:read", "Scope granting read access")
+//    })
+//
+func PushedAuthorizationEndpoint(path string) {
+	if _, ok := dslengine.CurrentDefinition().(*SecuritySchemeDefinition); !ok {
+		dslengine.IncompatibleDSL()
+		return
+	}
+	parEndpoint = path
+}
+
+// IntrospectionEndpoint defines the "introspect" action which implements the token introspection
+// endpoint described in https://tools.ietf.org/html/rfc7662 at the given request path. Resource
+// servers authenticate with the client basic auth and send the tokens presented to them to the
+// endpoint to learn whether they are active and what they grant. IntrospectionEndpoint must
+// appear in the OAuth2 DSL.
+//
+// Example:
+//
+//    var OAuth2Sec = OAuth2("/oauth2/auth", "/oauth2/token", func() {
+//        IntrospectionEndpoint("/oauth2/introspect")
+//        Scope("api:read", "Scope granting read access")
+//    })
+//
+func IntrospectionEndpoint(path string) {
+	if _, ok := dslengine.CurrentDefinition().(*SecuritySchemeDefinition); !ok {
+		dslengine.IncompatibleDSL()
+		return
+	}
+	introspectionEndpoint = path
+}
+
+// AuthorizationServerMetadata defines the "metadata" action which serves the authorization server
+// metadata document described in https://tools.ietf.org/html/rfc8414 at
+// "/.well-known/oauth-authorization-server". Clients use the document to discover the endpoints
+// and capabilities of the authorization server including its issuer identifier.
+// AuthorizationServerMetadata must appear in the OAuth2 DSL.
+//
+// Example:
+//
+//    var OAuth2Sec = OAuth2("/oauth2/auth", "/oauth2/token", func() {
+//        AuthorizationServerMetadata()
+//        Scope("api:read", "Scope granting read access")
+//    })
+//
+func AuthorizationServerMetadata() {
+	if _, ok := dslengine.CurrentDefinition().(*SecuritySchemeDefinition); !ok {
+		dslengine.IncompatibleDSL()
+		return
+	}
+	metadataEndpoint = true
+}
+
+// OpenIDConfiguration defines the "openid_configuration" action which serves the OpenID Connect
+// discovery document described in https://openid.net/specs/openid-connect-discovery-1_0.html at
+// "/.well-known/openid-configuration". The document lists the same information as the
+// authorization server metadata together with the OpenID Connect specific capabilities.
+// OpenIDConfiguration must appear in the OAuth2 DSL.
+//
+// Example:
+//
+//    var OAuth2Sec = OAuth2("/oauth2/auth", "/oauth2/token", func() {
+//        OpenIDConfiguration()
+//        Scope("openid", "Scope requesting an ID token")
+//    })
+//
+func OpenIDConfiguration() {
+	if _, ok := dslengine.CurrentDefinition().(*SecuritySchemeDefinition); !ok {
+		dslengine.IncompatibleDSL()
+		return
+	}
+	discoveryEndpoint = true
+}
+
+// EndSessionEndpoint defines the "end_session" action which implements the OpenID Connect end
+// session endpoint described in https://openid.net/specs/openid-connect-rpinitiated-1_0.html at
+// the given request path. Clients redirect the user agent to the endpoint to log out the
+// resource owner. EndSessionEndpoint must appear in the OAuth2 DSL.
+//
+// Example:
+//
+//    var OAuth2Sec = OAuth2("/oauth2/auth", "/oauth2/token", func() {
+//        EndSessionEndpoint("/oauth2/logout")
+//        Scope("openid", "Scope requesting an ID token")
+//    })
+//
+func EndSessionEndpoint(path string) {
+	if _, ok := dslengine.CurrentDefinition().(*SecuritySchemeDefinition); !ok {
+		dslengine.IncompatibleDSL()
+		return
+	}
+	endSessionEndpoint = path
+}
+
+// ImpliedScopes returns the scopes directly implied by the given scope as declared with
+// ScopeImplies.
+func ImpliedScopes(scope string) []string {
+	return impliedScopes[scope]
+}
+
 // OAuth2ClientBasicAuth defines the basic auth used to make requests to the token endpoint.  The
 // username and password must correspond to the client id and secret and be encoded using form
 // encoding as described in https://tools.ietf.org/html/rfc6749#section-2.3.1
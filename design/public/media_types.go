@@ -16,6 +16,9 @@ var OAuth2TokenMedia = MediaType("application/vnd.goa.example.oauth2.token+json"
 		Attribute("expires_in", Integer, "The lifetime in seconds of the access token")
 		Attribute("refresh_token", String, "The refresh token")
 		Attribute("scope", String, "The scope of the access token")
+		Attribute("issued_token_type", String, "The identifier of the type of the token issued in response to a token exchange request")
+		Attribute("authorization_details", ArrayOf(HashOf(String, Any)), "The authorization details granted to the access token, see https://tools.ietf.org/html/rfc9396#section-7")
+		Attribute("id_token", String, "The ID token issued for OpenID Connect requests, see https://openid.net/specs/openid-connect-core-1_0.html#TokenResponse")
 		Required("access_token", "token_type")
 	})
 	View("default", func() {
@@ -24,6 +27,9 @@ var OAuth2TokenMedia = MediaType("application/vnd.goa.example.oauth2.token+json"
 		Attribute("expires_in")
 		Attribute("refresh_token")
 		Attribute("scope")
+		Attribute("issued_token_type")
+		Attribute("authorization_details")
+		Attribute("id_token")
 	})
 })
 
@@ -34,7 +40,7 @@ var OAuth2ErrorMedia = MediaType("application/vnd.goa.example.oauth2.error+json"
 	TypeName("OAuth2ErrorMedia")
 	Attributes(func() {
 		Attribute("error", String, "Error returned by authorization server", func() {
-			Enum("invalid_request", "invalid_client", "invalid_grant", "unauthorized_client", "unsupported_grant_type")
+			Enum("invalid_request", "invalid_client", "invalid_grant", "unauthorized_client", "unsupported_grant_type", "invalid_scope", "invalid_target", "access_denied", "unsupported_response_type", "invalid_request_uri", "invalid_request_object", "request_not_supported", "request_uri_not_supported", "invalid_authorization_details", "invalid_dpop_proof", "use_dpop_nonce", "login_required", "consent_required", "interaction_required")
 		})
 		Attribute("error_description", String, "Human readable ASCII text providing additional information")
 		Attribute("error_uri", String, "A URI identifying a human-readable web page with information about the error")
@@ -46,3 +52,55 @@ var OAuth2ErrorMedia = MediaType("application/vnd.goa.example.oauth2.error+json"
 		Attribute("error_uri")
 	})
 })
+
+// OAuth2IntrospectionMedia describes the response sent in case of successful token introspection
+// request.
+// See https://tools.ietf.org/html/rfc7662#section-2.2
+var OAuth2IntrospectionMedia = MediaType("application/vnd.goa.example.oauth2.introspection+json", func() {
+	Description("OAuth2 token introspection response, see https://tools.ietf.org/html/rfc7662#section-2.2")
+	TypeName("IntrospectionMedia")
+	Attributes(func() {
+		Attribute("active", Boolean, "Whether the token is currently active")
+		Attribute("scope", String, "The scope of the token")
+		Attribute("client_id", String, "The identifier of the client the token was issued to")
+		Attribute("sub", String, "The identifier of the resource owner")
+		Attribute("token_type", String, `The type of the token, e.g. "Bearer"`)
+		Attribute("exp", Integer, "The expiration time of the token in seconds since the epoch")
+		Attribute("iat", Integer, "The time the token was issued in seconds since the epoch")
+		Attribute("aud", ArrayOf(String), "The audience of the token")
+		Attribute("iss", String, "The issuer identifier of the authorization server")
+		Attribute("cnf", HashOf(String, String), "The confirmation of the key the token is bound to, see https://tools.ietf.org/html/rfc9449#section-6.2")
+		Attribute("authorization_details", ArrayOf(HashOf(String, Any)), "The authorization details granted to the token, see https://tools.ietf.org/html/rfc9396#section-9.2")
+		Required("active")
+	})
+	View("default", func() {
+		Attribute("active")
+		Attribute("scope")
+		Attribute("client_id")
+		Attribute("sub")
+		Attribute("token_type")
+		Attribute("exp")
+		Attribute("iat")
+		Attribute("aud")
+		Attribute("iss")
+		Attribute("cnf")
+		Attribute("authorization_details")
+	})
+})
+
+// OAuth2PushedAuthorizationMedia describes the response sent in case of successful pushed
+// authorization request.
+// See https://tools.ietf.org/html/rfc9126#section-2.2
+var OAuth2PushedAuthorizationMedia = MediaType("application/vnd.goa.example.oauth2.par+json", func() {
+	Description("OAuth2 pushed authorization request successful response, see https://tools.ietf.org/html/rfc9126#section-2.2")
+	TypeName("PushedAuthorizationMedia")
+	Attributes(func() {
+		Attribute("request_uri", String, "The request URI to use in the authorization request")
+		Attribute("expires_in", Integer, "The lifetime in seconds of the request URI")
+		Required("request_uri", "expires_in")
+	})
+	View("default", func() {
+		Attribute("request_uri")
+		Attribute("expires_in")
+	})
+})
@@ -12,21 +12,36 @@ import (
 // It also describes the body sent by the client to refresh a token.
 // See https://tools.ietf.org/html/rfc6749#section-6
 //
+// Finally it describes the body sent by the client to exchange a security token for another.
+// See https://tools.ietf.org/html/rfc8693#section-2.1
+//
 var OAuth2TokenPayload = Type("TokenPayload", func() {
-	Description(`Payload sent by client to obtain refresh and access token or to refresh an access token.
-see https://tools.ietf.org/html/rfc6749#section-4.1.3 and https://tools.ietf.org/html/rfc6749#section-6`)
+	Description(`Payload sent by client to obtain refresh and access token, to refresh an access token or to exchange a token.
+see https://tools.ietf.org/html/rfc6749#section-4.1.3, https://tools.ietf.org/html/rfc6749#section-6 and https://tools.ietf.org/html/rfc8693#section-2.1`)
 	Attribute("grant_type", String, `Value MUST be set to "authorization_code" when obtaining initial refresh and access token.
-Value MUST be set to "refresh_token" when refreshing an access token.`, func() {
-		Enum("authorization_code", "refresh_token")
+Value MUST be set to "refresh_token" when refreshing an access token.
+Value MUST be set to "urn:ietf:params:oauth:grant-type:token-exchange" when exchanging a token.`, func() {
+		Enum("authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:token-exchange")
 	})
 
 	// Initial refresh and access token request payload
 	Attribute("code", String, "The authorization code received from the authorization server, used for initial refresh and access token request")
 	Attribute("redirect_uri", String, "The redirect_uri parameter specified when making the authorize request to obtain the authorization code, used for initial refresh and access token request")
+	Attribute("code_verifier", String, "The PKCE code verifier matching the code challenge sent in the authorize request, used for initial refresh and access token request")
+	Attribute("authorization_details", String, "JSON array of the authorization details requested for the access token, see https://tools.ietf.org/html/rfc9396#section-6")
 
 	// Refresh token payload
 	Attribute("refresh_token", String, "The refresh token issued to the client, used for refreshing an access token")
-	Attribute("scope", String, "The scope of the access request, used for refreshing an access token")
+	Attribute("scope", String, "The scope of the access request, used for refreshing or exchanging an access token")
+
+	// Token exchange payload
+	Attribute("subject_token", String, "The security token that represents the identity of the party on behalf of whom the request is being made, used for token exchange")
+	Attribute("subject_token_type", String, "The identifier of the type of the subject token, used for token exchange")
+	Attribute("actor_token", String, "The security token that represents the identity of the acting party, used for token exchange")
+	Attribute("actor_token_type", String, "The identifier of the type of the actor token, required when actor_token is present, used for token exchange")
+	Attribute("resource", ArrayOf(String), "The URIs of the target services or resources where the client intends to use the requested token, see https://tools.ietf.org/html/rfc8707#section-2.2 and https://tools.ietf.org/html/rfc8693#section-2.1")
+	Attribute("audience", ArrayOf(String), "The logical names of the target services where the client intends to use the requested token, used for token exchange")
+	Attribute("requested_token_type", String, "The identifier of the type of the requested security token, used for token exchange")
 
 	Required("grant_type")
 })
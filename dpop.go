@@ -0,0 +1,454 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/goadesign/goa"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// DPoPTokenType is the token type of the access tokens bound to a DPoP key, see
+// https://tools.ietf.org/html/rfc9449#section-5
+const DPoPTokenType = "DPoP"
+
+// DefaultDPoPProofLifetime is the maximum age of DPoP proofs unless configured otherwise, see
+// DPoP.ProofLifetime.
+const DefaultDPoPProofLifetime = time.Minute
+
+// dpopAlgorithms lists the JWS algorithms accepted by default in DPoP proofs.
+var dpopAlgorithms = []string{
+	string(jose.ES256), string(jose.ES384), string(jose.ES512),
+	string(jose.RS256), string(jose.RS384), string(jose.RS512),
+	string(jose.PS256), string(jose.PS384), string(jose.PS512),
+	string(jose.EdDSA),
+}
+
+type (
+	// DPoP verifies the proofs of possession that clients send in the "DPoP" header of token
+	// requests and of requests made to resource servers with DPoP-bound access tokens as
+	// described in https://tools.ietf.org/html/rfc9449.
+	DPoP struct {
+		// BaseURL is the external base URL of the service, e.g. "https://api.example.com".
+		// It is used to compute the URL that the "htu" claim of the proofs must match. The
+		// URL is derived from the request host if empty.
+		BaseURL string
+		// ProofLifetime is the maximum difference between the "iat" claim of the proofs
+		// and the current time, it defaults to DefaultDPoPProofLifetime.
+		ProofLifetime time.Duration
+		// Algorithms lists the accepted JWS algorithms, it defaults to the asymmetric
+		// algorithms supported by the package.
+		Algorithms []string
+		// Nonces is optional. When set proofs must include a nonce issued by Nonces,
+		// requests without a valid nonce are rejected with a "use_dpop_nonce" error and
+		// a new nonce in the "DPoP-Nonce" header.
+		Nonces DPoPNonces
+
+		replay ReplayCache
+		now    func() time.Time
+	}
+
+	// DPoPNonces issues and validates the nonces that DPoP proofs must include, see
+	// https://tools.ietf.org/html/rfc9449#section-8
+	DPoPNonces interface {
+		// Nonce returns a new nonce.
+		Nonce() (string, error)
+		// Valid returns true if the given nonce was issued by Nonce and has not expired.
+		Valid(nonce string) bool
+	}
+
+	// AccessTokenValidator validates the access tokens presented to resource servers, see
+	// NewDPoPMiddleware. It returns the context given to the next handler, typically
+	// enriched with the token subject and scope, and the JWK SHA-256 thumbprint the token is
+	// bound to (the "jkt" member of its "cnf" claim), empty for bearer tokens. Upon failure
+	// it should return an error created with ErrUnauthorized or ErrInsufficientScope.
+	AccessTokenValidator func(ctx context.Context, accessToken string) (newCtx context.Context, jkt string, err error)
+
+	// DPoPBinder is the interface optionally implemented by providers that bind the access
+	// tokens they issue to the DPoP key given in the DPoPJKT field of the token requests. The
+	// token responses only report the "DPoP" token type when the provider confirms that the
+	// access token is bound to the key of the request DPoP proof, the access tokens issued by
+	// other providers are reported as bearer tokens.
+	DPoPBinder interface {
+		// AccessTokenJKT returns the JWK SHA-256 thumbprint of the DPoP key the given
+		// access token is bound to, empty if it is a bearer token.
+		AccessTokenJKT(ctx context.Context, accessToken string) (string, error)
+	}
+
+	// Confirmation is the "cnf" claim that binds access tokens to a DPoP key, see
+	// https://tools.ietf.org/html/rfc9449#section-6 It is used in the claims of JWT access
+	// tokens and in token introspection responses, see TokenIntrospection.
+	Confirmation struct {
+		// JKT is the base64url encoded JWK SHA-256 thumbprint of the DPoP key.
+		JKT string `json:"jkt"`
+	}
+
+	// hmacDPoPNonces is a DPoPNonces implementation that issues nonces authenticated with
+	// HMAC-SHA256 so that they do not need to be stored.
+	hmacDPoPNonces struct {
+		key      []byte
+		lifetime time.Duration
+		now      func() time.Time
+	}
+
+	// dpopClaims contains the claims of a DPoP proof.
+	dpopClaims struct {
+		ID     string `json:"jti"`
+		Method string `json:"htm"`
+		URI    string `json:"htu"`
+		Issued int64  `json:"iat"`
+		Nonce  string `json:"nonce,omitempty"`
+		ATH    string `json:"ath,omitempty"`
+	}
+)
+
+// NewDPoP creates a DPoP proof verifier that uses the given replay cache to reject proofs that
+// are presented more than once.
+func NewDPoP(replay ReplayCache) *DPoP {
+	return &DPoP{ProofLifetime: DefaultDPoPProofLifetime, replay: replay, now: time.Now}
+}
+
+// NewDPoPNonces creates a DPoPNonces that issues nonces valid for the given lifetime. The nonces
+// are authenticated with the given HMAC key so that all the instances of the service sharing the
+// key accept them.
+func NewDPoPNonces(key []byte, lifetime time.Duration) DPoPNonces {
+	return &hmacDPoPNonces{key: key, lifetime: lifetime, now: time.Now}
+}
+
+// WithDPoP configures the controller to verify the DPoP proofs sent to the token endpoint and
+// to issue access tokens bound to the proof keys. The key thumbprint is given to the providers
+// in the DPoPJKT fields of ExchangeRequest, RefreshRequest, CodeGrant and TokenExchangeRequest.
+// The token responses report the "DPoP" token type only if the provider implements DPoPBinder
+// and confirms the binding, the access tokens are reported as bearer tokens otherwise. Token
+// requests without a DPoP proof get bearer tokens.
+func WithDPoP(d *DPoP) ProviderOption {
+	return func(c *ProviderController) {
+		c.dpop = d
+	}
+}
+
+// NewDPoPMiddleware creates the security middleware used by resource servers to authenticate
+// requests made with access tokens. Requests made with the "DPoP" authorization scheme must
+// include a valid DPoP proof for the access token signed with the key the token is bound to.
+// Requests made with the "Bearer" authorization scheme are only accepted if the token is not
+// bound to a key. The given validator validates the access tokens, the DPoP key thumbprint is
+// stored in the context given to the next handler, see ContextDPoPThumbprint.
+func NewDPoPMiddleware(d *DPoP, validate AccessTokenValidator) goa.Middleware {
+	return func(h goa.Handler) goa.Handler {
+		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+			scheme, token := splitAuthorization(req.Header.Get("Authorization"))
+			if token == "" || !strings.EqualFold(scheme, DPoPTokenType) && !strings.EqualFold(scheme, "Bearer") {
+				d.challenge(rw, "", "")
+				return ErrUnauthorized("missing access token")
+			}
+
+			// Verify proof
+			var proofJKT string
+			if strings.EqualFold(scheme, DPoPTokenType) {
+				var err error
+				if proofJKT, err = d.VerifyProof(req, token); err != nil {
+					e, ok := err.(Error)
+					if !ok {
+						return err
+					}
+					d.challenge(rw, string(e.Code()), e.Description())
+					return ErrUnauthorized(e.Description())
+				}
+			}
+
+			// Validate token and binding
+			ctx, jkt, err := validate(ctx, token)
+			if err != nil {
+				code := "invalid_token"
+				if se, ok := err.(goa.ServiceError); ok && se.ResponseStatus() == http.StatusForbidden {
+					code = "insufficient_scope"
+				}
+				d.challenge(rw, code, "")
+				return err
+			}
+			if jkt != proofJKT {
+				d.challenge(rw, "invalid_token", "access token is not bound to the DPoP proof key")
+				return ErrUnauthorized("access token is not bound to the DPoP proof key")
+			}
+			if jkt != "" {
+				ctx = WithDPoPThumbprint(ctx, jkt)
+			}
+			return h(ctx, rw, req)
+		}
+	}
+}
+
+// VerifyProof verifies the DPoP proof sent in the "DPoP" header of the given request as
+// described in https://tools.ietf.org/html/rfc9449#section-4.3 and returns the base64url
+// encoded JWK SHA-256 thumbprint of the proof key. accessToken is the access token the proof
+// must be bound to with the "ath" claim if any. The returned error implements Error, its code is
+// "use_dpop_nonce" if the proof does not include a valid nonce, "invalid_dpop_proof" otherwise.
+func (d *DPoP) VerifyProof(req *http.Request, accessToken string) (string, error) {
+	proofs := req.Header[http.CanonicalHeaderKey("DPoP")]
+	if len(proofs) != 1 {
+		return "", NewError(ErrInvalidDPoPProof, "request must include exactly one DPoP proof", "")
+	}
+
+	// Verify signature with the public key of the header
+	jws, err := jose.ParseSigned(proofs[0])
+	if err != nil || len(jws.Signatures) != 1 {
+		return "", NewError(ErrInvalidDPoPProof, "malformed DPoP proof", "")
+	}
+	h := jws.Signatures[0].Header
+	if typ, _ := h.ExtraHeaders[jose.HeaderType].(string); typ != "dpop+jwt" {
+		return "", NewError(ErrInvalidDPoPProof, `DPoP proof type must be "dpop+jwt"`, "")
+	}
+	if !d.acceptsAlgorithm(h.Algorithm) {
+		return "", NewError(ErrInvalidDPoPProof, fmt.Sprintf("unsupported DPoP proof algorithm %q", h.Algorithm), "")
+	}
+	if h.JSONWebKey == nil || !h.JSONWebKey.IsPublic() || !h.JSONWebKey.Valid() {
+		return "", NewError(ErrInvalidDPoPProof, "DPoP proof must include a public JWK", "")
+	}
+	payload, err := jws.Verify(h.JSONWebKey)
+	if err != nil {
+		return "", NewError(ErrInvalidDPoPProof, "invalid DPoP proof signature", "")
+	}
+	var claims dpopClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", NewError(ErrInvalidDPoPProof, "malformed DPoP proof claims", "")
+	}
+
+	// Validate claims
+	if claims.ID == "" {
+		return "", NewError(ErrInvalidDPoPProof, `DPoP proof must include a "jti" claim`, "")
+	}
+	if claims.Method != req.Method {
+		return "", NewError(ErrInvalidDPoPProof, "DPoP proof HTTP method does not match the request", "")
+	}
+	if !sameHTTPURI(claims.URI, d.requestURI(req)) {
+		return "", NewError(ErrInvalidDPoPProof, "DPoP proof HTTP URI does not match the request", "")
+	}
+	lifetime := d.ProofLifetime
+	if lifetime == 0 {
+		lifetime = DefaultDPoPProofLifetime
+	}
+	iat := time.Unix(claims.Issued, 0)
+	if now := d.now(); iat.Before(now.Add(-lifetime)) || iat.After(now.Add(lifetime)) {
+		return "", NewError(ErrInvalidDPoPProof, "DPoP proof is expired or issued in the future", "")
+	}
+	if accessToken != "" && claims.ATH != AccessTokenHash(accessToken) {
+		return "", NewError(ErrInvalidDPoPProof, "DPoP proof is not bound to the access token", "")
+	}
+	if accessToken == "" && claims.ATH != "" {
+		return "", NewError(ErrInvalidDPoPProof, `unexpected "ath" claim in DPoP proof`, "")
+	}
+	if d.Nonces != nil && (claims.Nonce == "" || !d.Nonces.Valid(claims.Nonce)) {
+		return "", NewError(ErrUseDPoPNonce, "DPoP proof must include a valid nonce", "")
+	}
+
+	// Compute key thumbprint and detect replays
+	jkt, err := h.JSONWebKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", NewError(ErrInvalidDPoPProof, "invalid DPoP proof key", "")
+	}
+	thumbprint := base64.RawURLEncoding.EncodeToString(jkt)
+	ok, err := d.replay.Use("dpop:"+thumbprint+":"+claims.ID, iat.Add(lifetime))
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", NewError(ErrInvalidDPoPProof, "DPoP proof has already been used", "")
+	}
+	return thumbprint, nil
+}
+
+// AccessTokenHash returns the value of the "ath" claim of the DPoP proofs sent with the given
+// access token: the base64url encoded SHA-256 hash of the token.
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// SetNonce sets the "DPoP-Nonce" header of the given response to a new nonce if nonces are
+// required.
+func (d *DPoP) SetNonce(rw http.ResponseWriter) error {
+	if d.Nonces == nil {
+		return nil
+	}
+	nonce, err := d.Nonces.Nonce()
+	if err != nil {
+		return err
+	}
+	rw.Header().Set("DPoP-Nonce", nonce)
+	return nil
+}
+
+// challenge sets the "WWW-Authenticate" header of the given response as described in
+// https://tools.ietf.org/html/rfc9449#section-7.1 and the "DPoP-Nonce" header if the error code
+// is "use_dpop_nonce".
+func (d *DPoP) challenge(rw http.ResponseWriter, code, description string) {
+	algs := d.Algorithms
+	if len(algs) == 0 {
+		algs = dpopAlgorithms
+	}
+	ch := fmt.Sprintf(`DPoP algs="%s"`, strings.Join(algs, " "))
+	if code != "" {
+		ch += fmt.Sprintf(`, error="%s"`, code)
+	}
+	if description != "" {
+		ch += fmt.Sprintf(`, error_description="%s"`, strings.Replace(description, `"`, "'", -1))
+	}
+	rw.Header().Set("WWW-Authenticate", ch)
+	if code == ErrUseDPoPNonce {
+		d.SetNonce(rw)
+	}
+}
+
+// acceptsAlgorithm returns true if the given JWS algorithm is accepted in proofs.
+func (d *DPoP) acceptsAlgorithm(alg string) bool {
+	algs := d.Algorithms
+	if len(algs) == 0 {
+		algs = dpopAlgorithms
+	}
+	for _, a := range algs {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// requestURI returns the URI of the given request without query and fragment.
+func (d *DPoP) requestURI(req *http.Request) string {
+	if d.BaseURL != "" {
+		return strings.TrimSuffix(d.BaseURL, "/") + req.URL.Path
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host + req.URL.Path
+}
+
+// sameHTTPURI returns true if the given HTTP URIs are equal once normalized and stripped of their
+// query and fragment, see https://tools.ietf.org/html/rfc9449#section-4.3
+func sameHTTPURI(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	normalize := func(u *url.URL) string {
+		scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+		if scheme == "https" {
+			host = strings.TrimSuffix(host, ":443")
+		} else if scheme == "http" {
+			host = strings.TrimSuffix(host, ":80")
+		}
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		return scheme + "://" + host + path
+	}
+	return normalize(ua) == normalize(ub)
+}
+
+// splitAuthorization splits the value of an "Authorization" header into its scheme and token.
+func splitAuthorization(h string) (string, string) {
+	i := strings.IndexByte(h, ' ')
+	if i < 0 {
+		return h, ""
+	}
+	return h[:i], strings.TrimSpace(h[i+1:])
+}
+
+// verifyDPoP verifies the DPoP proof of the token request of the given context if any and
+// returns the context with the proof key thumbprint, see ContextDPoPThumbprint. DPoP proofs are
+// ignored if DPoP is not enabled.
+func (c *ProviderController) verifyDPoP(ctx context.Context, rw http.ResponseWriter) (context.Context, error) {
+	r := goa.ContextRequest(ctx)
+	if c.dpop == nil || r == nil || len(r.Header[http.CanonicalHeaderKey("DPoP")]) == 0 {
+		return ctx, nil
+	}
+	jkt, err := c.dpop.VerifyProof(r.Request, "")
+	if err != nil {
+		if e, ok := err.(Error); ok && e.Code() == ErrUseDPoPNonce {
+			if err := c.dpop.SetNonce(rw); err != nil {
+				return ctx, err
+			}
+		}
+		return ctx, err
+	}
+	return WithDPoPThumbprint(ctx, jkt), nil
+}
+
+// boundJKT returns the thumbprint of the DPoP key the given access token is bound to if the
+// token request included a DPoP proof and the provider confirms that the token is bound to the
+// proof key, empty otherwise. The tokens are already issued when the binding is looked up so
+// failures are logged and the token is then reported as a bearer token.
+func (c *ProviderController) boundJKT(ctx context.Context, accessToken string) string {
+	jkt := ContextDPoPThumbprint(ctx)
+	binder, ok := c.provider.(DPoPBinder)
+	if jkt == "" || !ok {
+		return ""
+	}
+	bound, err := binder.AccessTokenJKT(ctx, accessToken)
+	if err != nil {
+		goa.LogError(ctx, "failed to retrieve access token DPoP binding", "err", err)
+		return ""
+	}
+	if bound != jkt {
+		return ""
+	}
+	return bound
+}
+
+// accessTokenType returns the token type of access tokens bound to the given DPoP key thumbprint.
+func accessTokenType(jkt string) string {
+	if jkt != "" {
+		return DPoPTokenType
+	}
+	return "Bearer"
+}
+
+// Nonce implements DPoPNonces.
+func (n *hmacDPoPNonces) Nonce() (string, error) {
+	b := make([]byte, 8, 8+16+sha256.Size)
+	binary.BigEndian.PutUint64(b, uint64(n.now().Unix()))
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	b = append(b, salt...)
+	return base64.RawURLEncoding.EncodeToString(append(b, n.mac(b)...)), nil
+}
+
+// Valid implements DPoPNonces.
+func (n *hmacDPoPNonces) Valid(nonce string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(b) != 8+16+sha256.Size {
+		return false
+	}
+	if !hmac.Equal(b[24:], n.mac(b[:24])) {
+		return false
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(b[:8])), 0)
+	return n.now().Before(issued.Add(n.lifetime))
+}
+
+// mac returns the HMAC-SHA256 of the given nonce content.
+func (n *hmacDPoPNonces) mac(b []byte) []byte {
+	m := hmac.New(sha256.New, n.key)
+	m.Write(b)
+	return m.Sum(nil)
+}
@@ -0,0 +1,224 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const testTokenURL = testIssuer + "/oauth2/token"
+
+// dpopBinder is a provider that binds the "bound" access token to the "jkt" key.
+type dpopBinder struct {
+	Provider
+}
+
+func (dpopBinder) AccessTokenJKT(ctx context.Context, accessToken string) (string, error) {
+	if accessToken == "bound" {
+		return "jkt", nil
+	}
+	return "", nil
+}
+
+// newProofSigner creates a signer that embeds its public key in the DPoP proofs it signs.
+func newProofSigner(t *testing.T) jose.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := (&jose.SignerOptions{EmbedJWK: true}).WithType("dpop+jwt")
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// signProof returns a DPoP proof for a POST request to the token endpoint signed with the given
+// signer, the given claims override the defaults.
+func signProof(t *testing.T, signer jose.Signer, claims map[string]interface{}) string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	c := map[string]interface{}{
+		"jti": base64.RawURLEncoding.EncodeToString(id),
+		"htm": "POST",
+		"htu": testTokenURL,
+		"iat": time.Now().Unix(),
+	}
+	for k, v := range claims {
+		c[k] = v
+	}
+	proof, err := jwt.Signed(signer).Claims(c).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+// proofRequest returns a token request that includes the given DPoP proof.
+func proofRequest(proof string) *http.Request {
+	req := httptest.NewRequest("POST", "/oauth2/token", nil)
+	req.Header.Set("DPoP", proof)
+	return req
+}
+
+// newTestDPoP creates a DPoP verifier for the test token endpoint.
+func newTestDPoP() *DPoP {
+	d := NewDPoP(NewMemoryReplayCache())
+	d.BaseURL = testIssuer
+	return d
+}
+
+func TestVerifyProof(t *testing.T) {
+	signer := newProofSigner(t)
+	cases := []struct {
+		Name        string
+		Claims      map[string]interface{}
+		AccessToken string
+		Code        ErrorCode
+	}{
+		{"valid", nil, "", ""},
+		{"wrong method", map[string]interface{}{"htm": "GET"}, "", ErrInvalidDPoPProof},
+		{"wrong uri", map[string]interface{}{"htu": "https://other.example.com/oauth2/token"}, "", ErrInvalidDPoPProof},
+		{"uri with query", map[string]interface{}{"htu": testTokenURL + "?foo=bar"}, "", ""},
+		{"missing jti", map[string]interface{}{"jti": ""}, "", ErrInvalidDPoPProof},
+		{"stale", map[string]interface{}{"iat": time.Now().Add(-time.Hour).Unix()}, "", ErrInvalidDPoPProof},
+		{"future", map[string]interface{}{"iat": time.Now().Add(time.Hour).Unix()}, "", ErrInvalidDPoPProof},
+		{"ath", map[string]interface{}{"ath": AccessTokenHash("token")}, "token", ""},
+		{"missing ath", nil, "token", ErrInvalidDPoPProof},
+		{"wrong ath", map[string]interface{}{"ath": AccessTokenHash("other")}, "token", ErrInvalidDPoPProof},
+		{"unexpected ath", map[string]interface{}{"ath": AccessTokenHash("token")}, "", ErrInvalidDPoPProof},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			jkt, err := newTestDPoP().VerifyProof(proofRequest(signProof(t, signer, tc.Claims)), tc.AccessToken)
+			if tc.Code == "" {
+				if err != nil || jkt == "" {
+					t.Errorf("got thumbprint %q and error %v, expected the proof to be valid", jkt, err)
+				}
+				return
+			}
+			if e, ok := err.(Error); !ok || e.Code() != tc.Code {
+				t.Errorf("got error %v, expected %q", err, tc.Code)
+			}
+		})
+	}
+}
+
+func TestVerifyProofUnsigned(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, (&jose.SignerOptions{}).WithType("dpop+jwt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestDPoP().VerifyProof(proofRequest(signProof(t, signer, nil)), ""); err == nil {
+		t.Error("got no error for a proof without a JWK")
+	}
+}
+
+func TestVerifyProofReplay(t *testing.T) {
+	var (
+		d      = newTestDPoP()
+		signer = newProofSigner(t)
+		proof  = signProof(t, signer, nil)
+	)
+	if _, err := d.VerifyProof(proofRequest(proof), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.VerifyProof(proofRequest(proof), ""); err == nil {
+		t.Error("got no error for a replayed proof")
+	}
+	if _, err := d.VerifyProof(proofRequest(signProof(t, signer, nil)), ""); err != nil {
+		t.Errorf("got error %v for a new proof signed with the same key", err)
+	}
+}
+
+func TestVerifyProofNonce(t *testing.T) {
+	var (
+		d      = newTestDPoP()
+		signer = newProofSigner(t)
+	)
+	d.Nonces = NewDPoPNonces([]byte("secret"), time.Minute)
+	nonce, err := d.Nonces.Nonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		Name   string
+		Claims map[string]interface{}
+		Code   ErrorCode
+	}{
+		{"valid", map[string]interface{}{"nonce": nonce}, ""},
+		{"missing", nil, ErrUseDPoPNonce},
+		{"forged", map[string]interface{}{"nonce": "forged"}, ErrUseDPoPNonce},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := d.VerifyProof(proofRequest(signProof(t, signer, tc.Claims)), "")
+			if tc.Code == "" {
+				if err != nil {
+					t.Errorf("got error %v, expected the proof to be valid", err)
+				}
+				return
+			}
+			if e, ok := err.(Error); !ok || e.Code() != tc.Code {
+				t.Errorf("got error %v, expected %q", err, tc.Code)
+			}
+		})
+	}
+
+	expired := NewDPoPNonces([]byte("secret"), time.Minute).(*hmacDPoPNonces)
+	expired.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	stale, err := expired.Nonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Nonces.Valid(stale) {
+		t.Error("got an expired nonce accepted")
+	}
+	if NewDPoPNonces([]byte("other"), time.Minute).Valid(nonce) {
+		t.Error("got a nonce accepted with another key")
+	}
+}
+
+func TestBoundJKT(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Provider    Provider
+		ProofJKT    string
+		AccessToken string
+		TokenType   string
+	}{
+		{"binder", dpopBinder{}, "jkt", "bound", DPoPTokenType},
+		{"bearer token", dpopBinder{}, "jkt", "unbound", "Bearer"},
+		{"other key", dpopBinder{}, "other", "bound", "Bearer"},
+		{"no proof", dpopBinder{}, "", "bound", "Bearer"},
+		{"not a binder", struct{ Provider }{}, "jkt", "bound", "Bearer"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := NewProviderController(newTestService(), tc.Provider, WithDPoP(newTestDPoP()))
+			ctx := context.Background()
+			if tc.ProofJKT != "" {
+				ctx = WithDPoPThumbprint(ctx, tc.ProofJKT)
+			}
+			if typ := accessTokenType(c.boundJKT(ctx, tc.AccessToken)); typ != tc.TokenType {
+				t.Errorf("got token type %q, expected %q", typ, tc.TokenType)
+			}
+		})
+	}
+}
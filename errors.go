@@ -67,12 +67,75 @@ const (
 	// ErrInvalidScope is the error returned when the requested scope is invalid, unknown,
 	// malformed, or exceeds the scope granted by the resource owner.
 	ErrInvalidScope = "invalid_scope"
+
+	// ErrAccessDenied is the error returned when the resource owner or authorization server
+	// denied the request.
+	ErrAccessDenied = "access_denied"
+
+	// ErrUnsupportedResponseType is the error returned when the authorization server does not
+	// support obtaining an authorization code or token using the requested response type.
+	ErrUnsupportedResponseType = "unsupported_response_type"
+
+	// ErrInvalidRequestURI is the error returned when the "request_uri" parameter of an
+	// authorization request is invalid or references an expired request, see
+	// https://tools.ietf.org/html/rfc9101#section-6.2
+	ErrInvalidRequestURI = "invalid_request_uri"
+
+	// ErrInvalidRequestObject is the error returned when the request object of an
+	// authorization request is invalid, see https://tools.ietf.org/html/rfc9101#section-6.2
+	ErrInvalidRequestObject = "invalid_request_object"
+
+	// ErrRequestNotSupported is the error returned when the authorization server does not
+	// support the "request" parameter.
+	ErrRequestNotSupported = "request_not_supported"
+
+	// ErrRequestURINotSupported is the error returned when the authorization server does not
+	// support the "request_uri" parameter.
+	ErrRequestURINotSupported = "request_uri_not_supported"
+
+	// ErrInvalidTarget is the error returned when the requested resource or audience of a token
+	// exchange request is invalid, unknown or malformed, see
+	// https://tools.ietf.org/html/rfc8693#section-2.2.2 It is also returned for invalid resource
+	// indicators, see https://tools.ietf.org/html/rfc8707#section-2
+	ErrInvalidTarget = "invalid_target"
+
+	// ErrInvalidAuthorizationDetails is the error returned when the "authorization_details"
+	// parameter of a request is malformed, contains an unknown type or does not conform to the
+	// schema of its type, see https://tools.ietf.org/html/rfc9396#section-5
+	ErrInvalidAuthorizationDetails = "invalid_authorization_details"
+
+	// ErrInvalidDPoPProof is the error returned when the DPoP proof of a request is invalid,
+	// see https://tools.ietf.org/html/rfc9449#section-5
+	ErrInvalidDPoPProof = "invalid_dpop_proof"
+
+	// ErrUseDPoPNonce is the error returned when the DPoP proof of a request does not include
+	// a valid nonce, see https://tools.ietf.org/html/rfc9449#section-8
+	ErrUseDPoPNonce = "use_dpop_nonce"
+
+	// ErrLoginRequired is the error returned when an authorization request made with the
+	// "none" prompt requires the resource owner to authenticate, see
+	// https://openid.net/specs/openid-connect-core-1_0.html#AuthError
+	ErrLoginRequired = "login_required"
+
+	// ErrConsentRequired is the error returned when an authorization request made with the
+	// "none" prompt requires the resource owner to consent.
+	ErrConsentRequired = "consent_required"
+
+	// ErrInteractionRequired is the error returned when an authorization request made with
+	// the "none" prompt requires the resource owner to interact with the authorization server
+	// for other reasons than authentication or consent.
+	ErrInteractionRequired = "interaction_required"
 )
 
 var (
 	// ErrUnauthorized is the error returned for unauthorized requests.
 	ErrUnauthorized = goa.NewErrorClass("unauthorized", 401)
 
+	// ErrInsufficientScope is the error returned for requests made with an access token that
+	// does not grant the scopes required by the action, see
+	// https://tools.ietf.org/html/rfc6750#section-3.1
+	ErrInsufficientScope = goa.NewErrorClass("insufficient_scope", 403)
+
 	// MissingClientID is the response returned upon receiving a Authorize request with no
 	// "client_id" query string.
 	MissingClientID = errorToMedia(NewError(ErrInvalidRequest, "missing client ID", ""))
@@ -82,8 +145,71 @@ var (
 	MissingCode = errorToMedia(NewError(ErrInvalidRequest, "missing authorization code", ""))
 
 	// BadResponseType is the response returned upon receiving a Authorize request with a
-	// response type set to something else than "code".
-	BadResponseType = errorToMedia(NewError(ErrInvalidGrant, `only "code" response type is supported`, ""))
+	// malformed response type or with a response type not supported by the controller.
+	BadResponseType = errorToMedia(NewError(ErrUnsupportedResponseType, "unsupported response type", ""))
+
+	// UnauthorizedResponseType is the response returned upon receiving a Authorize request
+	// with a response type that the client is not allowed to use.
+	UnauthorizedResponseType = errorToMedia(NewError(ErrUnauthorizedClient, "client is not allowed to use the response type", ""))
+
+	// InvalidTokenResponseMode is the response returned upon receiving a Authorize request
+	// that uses the "query" response mode or the "query.jwt" response mode without response
+	// encryption with a response type that includes tokens.
+	InvalidTokenResponseMode = errorToMedia(NewError(ErrInvalidRequest, "tokens cannot be sent in the query string", ""))
+
+	// MissingOpenIDScope is the response returned upon receiving a Authorize request with a
+	// response type that includes "id_token" and a scope that does not include "openid".
+	MissingOpenIDScope = errorToMedia(NewError(ErrInvalidScope, `ID tokens require the "openid" scope`, ""))
+
+	// MissingNonce is the response returned upon receiving a Authorize request with a response
+	// type that includes "id_token" and no nonce.
+	MissingNonce = errorToMedia(NewError(ErrInvalidRequest, `response type "id_token" requires a nonce`, ""))
+
+	// UnauthenticatedSubject is the response returned upon receiving a Authorize request with
+	// a response type that includes "id_token" when the request context has no subject.
+	UnauthenticatedSubject = errorToMedia(NewError(ErrAccessDenied, "resource owner is not authenticated", ""))
+
+	// InvalidPrompt is the response returned upon receiving a Authorize request with an
+	// unknown prompt value or with the "none" prompt combined with other values.
+	InvalidPrompt = errorToMedia(NewError(ErrInvalidRequest, `prompt must be "none" or a combination of "login", "consent" and "select_account"`, ""))
+
+	// InvalidMaxAge is the response returned upon receiving a Authorize request with a
+	// "max_age" parameter that is not a non-negative integer.
+	InvalidMaxAge = errorToMedia(NewError(ErrInvalidRequest, "max age must be a non-negative number of seconds", ""))
+
+	// InvalidIDTokenHint is the response returned upon receiving a request with an
+	// "id_token_hint" parameter that is not an ID token issued by the controller to the
+	// client.
+	InvalidIDTokenHint = errorToMedia(NewError(ErrInvalidRequest, "invalid ID token hint", ""))
+
+	// LoginRequired is the response returned upon receiving a Authorize request with the
+	// "none" prompt when the resource owner must authenticate.
+	LoginRequired = errorToMedia(NewError(ErrLoginRequired, "resource owner must authenticate", ""))
+
+	// ConsentRequired is the response returned upon receiving a Authorize request with the
+	// "none" prompt when the resource owner must consent.
+	ConsentRequired = errorToMedia(NewError(ErrConsentRequired, "resource owner must consent", ""))
+
+	// InteractionRequired is the response returned upon receiving a Authorize request with the
+	// "none" prompt when the resource owner must interact with the authorization server.
+	InteractionRequired = errorToMedia(NewError(ErrInteractionRequired, "resource owner must interact with the authorization server", ""))
+
+	// UnsupportedEndSession is the response returned upon receiving a EndSession request when
+	// the controller has no session manager.
+	UnsupportedEndSession = errorToMedia(NewError(ErrInvalidRequest, "logout is not supported", ""))
+
+	// LogoutClientMismatch is the response returned upon receiving a EndSession request with
+	// a "client_id" parameter that is not an audience of the ID token hint.
+	LogoutClientMismatch = errorToMedia(NewError(ErrInvalidRequest, `"client_id" does not match the ID token hint`, ""))
+
+	// MissingLogoutClient is the response returned upon receiving a EndSession request with a
+	// post logout redirect URI that does not identify the client with an ID token hint or a
+	// "client_id" parameter.
+	MissingLogoutClient = errorToMedia(NewError(ErrInvalidRequest, `post logout redirect URI requires "id_token_hint" or "client_id"`, ""))
+
+	// UnregisteredPostLogoutRedirect is the response returned upon receiving a EndSession
+	// request with a post logout redirect URI that is not registered for the client.
+	UnregisteredPostLogoutRedirect = errorToMedia(NewError(ErrInvalidRequest, "post logout redirect URI is not registered for the client", ""))
 
 	// MissingRedirect is the response returned upon receiving a Authorize request with no
 	// "redirect_uri" query string.
@@ -91,7 +217,107 @@ var (
 
 	// InvalidRedirect is the response returned upon receiving a Authorize request with a
 	// malformed redirect URI.
-	InvalidRedirect = errorToMedia(NewError(ErrInvalidRequest, "redirect URI must be a valid absolute URL", ""))
+	InvalidRedirect = errorToMedia(NewError(ErrInvalidRequest, "redirect URI must be a valid absolute URL or use a private-use URI scheme", ""))
+
+	// UnknownClient is the response returned upon receiving a Authorize request with a client
+	// identifier that is not in the client registry.
+	UnknownClient = errorToMedia(NewError(ErrInvalidClient, "unknown client", ""))
+
+	// UnregisteredRedirect is the response returned upon receiving a Authorize request with a
+	// redirect URI that does not match any of the URIs registered for the client.
+	UnregisteredRedirect = errorToMedia(NewError(ErrInvalidRequest, "redirect URI is not registered for the client", ""))
+
+	// InvalidResponseMode is the response returned upon receiving a Authorize request with an
+	// unsupported response mode. The JWT response modes are only supported if the controller
+	// has an issuer and signing keys.
+	InvalidResponseMode = errorToMedia(NewError(ErrInvalidRequest, "unsupported response mode", ""))
+
+	// InvalidCodeChallenge is the response returned upon receiving a Authorize request with a
+	// malformed PKCE code challenge or with a code challenge method but no code challenge.
+	InvalidCodeChallenge = errorToMedia(NewError(ErrInvalidRequest, "code challenge must be 43 to 128 unreserved characters", ""))
+
+	// InvalidCodeChallengeMethod is the response returned upon receiving a Authorize request
+	// with an unsupported PKCE code challenge method.
+	InvalidCodeChallengeMethod = errorToMedia(NewError(ErrInvalidRequest, `code challenge method must be "plain" or "S256"`, ""))
+
+	// MissingCodeChallenge is the response returned upon receiving a Authorize request with no
+	// PKCE code challenge from a native app.
+	MissingCodeChallenge = errorToMedia(NewError(ErrInvalidRequest, "native apps must use PKCE", ""))
+
+	// UnsupportedPKCE is the response returned upon receiving a Authorize request with a PKCE
+	// code challenge when the provider does not implement both RequestAuthorizer and
+	// RequestExchanger.
+	UnsupportedPKCE = errorToMedia(NewError(ErrInvalidRequest, "PKCE is not supported", ""))
+
+	// InvalidRequestURI is the response returned upon receiving a Authorize request with a
+	// "request_uri" parameter that does not reference a valid pushed authorization request
+	// made by the client.
+	InvalidRequestURI = errorToMedia(NewError(ErrInvalidRequestURI, "invalid or expired request URI", ""))
+
+	// MixedPushedRequest is the response returned upon receiving a Authorize request with a
+	// "request_uri" parameter and parameters other than "client_id".
+	MixedPushedRequest = errorToMedia(NewError(ErrInvalidRequest, `"request_uri" cannot be combined with parameters other than "client_id"`, ""))
+
+	// PushedRequestRequired is the response returned upon receiving a Authorize request that
+	// does not use a pushed authorization request from a client that must use them.
+	PushedRequestRequired = errorToMedia(NewError(ErrInvalidRequest, "client must use pushed authorization requests", ""))
+
+	// RequestObjectNotSupported is the response returned upon receiving a Authorize request
+	// with a request object when request objects are not enabled.
+	RequestObjectNotSupported = errorToMedia(NewError(ErrRequestNotSupported, "request objects are not supported", ""))
+
+	// RequestURINotSupported is the response returned upon receiving a Authorize request with
+	// a request object passed by reference when the controller has no request object fetcher.
+	RequestURINotSupported = errorToMedia(NewError(ErrRequestURINotSupported, "request objects passed by reference are not supported", ""))
+
+	// MixedRequestObject is the response returned upon receiving a Authorize request with both
+	// a "request" and a "request_uri" parameter.
+	MixedRequestObject = errorToMedia(NewError(ErrInvalidRequest, `"request" and "request_uri" cannot be used together`, ""))
+
+	// InvalidRequestObject is the response returned upon receiving a Authorize request with a
+	// request object that cannot be decrypted or verified or that has invalid claims.
+	InvalidRequestObject = errorToMedia(NewError(ErrInvalidRequestObject, "invalid request object", ""))
+
+	// RequestObjectRequired is the response returned upon receiving a Authorize request that
+	// does not use a signed request object from a client that must use them.
+	RequestObjectRequired = errorToMedia(NewError(ErrInvalidRequest, "client must use signed request objects", ""))
+
+	// UnsupportedPushedRequests is the response returned upon receiving a
+	// PushAuthorizationRequest request when pushed authorization requests are not enabled.
+	UnsupportedPushedRequests = errorToMedia(NewError(ErrInvalidRequest, "pushed authorization requests are not supported", ""))
+
+	// UnsupportedIntrospection is the response returned upon receiving a Introspect request
+	// when the provider does not implement TokenIntrospector.
+	UnsupportedIntrospection = errorToMedia(NewError(ErrInvalidRequest, "token introspection is not supported", ""))
+
+	// MissingIntrospectedToken is the response returned upon receiving a Introspect request
+	// with no "token" value.
+	MissingIntrospectedToken = errorToMedia(NewError(ErrInvalidRequest, `token introspection requires a "token" value`, ""))
+
+	// PushedClientMismatch is the response returned upon receiving a PushAuthorizationRequest
+	// request with a "client_id" parameter that does not match the authenticated client.
+	PushedClientMismatch = errorToMedia(NewError(ErrInvalidRequest, `"client_id" does not match the authenticated client`, ""))
+
+	// PushedRequestURI is the response returned upon receiving a PushAuthorizationRequest
+	// request with a "request_uri" parameter.
+	PushedRequestURI = errorToMedia(NewError(ErrInvalidRequest, `pushed authorization requests cannot include "request_uri"`, ""))
+
+	// UnsupportedAuthorizationDetails is the response returned upon receiving a Authorize
+	// request with authorization details when the provider cannot bind them to the
+	// authorization code.
+	UnsupportedAuthorizationDetails = errorToMedia(NewError(ErrInvalidAuthorizationDetails, "authorization details are not supported by the provider", ""))
+
+	// UnsupportedTokenAuthorizationDetails is the response returned upon receiving a GetToken
+	// request with authorization details for a grant that cannot take them into account.
+	UnsupportedTokenAuthorizationDetails = errorToMedia(NewError(ErrInvalidAuthorizationDetails, "authorization details are not supported for this token request", ""))
+
+	// UnsupportedResources is the response returned upon receiving a Authorize request with
+	// resource indicators when the provider cannot bind them to the authorization code.
+	UnsupportedResources = errorToMedia(NewError(ErrInvalidTarget, "resource indicators are not supported by the provider", ""))
+
+	// UnsupportedTokenResources is the response returned upon receiving a GetToken request
+	// with resource indicators when the provider cannot take them into account.
+	UnsupportedTokenResources = errorToMedia(NewError(ErrInvalidTarget, "resource indicators are not supported for this token request", ""))
 
 	// MalformedBody is the response returned upon receiving a GetToken request with a malformed
 	// (non x-www-form-urlencoded) body.
@@ -99,11 +325,35 @@ var (
 
 	// InvalidGrantType is the response returned upon receiving a GetToken request with an
 	// invalid grant_type form value.
-	InvalidGrantType = errorToMedia(NewError(ErrInvalidGrant, `invalid grant type, must be "authorization_code" or "refresh_token"`, ""))
+	InvalidGrantType = errorToMedia(NewError(ErrInvalidGrant, `invalid grant type, must be "authorization_code", "refresh_token" or "`+TokenExchangeGrantType+`"`, ""))
 
 	// MissingRefreshToken is the response returned upon receiving a GetToken request with
 	// grant type "refresh_token" and no refresh token.
 	MissingRefreshToken = errorToMedia(NewError(ErrInvalidGrant, `grant type "refresh_token" requires a "refresh_token" value`, ""))
+
+	// MalformedScope is the response returned upon receiving a GetToken request with a scope
+	// that contains invalid characters.
+	MalformedScope = errorToMedia(NewError(ErrInvalidScope, "malformed scope", ""))
+
+	// UnsupportedTokenExchange is the response returned upon receiving a GetToken request with
+	// the token exchange grant type when the provider does not implement TokenExchanger.
+	UnsupportedTokenExchange = errorToMedia(NewError(ErrUnsupportedGrantType, "token exchange is not supported", ""))
+
+	// MissingSubjectToken is the response returned upon receiving a token exchange request with
+	// no subject token.
+	MissingSubjectToken = errorToMedia(NewError(ErrInvalidRequest, `token exchange requires a "subject_token" value`, ""))
+
+	// MissingSubjectTokenType is the response returned upon receiving a token exchange request
+	// with no subject token type.
+	MissingSubjectTokenType = errorToMedia(NewError(ErrInvalidRequest, `token exchange requires a "subject_token_type" value`, ""))
+
+	// MissingActorTokenType is the response returned upon receiving a token exchange request
+	// with an actor token but no actor token type.
+	MissingActorTokenType = errorToMedia(NewError(ErrInvalidRequest, `"actor_token" requires a "actor_token_type" value`, ""))
+
+	// MissingActorToken is the response returned upon receiving a token exchange request with
+	// an actor token type but no actor token.
+	MissingActorToken = errorToMedia(NewError(ErrInvalidRequest, `"actor_token_type" must not be set without "actor_token"`, ""))
 )
 
 // NewError creates an error suitable to be returned in the body of OAuth2 error responses.
@@ -0,0 +1,161 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	_ "crypto/sha256" // Register the hash functions used by TokenHash
+	_ "crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// DefaultIDTokenLifetime is the lifetime of the ID tokens issued by the controller unless
+// configured otherwise with WithIDTokenLifetime.
+const DefaultIDTokenLifetime = 10 * time.Minute
+
+type (
+	// ImplicitAuthorizer is the interface implemented by providers that support response types
+	// that do not include "code" or that include "token", see
+	// https://tools.ietf.org/html/rfc6749#section-4.2 and
+	// https://openid.net/specs/openid-connect-core-1_0.html#HybridFlowAuth
+	ImplicitAuthorizer interface {
+		// AuthorizeImplicit validates the authorization request like
+		// RequestAuthorizer.AuthorizeRequest. If the request response type includes
+		// "token" it returns an access token and an optional expiration deadline in
+		// seconds. Access tokens issued by the authorization endpoint must not come with
+		// a refresh token. Upon failure the error should implement Error otherwise a
+		// generic error response is sent back to the client.
+		AuthorizeImplicit(ctx context.Context, req *AuthorizationRequest) (accessToken string, expiresIn int, err error)
+	}
+
+	// Authentication describes the authentication of the resource owner that granted an
+	// authorization code. The controller uses it to issue the ID token returned by the token
+	// endpoint when the code was granted the "openid" scope, see
+	// https://openid.net/specs/openid-connect-core-1_0.html#TokenResponse
+	Authentication struct {
+		// Subject is the identifier of the resource owner.
+		Subject string
+		// Nonce is the OpenID Connect nonce of the authorization request if any.
+		Nonce string
+		// AuthTime is the time when the resource owner authenticated, the zero time if
+		// unknown. It is required when the authorization request included "max_age".
+		AuthTime time.Time
+		// ACR is the authentication context class reference satisfied by the
+		// authentication if any.
+		ACR string
+		// SessionID is the identifier of the session of the resource owner with the
+		// authorization server if any.
+		SessionID string
+	}
+
+	// idTokenClaims are the claims of the ID tokens issued by the authorization endpoint, see
+	// https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+	idTokenClaims struct {
+		jwt.Claims
+		Nonce           string           `json:"nonce,omitempty"`
+		AccessTokenHash string           `json:"at_hash,omitempty"`
+		CodeHash        string           `json:"c_hash,omitempty"`
+		AuthTime        *jwt.NumericDate `json:"auth_time,omitempty"`
+		ACR             string           `json:"acr,omitempty"`
+		SessionID       string           `json:"sid,omitempty"`
+	}
+)
+
+// WithIssuer configures the issuer identifier of the controller. The issuer must be a https URL
+// with no query or fragment, it is used as the "iss" claim of the ID tokens and as the "iss"
+// parameter of the authorization responses that lets clients detect mix-up attacks as described
+// in https://tools.ietf.org/html/rfc9207. It is also required to serve the authorization server
+// metadata, see Metadata.
+func WithIssuer(issuer string) ProviderOption {
+	return func(c *ProviderController) {
+		c.issuer = issuer
+	}
+}
+
+// WithIDTokenLifetime configures the lifetime of the ID tokens issued by the controller.
+func WithIDTokenLifetime(d time.Duration) ProviderOption {
+	return func(c *ProviderController) {
+		c.idTokenLifetime = d
+	}
+}
+
+// TokenHash computes the value of the "at_hash" and "c_hash" ID token claims for the given
+// access token or authorization code: the base64url encoding of the left-most half of the hash
+// of the value. The hash function is the one used by the given JWS algorithm, see
+// https://openid.net/specs/openid-connect-core-1_0.html#HybridIDToken
+func TokenHash(alg, value string) (string, error) {
+	var h crypto.Hash
+	switch {
+	case alg == "EdDSA" || strings.HasSuffix(alg, "512"):
+		h = crypto.SHA512
+	case strings.HasSuffix(alg, "384"):
+		h = crypto.SHA384
+	case strings.HasSuffix(alg, "256"):
+		h = crypto.SHA256
+	default:
+		return "", fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	hh := h.New()
+	hh.Write([]byte(value))
+	sum := hh.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+// idToken issues an ID token for the given authorization request. The token includes the hashes
+// of the authorization code and access token issued alongside it if any as well as the time and
+// class of the resource owner authentication if known.
+func (c *ProviderController) idToken(r *AuthorizationRequest, code, accessToken string) (string, error) {
+	var (
+		now    = time.Now()
+		alg    = c.keys.Algorithm()
+		claims = idTokenClaims{
+			Claims: jwt.Claims{
+				Issuer:   c.issuer,
+				Subject:  r.Subject,
+				Audience: jwt.Audience{r.ClientID},
+				IssuedAt: jwt.NewNumericDate(now),
+				Expiry:   jwt.NewNumericDate(now.Add(c.idTokenLifetime)),
+			},
+			Nonce:     r.Nonce,
+			ACR:       r.ACR,
+			SessionID: r.SessionID,
+		}
+		err error
+	)
+	if !r.AuthTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(r.AuthTime)
+	}
+	if code != "" {
+		if claims.CodeHash, err = TokenHash(alg, code); err != nil {
+			return "", err
+		}
+	}
+	if accessToken != "" {
+		if claims.AccessTokenHash, err = TokenHash(alg, accessToken); err != nil {
+			return "", err
+		}
+	}
+	return c.keys.sign(claims)
+}
+
+// idTokenHint verifies that the given ID token was issued by the controller and returns its
+// claims. The token may have expired as allowed for the "id_token_hint" parameter, see
+// https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest
+func (c *ProviderController) idTokenHint(hint string) (*idTokenClaims, error) {
+	if !c.signsJWTs() {
+		return nil, errors.New("ID tokens are not supported")
+	}
+	var claims idTokenClaims
+	if err := verifyJWT(hint, c.keys.PublicKeys(), &claims); err != nil {
+		return nil, err
+	}
+	if claims.Issuer != c.issuer || claims.Subject == "" {
+		return nil, errors.New("ID token was not issued by the controller")
+	}
+	return &claims, nil
+}
@@ -0,0 +1,103 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goadesign/goa"
+)
+
+const testRedirectURI = "https://client.example.com/cb"
+
+// grantIssuer is a stateless code provider that issues the "access" access token.
+type grantIssuer struct {
+	Provider
+}
+
+func (grantIssuer) AuthorizeGrant(ctx context.Context, req *AuthorizationRequest) (string, error) {
+	return req.Scope, nil
+}
+
+func (grantIssuer) IssueGrant(ctx context.Context, g *CodeGrant) (string, string, int, error) {
+	return "", "access", 3600, nil
+}
+
+// newIDTokenController creates a controller that issues ID tokens and stateless codes.
+func newIDTokenController(t *testing.T) *ProviderController {
+	return NewProviderController(newTestService(), grantIssuer{},
+		WithStatelessCodes(newTestCodes(t)),
+		WithIssuer(testIssuer),
+		WithSigningKeys(newTestSigningKeys(t)))
+}
+
+// exchangeTestCode redeems a stateless code created for the given grant on behalf of the
+// "client" client and returns the decoded token response.
+func exchangeTestCode(t *testing.T, c *ProviderController, g *CodeGrant) map[string]interface{} {
+	g.ClientID, g.RedirectURI = "client", testRedirectURI
+	code, err := c.codes.create(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		rw          = httptest.NewRecorder()
+		req         = httptest.NewRequest("POST", "/oauth2/token", nil)
+		ctx         = goa.NewContext(WithClientID(context.Background(), "client"), rw, req, nil)
+		redirectURI = testRedirectURI
+	)
+	if err := c.exchange(ctx, rw, &code, &redirectURI, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rw.Code != http.StatusOK {
+		t.Fatalf("got status %d and body %s", rw.Code, rw.Body)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestExchangeIDToken(t *testing.T) {
+	c := newIDTokenController(t)
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	body := exchangeTestCode(t, c, &CodeGrant{
+		Scope:     "openid profile",
+		Subject:   "alice",
+		Nonce:     "nonce",
+		AuthTime:  authTime,
+		ACR:       "urn:mace:incommon:iap:silver",
+		SessionID: "sid",
+	})
+	idToken, _ := body["id_token"].(string)
+	if idToken == "" {
+		t.Fatalf("got body %v, expected an ID token", body)
+	}
+	var claims idTokenClaims
+	if err := verifyJWT(idToken, c.keys.PublicKeys(), &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != testIssuer || claims.Subject != "alice" || !claims.Audience.Contains("client") {
+		t.Errorf("got claims %+v, expected the issuer, subject and client", claims)
+	}
+	if claims.Nonce != "nonce" || claims.SessionID != "sid" {
+		t.Errorf("got nonce %q and session %q, expected the ones of the authorization request", claims.Nonce, claims.SessionID)
+	}
+	if claims.AuthTime == nil || !claims.AuthTime.Time().Equal(authTime) || claims.ACR != "urn:mace:incommon:iap:silver" {
+		t.Errorf("got auth_time %v and acr %q, expected the authentication of the authorization request", claims.AuthTime, claims.ACR)
+	}
+	if hash, _ := TokenHash("ES256", "access"); claims.AccessTokenHash != hash || claims.CodeHash != "" {
+		t.Errorf("got at_hash %q and c_hash %q, expected %q and none", claims.AccessTokenHash, claims.CodeHash, hash)
+	}
+
+	if body := exchangeTestCode(t, c, &CodeGrant{Scope: "profile", Subject: "alice"}); body["id_token"] != nil {
+		t.Errorf("got body %v, expected no ID token without the openid scope", body)
+	}
+	c.keys = nil
+	if body := exchangeTestCode(t, c, &CodeGrant{Scope: "openid", Subject: "alice"}); body["id_token"] != nil {
+		t.Errorf("got body %v, expected no ID token without signing keys", body)
+	}
+}
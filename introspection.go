@@ -0,0 +1,125 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/goadesign/oauth2/app"
+)
+
+type (
+	// TokenIntrospector is the interface optionally implemented by providers that can describe
+	// the tokens they issue. When the provider implements it the controller implements the
+	// token introspection endpoint described in https://tools.ietf.org/html/rfc7662, see
+	// ProviderController.Introspect.
+	TokenIntrospector interface {
+		// IntrospectToken implements https://tools.ietf.org/html/rfc7662#section-2.1
+		// It describes the given access or refresh token, tokenTypeHint is the value of
+		// the "token_type_hint" parameter if any. It should return nil or an inactive
+		// description if the token is unknown, expired or revoked or if the
+		// authenticated client (see ContextClientID) may not introspect it. Upon failure
+		// the error should implement Error otherwise a generic error HTTP response is
+		// sent back to the client.
+		IntrospectToken(ctx context.Context, token, tokenTypeHint string) (*TokenIntrospection, error)
+	}
+
+	// TokenIntrospection describes a token, see
+	// https://tools.ietf.org/html/rfc7662#section-2.2
+	TokenIntrospection struct {
+		// Active is true if the token is currently active, the other fields are ignored
+		// otherwise.
+		Active bool
+		// Scope is the scope granted to the token.
+		Scope string
+		// ClientID is the identifier of the client the token was issued to.
+		ClientID string
+		// Subject is the identifier of the resource owner if any.
+		Subject string
+		// TokenType is the type of the token, e.g. "Bearer", if known.
+		TokenType string
+		// ExpiresAt is the token expiration time, the token never expires if zero.
+		ExpiresAt time.Time
+		// IssuedAt is the time the token was issued if known.
+		IssuedAt time.Time
+		// Audience lists the audience of the token if any.
+		Audience []string
+		// Confirmation contains the thumbprint of the DPoP key the token is bound to if
+		// any.
+		Confirmation *Confirmation
+		// AuthorizationDetails contains the authorization details granted to the token if
+		// any, see https://tools.ietf.org/html/rfc9396#section-9.2
+		AuthorizationDetails []AuthorizationDetail
+	}
+)
+
+// Introspect implements the token introspection endpoint described in
+// https://tools.ietf.org/html/rfc7662#section-2, see IntrospectionEndpoint in the design package.
+// The caller must be authenticated with NewOAuth2ClientBasicAuthMiddleware and the provider must
+// implement TokenIntrospector. The response includes the controller issuer identifier if
+// configured, see WithIssuer.
+func (c *ProviderController) Introspect(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	// Ensure introspection is supported
+	introspector, ok := c.provider.(TokenIntrospector)
+	if !ok {
+		return c.Service.Send(ctx, http.StatusBadRequest, UnsupportedIntrospection)
+	}
+
+	// Ensure there is a client identifier
+	if ContextClientID(ctx) == "" {
+		return c.Service.Send(ctx, http.StatusBadRequest, MissingClientID)
+	}
+
+	// Read request parameters
+	if err := req.ParseForm(); err != nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, MalformedBody)
+	}
+	token := req.PostForm.Get("token")
+	if token == "" {
+		return c.Service.Send(ctx, http.StatusBadRequest, MissingIntrospectedToken)
+	}
+
+	// Describe token
+	ti, err := introspector.IntrospectToken(ctx, token, req.PostForm.Get("token_type_hint"))
+	if err != nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	if ti == nil || !ti.Active {
+		return c.Service.Send(ctx, http.StatusOK, &app.IntrospectionMedia{Active: false})
+	}
+	return c.Service.Send(ctx, http.StatusOK, c.introspectionMedia(ti))
+}
+
+// introspectionMedia converts the given token description.
+func (c *ProviderController) introspectionMedia(ti *TokenIntrospection) *app.IntrospectionMedia {
+	m := &app.IntrospectionMedia{
+		Active:               true,
+		Aud:                  ti.Audience,
+		AuthorizationDetails: detailsMedia(ti.AuthorizationDetails),
+	}
+	optional := func(v string) *string {
+		if v == "" {
+			return nil
+		}
+		return &v
+	}
+	m.Scope = optional(ti.Scope)
+	m.ClientID = optional(ti.ClientID)
+	m.Sub = optional(ti.Subject)
+	m.TokenType = optional(ti.TokenType)
+	m.Iss = optional(c.issuer)
+	if ti.Confirmation != nil && ti.Confirmation.JKT != "" {
+		m.Cnf = map[string]string{"jkt": ti.Confirmation.JKT}
+	}
+	if !ti.ExpiresAt.IsZero() {
+		exp := int(ti.ExpiresAt.Unix())
+		m.Exp = &exp
+	}
+	if !ti.IssuedAt.IsZero() {
+		iat := int(ti.IssuedAt.Unix())
+		m.Iat = &iat
+	}
+	return m
+}
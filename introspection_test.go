@@ -0,0 +1,90 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goadesign/goa"
+)
+
+// introspectionProvider is a provider that only describes the "valid" token.
+type introspectionProvider struct {
+	Provider
+}
+
+func (introspectionProvider) IntrospectToken(ctx context.Context, token, tokenTypeHint string) (*TokenIntrospection, error) {
+	if token != "valid" {
+		return nil, nil
+	}
+	return &TokenIntrospection{
+		Active:               true,
+		Scope:                "api:read",
+		ClientID:             "client",
+		TokenType:            "Bearer",
+		ExpiresAt:            time.Unix(1700000000, 0),
+		AuthorizationDetails: []AuthorizationDetail{{"type": "account_information"}},
+	}, nil
+}
+
+// newTestService creates a service that encodes responses in JSON.
+func newTestService() *goa.Service {
+	service := goa.New("test")
+	service.Encoder.Register(goa.NewJSONEncoder, "application/json", "*/*")
+	return service
+}
+
+// introspect sends a token introspection request for the given token on behalf of the given
+// client and returns the response status and decoded body.
+func introspect(t *testing.T, c *ProviderController, clientID, token string) (int, map[string]interface{}) {
+	var (
+		rw  = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/oauth2/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ctx := goa.NewContext(WithClientID(context.Background(), clientID), rw, req, nil)
+	if err := c.Introspect(ctx, rw, req); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return rw.Code, body
+}
+
+func TestIntrospect(t *testing.T) {
+	c := NewProviderController(newTestService(), introspectionProvider{}, WithIssuer(testIssuer))
+
+	code, body := introspect(t, c, "rs", "valid")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d, expected %d", code, http.StatusOK)
+	}
+	if body["active"] != true || body["client_id"] != "client" || body["scope"] != "api:read" || body["iss"] != testIssuer || body["exp"] != float64(1700000000) {
+		t.Errorf("got introspection response %v", body)
+	}
+	if details, _ := body["authorization_details"].([]interface{}); len(details) != 1 {
+		t.Errorf("got authorization details %v, expected one entry", body["authorization_details"])
+	}
+
+	code, body = introspect(t, c, "rs", "unknown")
+	if code != http.StatusOK || len(body) != 1 || body["active"] != false {
+		t.Errorf("got status %d and body %v for an unknown token, expected an inactive response", code, body)
+	}
+
+	if code, _ = introspect(t, c, "", "valid"); code != http.StatusBadRequest {
+		t.Errorf("got status %d for an unauthenticated request, expected %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestIntrospectUnsupported(t *testing.T) {
+	c := NewProviderController(newTestService(), struct{ Provider }{})
+	if code, body := introspect(t, c, "rs", "valid"); code != http.StatusBadRequest || body["error"] != "invalid_request" {
+		t.Errorf("got status %d and body %v, expected an invalid_request error", code, body)
+	}
+}
@@ -0,0 +1,110 @@
+package oauth2
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// SigningKeys holds the private keys used by the controller to sign the JWTs it issues such as
+// ID tokens. The first key is used to sign new tokens, the other keys are only published so
+// that relying parties can still verify the tokens signed before a key rotation.
+type SigningKeys struct {
+	lock sync.RWMutex
+	keys []jose.JSONWebKey
+}
+
+// NewSigningKeys creates a key set with the given private keys. Each key must have a key ID and
+// a signing algorithm, the first key is used to sign new tokens.
+func NewSigningKeys(keys ...jose.JSONWebKey) (*SigningKeys, error) {
+	s := &SigningKeys{}
+	if err := s.SetKeys(keys...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// WithSigningKeys configures the controller to sign the JWTs it issues with the given keys.
+// Issuing ID tokens also requires an issuer, see WithIssuer.
+func WithSigningKeys(keys *SigningKeys) ProviderOption {
+	return func(c *ProviderController) {
+		c.keys = keys
+	}
+}
+
+// signsJWTs returns true if the controller is configured to issue signed JWTs such as ID tokens
+// which requires both an issuer and signing keys.
+func (c *ProviderController) signsJWTs() bool {
+	return c.issuer != "" && c.keys != nil
+}
+
+// SetKeys replaces the keys, the first key is used to sign new tokens. Use SetKeys to rotate
+// keys without restarting the controller.
+func (s *SigningKeys) SetKeys(keys ...jose.JSONWebKey) error {
+	if len(keys) == 0 {
+		return errors.New("at least one signing key is required")
+	}
+	for _, k := range keys {
+		if k.KeyID == "" {
+			return errors.New("signing keys must have a key ID")
+		}
+		if k.Algorithm == "" {
+			return fmt.Errorf("signing key %q has no algorithm", k.KeyID)
+		}
+		if k.IsPublic() || !k.Valid() {
+			return fmt.Errorf("signing key %q is not a valid private key", k.KeyID)
+		}
+	}
+	ks := make([]jose.JSONWebKey, len(keys))
+	copy(ks, keys)
+	s.lock.Lock()
+	s.keys = ks
+	s.lock.Unlock()
+	return nil
+}
+
+// PublicKeys returns the public keys, it is suitable to be served as the JWK set document of
+// the provider.
+func (s *SigningKeys) PublicKeys() *jose.JSONWebKeySet {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	set := &jose.JSONWebKeySet{Keys: make([]jose.JSONWebKey, len(s.keys))}
+	for i, k := range s.keys {
+		set.Keys[i] = k.Public()
+	}
+	return set
+}
+
+// Algorithm returns the algorithm of the key used to sign new tokens.
+func (s *SigningKeys) Algorithm() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.keys[0].Algorithm
+}
+
+// sign returns a compact JWS containing the given claims signed with the current key.
+func (s *SigningKeys) sign(claims ...interface{}) (string, error) {
+	return s.signWithType("JWT", claims...)
+}
+
+// signWithType returns a compact JWS containing the given claims signed with the current key and
+// the given "typ" header.
+func (s *SigningKeys) signWithType(typ string, claims ...interface{}) (string, error) {
+	s.lock.RLock()
+	key := s.keys[0]
+	s.lock.RUnlock()
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key},
+		(&jose.SignerOptions{}).WithType(jose.ContentType(typ)))
+	if err != nil {
+		return "", err
+	}
+	b := jwt.Signed(signer)
+	for _, c := range claims {
+		b = b.Claims(c)
+	}
+	return b.CompactSerialize()
+}
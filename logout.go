@@ -0,0 +1,276 @@
+package oauth2
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// frontChannelLogoutTimeout is the maximum time the logout page waits for the front-channel logout
+// URIs of the clients to load before redirecting to the post logout redirect URI.
+const frontChannelLogoutTimeout = 5 * time.Second
+
+type (
+	// SessionManager is the interface implemented by services to end the authenticated
+	// sessions of resource owners with the authorization server, see WithSessionManager.
+	SessionManager interface {
+		// EndSession logs out the resource owner of the given logout request, typically
+		// by deleting the session and clearing the session cookie, and returns true. It
+		// may instead send a response that asks the resource owner to confirm, e.g. when
+		// the request has no ID token hint, and return false. The confirmation should
+		// complete by sending the user agent back to the end session endpoint with the
+		// original parameters.
+		EndSession(ctx context.Context, rw http.ResponseWriter, req *http.Request, l *LogoutRequest) (bool, error)
+	}
+
+	// LogoutRequest contains the validated parameters of a logout request, see
+	// https://openid.net/specs/openid-connect-rpinitiated-1_0.html#RPLogout
+	LogoutRequest struct {
+		// ClientID is the identifier of the client that initiated the logout as given by
+		// the ID token hint or the "client_id" parameter if any.
+		ClientID string
+		// Subject is the subject of the ID token hint if any. The session of the resource
+		// owner should only be ended if it belongs to the subject.
+		Subject string
+		// LogoutHint is the hint about the resource owner that is logging out if any.
+		LogoutHint string
+		// PostLogoutRedirectURI is the validated URI where the user agent is redirected
+		// after logout if any.
+		PostLogoutRedirectURI string
+		// SessionID is the identifier of the session being ended as set in the request
+		// context with WithSessionID if any. The "sid" claim of the ID token hint never
+		// selects another session.
+		SessionID string
+		// State is the opaque value used by the client to maintain state between the
+		// logout request and the redirect.
+		State string
+		// UILocales lists the preferred languages of the resource owner for the user
+		// interface if any, as BCP47 language tags.
+		UILocales []string
+	}
+)
+
+// loggedOutTemplate is the template of the HTML page returned after logout when the request has
+// no post logout redirect URI or when clients must be notified through the front-channel. The
+// page renders the front-channel logout URIs in hidden iframes and redirects to the post logout
+// redirect URI if any once they are loaded.
+var loggedOutTemplate = template.Must(template.New("logged_out").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Signed Out</title>
+{{- if .RedirectURI }}
+<script>
+var pending = {{ len .FrontChannelURIs }};
+function done() { window.location.replace({{ .RedirectURI }}); }
+function loaded() { if (--pending === 0) { done(); } }
+setTimeout(done, {{ .Timeout }});
+</script>
+{{- end }}
+</head>
+<body>
+<p>You have been signed out.</p>
+{{- range .FrontChannelURIs }}
+<iframe src="{{ . }}" style="display:none"{{ if $.RedirectURI }} onload="loaded()"{{ end }}></iframe>
+{{- end }}
+{{- if .RedirectURI }}
+<p><a href="{{ .RedirectURI }}">Continue</a></p>
+{{- end }}
+</body>
+</html>
+`))
+
+// WithSessionManager enables the end session endpoint described in
+// https://openid.net/specs/openid-connect-rpinitiated-1_0.html with the given session manager,
+// see EndSession. The clients that take part in the session are notified of the logout if a
+// session store is configured, see WithSessionStore.
+func WithSessionManager(m SessionManager) ProviderOption {
+	return func(c *ProviderController) {
+		c.sessions = m
+	}
+}
+
+// EndSession implements the end session endpoint described in
+// https://openid.net/specs/openid-connect-rpinitiated-1_0.html#RPLogout The parameters may be
+// sent in the query string or in a form encoded body. The "id_token_hint" parameter must be an ID
+// token issued by the controller, it identifies the client together with the "client_id"
+// parameter. The "post_logout_redirect_uri" parameter requires the client to be identified and
+// must match one of the URIs registered for the client exactly. Once the session manager ends the
+// session the user agent is redirected to the post logout redirect URI with the "state"
+// parameter if any, a page confirming the logout is returned otherwise. If a session store is
+// configured the clients that take part in the session identified by the request context are
+// then notified: logout tokens are sent to their back-channel logout URIs in the background and
+// their front-channel logout URIs are rendered in iframes by the logout page, see
+// https://openid.net/specs/openid-connect-backchannel-1_0.html and
+// https://openid.net/specs/openid-connect-frontchannel-1_0.html
+func (c *ProviderController) EndSession(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	// Ensure logout is enabled
+	if c.sessions == nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, UnsupportedEndSession)
+	}
+
+	// Read request parameters
+	if err := req.ParseForm(); err != nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, MalformedBody)
+	}
+	var (
+		params = req.Form
+		l      = &LogoutRequest{
+			ClientID:   params.Get("client_id"),
+			LogoutHint: params.Get("logout_hint"),
+			SessionID:  ContextSessionID(ctx),
+			State:      params.Get("state"),
+			UILocales:  strings.Fields(params.Get("ui_locales")),
+		}
+	)
+
+	// Validate ID token hint
+	if hint := params.Get("id_token_hint"); hint != "" {
+		claims, err := c.idTokenHint(hint)
+		if err != nil {
+			return c.Service.Send(ctx, http.StatusBadRequest, InvalidIDTokenHint)
+		}
+		switch {
+		case l.ClientID != "" && !claims.Audience.Contains(l.ClientID):
+			return c.Service.Send(ctx, http.StatusBadRequest, LogoutClientMismatch)
+		case l.ClientID == "" && len(claims.Audience) == 1:
+			l.ClientID = claims.Audience[0]
+		}
+		l.Subject = claims.Subject
+	}
+
+	// Validate post logout redirect URI
+	if uri := params.Get("post_logout_redirect_uri"); uri != "" {
+		if l.ClientID == "" {
+			return c.Service.Send(ctx, http.StatusBadRequest, MissingLogoutClient)
+		}
+		if c.clients == nil {
+			return c.Service.Send(ctx, http.StatusBadRequest, UnregisteredPostLogoutRedirect)
+		}
+		client, err := c.clients.Client(ctx, l.ClientID)
+		if err == ErrClientNotFound {
+			return c.Service.Send(ctx, http.StatusBadRequest, UnknownClient)
+		}
+		if err != nil {
+			return err
+		}
+		if !client.MatchPostLogoutRedirectURI(uri) {
+			return c.Service.Send(ctx, http.StatusBadRequest, UnregisteredPostLogoutRedirect)
+		}
+		l.PostLogoutRedirectURI = uri
+	}
+
+	// End session
+	ended, err := c.sessions.EndSession(ctx, rw, req, l)
+	if err != nil || !ended {
+		return err
+	}
+
+	// Notify the clients of the session
+	frontChannel, err := c.logoutClients(ctx, l)
+	if err != nil {
+		return err
+	}
+
+	return c.loggedOut(ctx, rw, l, frontChannel)
+}
+
+// logoutClients notifies the clients that take part in the session of the given logout request
+// that the session ended. It sends the logout tokens of the clients that registered a back-channel
+// logout URI in the background and returns the front-channel logout URIs of the clients that
+// registered one. Failed deliveries of logout tokens are logged and do not fail the logout.
+func (c *ProviderController) logoutClients(ctx context.Context, l *LogoutRequest) ([]string, error) {
+	if c.sessionStore == nil || c.clients == nil || l.SessionID == "" {
+		return nil, nil
+	}
+	clientIDs, err := c.sessionStore.SessionClients(ctx, l.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		subject      = l.Subject
+		frontChannel []string
+		backChannel  = make(map[*Client]string)
+	)
+	if subject == "" {
+		subject = ContextSubject(ctx)
+	}
+	for _, id := range clientIDs {
+		client, err := c.clients.Client(ctx, id)
+		if err == ErrClientNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if client.FrontchannelLogoutURI != "" {
+			uri, err := c.frontChannelLogoutURI(client, l.SessionID)
+			if err != nil {
+				return nil, err
+			}
+			frontChannel = append(frontChannel, uri)
+		}
+		if client.BackchannelLogoutURI == "" || c.logoutSender == nil || !c.signsJWTs() {
+			continue
+		}
+		if backChannel[client], err = c.logoutToken(client, l.SessionID, subject); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.sessionStore.DeleteSession(ctx, l.SessionID); err != nil {
+		return nil, err
+	}
+	c.sendLogoutTokens(ctx, backChannel)
+	return frontChannel, nil
+}
+
+// frontChannelLogoutURI returns the front-channel logout URI of the given client for the given
+// session. It includes the "iss" and "sid" query parameters if the client requires them, see
+// https://openid.net/specs/openid-connect-frontchannel-1_0.html#RPLogout
+func (c *ProviderController) frontChannelLogoutURI(client *Client, sid string) (string, error) {
+	if !client.FrontchannelLogoutSessionRequired || c.issuer == "" {
+		return client.FrontchannelLogoutURI, nil
+	}
+	u, err := url.Parse(client.FrontchannelLogoutURI)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("iss", c.issuer)
+	q.Set("sid", sid)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// loggedOut sends the response of a successful logout request: a redirect to the post logout
+// redirect URI if any and there are no front-channel logout URIs to render, a page confirming the
+// logout that renders the front-channel logout URIs otherwise.
+func (c *ProviderController) loggedOut(ctx context.Context, rw http.ResponseWriter, l *LogoutRequest, frontChannel []string) error {
+	var redirectURI string
+	if l.PostLogoutRedirectURI != "" {
+		dest, err := url.Parse(l.PostLogoutRedirectURI)
+		if err != nil {
+			return err
+		}
+		if l.State != "" {
+			q := dest.Query()
+			q.Set("state", l.State)
+			dest.RawQuery = q.Encode()
+		}
+		redirectURI = dest.String()
+	}
+	if redirectURI != "" && len(frontChannel) == 0 {
+		rw.Header().Set("Location", redirectURI)
+		return c.Service.Send(ctx, http.StatusFound, nil)
+	}
+	rw.Header().Set("Content-Type", "text/html;charset=UTF-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusOK)
+
+	return loggedOutTemplate.Execute(rw, struct {
+		FrontChannelURIs []string
+		RedirectURI      string
+		Timeout          int64
+	}{frontChannel, redirectURI, int64(frontChannelLogoutTimeout / time.Millisecond)})
+}
@@ -0,0 +1,203 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goadesign/goa"
+	"github.com/goadesign/oauth2/app"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// sessionEnder is a session manager that always ends the session.
+type sessionEnder struct{}
+
+func (sessionEnder) EndSession(ctx context.Context, rw http.ResponseWriter, req *http.Request, l *LogoutRequest) (bool, error) {
+	return true, nil
+}
+
+// newLogoutController creates a controller that sends logout tokens to the given back-channel
+// logout URI of the "client" client which takes part in the "sid" session.
+func newLogoutController(t *testing.T, sender LogoutTokenSender, uri string) (*ProviderController, SessionStore) {
+	sessions := NewMemorySessionStore()
+	if err := sessions.AddSessionClient(context.Background(), "sid", "client", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	c := NewProviderController(newTestService(), struct{ Provider }{},
+		WithClientRegistry(NewMemoryClientRegistry(&Client{ID: "client", BackchannelLogoutURI: uri})),
+		WithIssuer(testIssuer),
+		WithSigningKeys(newTestSigningKeys(t)),
+		WithSessionManager(sessionEnder{}),
+		WithSessionStore(sessions, 0),
+		WithBackChannelLogout(sender))
+	return c, sessions
+}
+
+// logout sends a logout request with the given parameters in the given context and returns the
+// response.
+func logout(t *testing.T, c *ProviderController, ctx context.Context, params url.Values) *httptest.ResponseRecorder {
+	var (
+		rw  = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/oauth2/logout?"+params.Encode(), nil)
+	)
+	if err := c.EndSession(goa.NewContext(ctx, rw, req, nil), rw, req); err != nil {
+		t.Fatal(err)
+	}
+	return rw
+}
+
+// endSession sends a logout request with the given parameters in the given context and checks
+// that it succeeds.
+func endSession(t *testing.T, c *ProviderController, ctx context.Context, params url.Values) {
+	if rw := logout(t, c, ctx, params); rw.Code != http.StatusOK {
+		t.Fatalf("got status %d, expected %d", rw.Code, http.StatusOK)
+	}
+}
+
+func TestBackChannelLogoutIsAsynchronous(t *testing.T) {
+	var (
+		release  = make(chan struct{})
+		received = make(chan string, 1)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+		received <- req.PostFormValue("logout_token")
+	}))
+	defer srv.Close()
+	defer close(release)
+	c, _ := newLogoutController(t, NewHTTPLogoutTokenSender(srv.Client(), 0, 0), srv.URL)
+
+	ctx, cancel := context.WithCancel(WithSessionID(context.Background(), "sid"))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		endSession(t, c, ctx, nil)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logout blocked on the back-channel logout delivery")
+	}
+
+	cancel()
+	release <- struct{}{}
+	select {
+	case token := <-received:
+		parsed, err := jwt.ParseSigned(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var claims logoutTokenClaims
+		if err := parsed.UnsafeClaimsWithoutVerification(&claims); err != nil {
+			t.Fatal(err)
+		}
+		if claims.SessionID != "sid" || !claims.Audience.Contains("client") {
+			t.Errorf("got logout token claims %+v", claims)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("logout token not delivered once the request completed")
+	}
+}
+
+func TestBackChannelLogoutSessionID(t *testing.T) {
+	sender := LogoutTokenSenderFunc(func(ctx context.Context, uri, token string) error { return nil })
+	hint := func(c *ProviderController, sid string) url.Values {
+		idToken, err := c.idToken(&AuthorizationRequest{ClientID: "client", Subject: "alice", SessionID: sid}, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return url.Values{"id_token_hint": {idToken}}
+	}
+
+	c, sessions := newLogoutController(t, sender, "https://client.example.com/logout")
+	endSession(t, c, context.Background(), hint(c, "sid"))
+	if clients, _ := sessions.SessionClients(context.Background(), "sid"); len(clients) != 1 {
+		t.Error("got the session of the ID token hint ended without a session in the request context")
+	}
+
+	c, sessions = newLogoutController(t, sender, "https://client.example.com/logout")
+	endSession(t, c, WithSessionID(context.Background(), "sid"), hint(c, "sid"))
+	if clients, _ := sessions.SessionClients(context.Background(), "sid"); len(clients) != 0 {
+		t.Errorf("got session clients %v, expected the session to be ended", clients)
+	}
+}
+
+func TestHTTPLogoutTokenSender(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	if err := NewHTTPLogoutTokenSender(srv.Client(), 1, time.Millisecond).SendLogoutToken(context.Background(), srv.URL, "token"); err != nil {
+		t.Errorf("got error %v, expected the retry to succeed", err)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 2 {
+		t.Errorf("got %d calls, expected 2", calls)
+	}
+	atomic.StoreInt32(&calls, 0)
+	if err := NewHTTPLogoutTokenSender(srv.Client(), 0, 0).SendLogoutToken(context.Background(), srv.URL, "token"); err == nil {
+		t.Error("got no error without retries")
+	}
+
+	s := NewHTTPLogoutTokenSender(nil, DefaultLogoutRetries, 0).(*httpLogoutTokenSender)
+	if s.client.Timeout != DefaultLogoutRequestTimeout {
+		t.Errorf("got default client timeout %v, expected %v", s.client.Timeout, DefaultLogoutRequestTimeout)
+	}
+}
+
+func TestEndSessionValidation(t *testing.T) {
+	const loggedOut = "https://client.example.com/logged-out?app=1"
+	c := NewProviderController(newTestService(), struct{ Provider }{},
+		WithClientRegistry(NewMemoryClientRegistry(
+			&Client{ID: "client", PostLogoutRedirectURIs: []string{loggedOut}},
+			&Client{ID: "other"})),
+		WithIssuer(testIssuer),
+		WithSigningKeys(newTestSigningKeys(t)),
+		WithSessionManager(sessionEnder{}))
+	hint, err := c.idToken(&AuthorizationRequest{ClientID: "client", Subject: "alice"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		Name     string
+		Params   url.Values
+		Error    *app.OAuth2ErrorMedia
+		Location string
+	}{
+		{"invalid hint", url.Values{"id_token_hint": {"invalid"}}, InvalidIDTokenHint, ""},
+		{"hint audience mismatch", url.Values{"id_token_hint": {hint}, "client_id": {"other"}}, LogoutClientMismatch, ""},
+		{"redirect without client", url.Values{"post_logout_redirect_uri": {loggedOut}}, MissingLogoutClient, ""},
+		{"redirect of unknown client", url.Values{"post_logout_redirect_uri": {loggedOut}, "client_id": {"unknown"}}, UnknownClient, ""},
+		{"unregistered redirect", url.Values{"post_logout_redirect_uri": {"https://attacker.example.com"}, "id_token_hint": {hint}}, UnregisteredPostLogoutRedirect, ""},
+		{"redirect of other client", url.Values{"post_logout_redirect_uri": {loggedOut}, "client_id": {"other"}}, UnregisteredPostLogoutRedirect, ""},
+		{"redirect with client", url.Values{"post_logout_redirect_uri": {loggedOut}, "client_id": {"client"}}, nil, loggedOut},
+		{"redirect with hint", url.Values{"post_logout_redirect_uri": {loggedOut}, "id_token_hint": {hint}, "state": {"a b"}}, nil, loggedOut + "&state=a+b"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rw := logout(t, c, context.Background(), tc.Params)
+			if tc.Error != nil {
+				var body app.OAuth2ErrorMedia
+				if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if rw.Code != http.StatusBadRequest || body.Error != tc.Error.Error || *body.ErrorDescription != *tc.Error.ErrorDescription {
+					t.Errorf("got status %d and body %s, expected %q", rw.Code, rw.Body, *tc.Error.ErrorDescription)
+				}
+				return
+			}
+			if rw.Code != http.StatusFound || rw.Header().Get("Location") != tc.Location {
+				t.Errorf("got status %d and location %q, expected a redirect to %q", rw.Code, rw.Header().Get("Location"), tc.Location)
+			}
+		})
+	}
+}
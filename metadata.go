@@ -0,0 +1,253 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// MetadataPath is the request path of the authorization server metadata document described in
+// https://tools.ietf.org/html/rfc8414#section-3 for issuers with no path component.
+const MetadataPath = "/.well-known/oauth-authorization-server"
+
+// OpenIDConfigurationPath is the request path of the OpenID Connect discovery document described
+// in https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfig
+const OpenIDConfigurationPath = "/.well-known/openid-configuration"
+
+// responseTypes lists the response types advertised in the metadata if supported.
+var responseTypes = []string{
+	"code",
+	"token",
+	"id_token",
+	"code token",
+	"code id_token",
+	"id_token token",
+	"code id_token token",
+}
+
+// idTokenClaimNames lists the claims of the ID tokens issued by the controller.
+var idTokenClaimNames = []string{"iss", "sub", "aud", "exp", "iat", "nonce", "at_hash", "c_hash", "auth_time", "acr", "sid"}
+
+type (
+	// Endpoints lists the locations of the endpoints advertised in the authorization server
+	// metadata. Each location is either an absolute URL or a request path relative to the
+	// issuer host such as the paths given to the OAuth2 DSL. Empty locations are omitted.
+	Endpoints struct {
+		// Authorization is the location of the authorization endpoint.
+		Authorization string
+		// Token is the location of the token endpoint.
+		Token string
+		// PushedAuthorization is the location of the pushed authorization request
+		// endpoint.
+		PushedAuthorization string
+		// JWKS is the location of the JWK set document that contains the public signing
+		// keys, see SigningKeys.PublicKeys.
+		JWKS string
+		// UserInfo is the location of the OpenID Connect userinfo endpoint implemented by
+		// the service, see
+		// https://openid.net/specs/openid-connect-core-1_0.html#UserInfo
+		UserInfo string
+		// EndSession is the location of the end session endpoint, see
+		// ProviderController.EndSession.
+		EndSession string
+		// Introspection is the location of the token introspection endpoint, see
+		// ProviderController.Introspect.
+		Introspection string
+	}
+
+	// Metadata is the authorization server metadata document described in
+	// https://tools.ietf.org/html/rfc8414#section-2 It doubles as the OpenID Connect discovery
+	// document described in
+	// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata, the OpenID
+	// Connect specific fields are only set if the controller issues ID tokens.
+	Metadata struct {
+		Issuer                                     string   `json:"issuer"`
+		AuthorizationEndpoint                      string   `json:"authorization_endpoint,omitempty"`
+		TokenEndpoint                              string   `json:"token_endpoint,omitempty"`
+		PushedAuthorizationRequestEndpoint         string   `json:"pushed_authorization_request_endpoint,omitempty"`
+		JWKSURI                                    string   `json:"jwks_uri,omitempty"`
+		UserInfoEndpoint                           string   `json:"userinfo_endpoint,omitempty"`
+		EndSessionEndpoint                         string   `json:"end_session_endpoint,omitempty"`
+		IntrospectionEndpoint                      string   `json:"introspection_endpoint,omitempty"`
+		IntrospectionEndpointAuthMethodsSupported  []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+		ScopesSupported                            []string `json:"scopes_supported,omitempty"`
+		ResponseTypesSupported                     []string `json:"response_types_supported"`
+		ResponseModesSupported                     []string `json:"response_modes_supported,omitempty"`
+		GrantTypesSupported                        []string `json:"grant_types_supported,omitempty"`
+		TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+		CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported,omitempty"`
+		RequestParameterSupported                  bool     `json:"request_parameter_supported"`
+		RequestURIParameterSupported               bool     `json:"request_uri_parameter_supported"`
+		RequireRequestURIRegistration              bool     `json:"require_request_uri_registration,omitempty"`
+		AuthorizationSigningAlgValuesSupported     []string `json:"authorization_signing_alg_values_supported,omitempty"`
+		AuthorizationDetailsTypesSupported         []string `json:"authorization_details_types_supported,omitempty"`
+		DPoPSigningAlgValuesSupported              []string `json:"dpop_signing_alg_values_supported,omitempty"`
+		AuthorizationResponseIssParameterSupported bool     `json:"authorization_response_iss_parameter_supported"`
+		SubjectTypesSupported                      []string `json:"subject_types_supported,omitempty"`
+		IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported,omitempty"`
+		ClaimsSupported                            []string `json:"claims_supported,omitempty"`
+		PromptValuesSupported                      []string `json:"prompt_values_supported,omitempty"`
+		BackchannelLogoutSupported                 bool     `json:"backchannel_logout_supported,omitempty"`
+		BackchannelLogoutSessionSupported          bool     `json:"backchannel_logout_session_supported,omitempty"`
+		FrontchannelLogoutSupported                bool     `json:"frontchannel_logout_supported,omitempty"`
+		FrontchannelLogoutSessionSupported         bool     `json:"frontchannel_logout_session_supported,omitempty"`
+	}
+)
+
+// WithEndpoints configures the locations of the endpoints advertised in the authorization server
+// metadata, see Metadata.
+func WithEndpoints(e Endpoints) ProviderOption {
+	return func(c *ProviderController) {
+		c.endpoints = e
+	}
+}
+
+// WithSupportedClaims configures the claims about the resource owner that the userinfo endpoint
+// may return, e.g. "name" or "email". They are advertised in the OpenID Connect discovery
+// document together with the claims of the ID tokens.
+func WithSupportedClaims(claims ...string) ProviderOption {
+	return func(c *ProviderController) {
+		c.claims = claims
+	}
+}
+
+// Metadata returns the authorization server metadata. The document is computed from the
+// controller configuration so that it always reflects the enabled features. The scopes come from
+// the scope registry which may be generated from the scopes declared in the OAuth2 DSL, see
+// WithScopeRegistry. Metadata requires an issuer, see WithIssuer.
+func (c *ProviderController) Metadata() (*Metadata, error) {
+	if c.issuer == "" {
+		return nil, errors.New("authorization server metadata requires an issuer")
+	}
+	base, err := url.Parse(c.issuer)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := func(location string) string {
+		if location == "" {
+			return ""
+		}
+		u, err := url.Parse(location)
+		if err != nil {
+			return location
+		}
+		return base.ResolveReference(u).String()
+	}
+	m := &Metadata{
+		Issuer:                            c.issuer,
+		AuthorizationEndpoint:             endpoint(c.endpoints.Authorization),
+		TokenEndpoint:                     endpoint(c.endpoints.Token),
+		JWKSURI:                           endpoint(c.endpoints.JWKS),
+		ResponseModesSupported:            []string{ResponseModeQuery, ResponseModeFragment, ResponseModeFormPost},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic"},
+		RequestParameterSupported:         c.requestObjects && c.clients != nil && c.issuer != "",
+		RequestURIParameterSupported:      c.requestObjects && c.clients != nil && c.issuer != "" && c.fetcher != nil,
+		AuthorizationResponseIssParameterSupported: true,
+	}
+	m.RequireRequestURIRegistration = m.RequestURIParameterSupported
+	if c.pushed != nil {
+		m.PushedAuthorizationRequestEndpoint = endpoint(c.endpoints.PushedAuthorization)
+	}
+	if _, ok := c.provider.(TokenIntrospector); ok && c.endpoints.Introspection != "" {
+		m.IntrospectionEndpoint = endpoint(c.endpoints.Introspection)
+		m.IntrospectionEndpointAuthMethodsSupported = []string{"client_secret_basic"}
+	}
+	if c.sessions != nil {
+		m.EndSessionEndpoint = endpoint(c.endpoints.EndSession)
+		if c.sessionStore != nil && c.clients != nil {
+			m.FrontchannelLogoutSupported = true
+			m.FrontchannelLogoutSessionSupported = c.issuer != ""
+			m.BackchannelLogoutSupported = c.logoutSender != nil && c.signsJWTs()
+			m.BackchannelLogoutSessionSupported = m.BackchannelLogoutSupported
+		}
+	}
+	if c.scopes != nil {
+		m.ScopesSupported = c.scopes.Names()
+	}
+	for _, t := range responseTypes {
+		rt, _ := parseResponseType(t)
+		if rt.hasTokens() && c.clients == nil || !c.supportsResponseType(rt) {
+			continue
+		}
+		m.ResponseTypesSupported = append(m.ResponseTypesSupported, t)
+	}
+	if c.signsJWTs() {
+		m.ResponseModesSupported = append(m.ResponseModesSupported,
+			ResponseModeQueryJWT, ResponseModeFragmentJWT, ResponseModeFormPostJWT, ResponseModeJWT)
+		m.AuthorizationSigningAlgValuesSupported = []string{c.keys.Algorithm()}
+	}
+	if _, ok := c.provider.(ImplicitAuthorizer); ok && c.clients != nil {
+		m.GrantTypesSupported = append(m.GrantTypesSupported, "implicit")
+	}
+	if _, ok := c.provider.(TokenExchanger); ok {
+		m.GrantTypesSupported = append(m.GrantTypesSupported, TokenExchangeGrantType)
+	}
+	if c.supportsPKCE() {
+		m.CodeChallengeMethodsSupported = []string{PKCEMethodPlain, PKCEMethodS256}
+	}
+	if c.detailTypes != nil {
+		m.AuthorizationDetailsTypesSupported = c.detailTypes.Names()
+	}
+	if c.dpop != nil {
+		m.DPoPSigningAlgValuesSupported = c.dpop.Algorithms
+		if len(m.DPoPSigningAlgValuesSupported) == 0 {
+			m.DPoPSigningAlgValuesSupported = dpopAlgorithms
+		}
+	}
+	if c.signsJWTs() {
+		m.UserInfoEndpoint = endpoint(c.endpoints.UserInfo)
+		m.SubjectTypesSupported = []string{"public"}
+		m.IDTokenSigningAlgValuesSupported = []string{c.keys.Algorithm()}
+		m.ClaimsSupported = append(append([]string{}, idTokenClaimNames...), c.claims...)
+		m.PromptValuesSupported = []string{PromptNone, PromptLogin, PromptConsent, PromptSelectAccount}
+		if c.scopes == nil {
+			m.ScopesSupported = []string{"openid"}
+		}
+	}
+	return m, nil
+}
+
+// OpenIDConfiguration returns the OpenID Connect discovery document. It is the authorization
+// server metadata returned by Metadata and requires the controller to issue ID tokens, see
+// WithIssuer and WithSigningKeys. The location of the JWK set document is required by OpenID
+// Connect discovery and must be configured with WithEndpoints.
+func (c *ProviderController) OpenIDConfiguration() (*Metadata, error) {
+	if !c.signsJWTs() {
+		return nil, errors.New("OpenID Connect discovery requires an issuer and signing keys")
+	}
+	if c.endpoints.JWKS == "" {
+		return nil, errors.New("OpenID Connect discovery requires the location of the JWK set document")
+	}
+	return c.Metadata()
+}
+
+// GetMetadata implements the authorization server metadata endpoint described in
+// https://tools.ietf.org/html/rfc8414#section-3, see AuthorizationServerMetadata in the design
+// package.
+func (c *ProviderController) GetMetadata(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	m, err := c.Metadata()
+	if err != nil {
+		return err
+	}
+	return c.sendMetadata(ctx, rw, m)
+}
+
+// GetOpenIDConfiguration implements the OpenID Connect discovery endpoint described in
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfig, see
+// OpenIDConfiguration in the design package.
+func (c *ProviderController) GetOpenIDConfiguration(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	m, err := c.OpenIDConfiguration()
+	if err != nil {
+		return err
+	}
+	return c.sendMetadata(ctx, rw, m)
+}
+
+// sendMetadata writes the given metadata document.
+func (c *ProviderController) sendMetadata(ctx context.Context, rw http.ResponseWriter, m *Metadata) error {
+	rw.Header().Set("Content-Type", "application/json")
+
+	return c.Service.Send(ctx, http.StatusOK, m)
+}
@@ -0,0 +1,42 @@
+package oauth2
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// newTestSigningKeys creates a key set with a single ES256 key.
+func newTestSigningKeys(t *testing.T) *SigningKeys {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewSigningKeys(jose.JSONWebKey{Key: key, KeyID: "key", Algorithm: string(jose.ES256), Use: "sig"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestOpenIDConfigurationRequiresJWKS(t *testing.T) {
+	keys := newTestSigningKeys(t)
+	c := NewProviderController(newTestService(), struct{ Provider }{}, WithIssuer(testIssuer), WithSigningKeys(keys),
+		WithEndpoints(Endpoints{Authorization: "/oauth2/authorize", Token: "/oauth2/token"}))
+	if _, err := c.OpenIDConfiguration(); err == nil {
+		t.Error("got no error without a JWK set location")
+	}
+
+	c = NewProviderController(newTestService(), struct{ Provider }{}, WithIssuer(testIssuer), WithSigningKeys(keys),
+		WithEndpoints(Endpoints{Authorization: "/oauth2/authorize", Token: "/oauth2/token", JWKS: "/oauth2/jwks"}))
+	m, err := c.OpenIDConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.JWKSURI != testIssuer+"/oauth2/jwks" {
+		t.Errorf("got jwks_uri %q, expected %q", m.JWKSURI, testIssuer+"/oauth2/jwks")
+	}
+}
@@ -0,0 +1,66 @@
+package oauth2
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// Code challenge methods defined by https://tools.ietf.org/html/rfc7636#section-4.2
+const (
+	// PKCEMethodPlain indicates that the code challenge is the code verifier.
+	PKCEMethodPlain = "plain"
+
+	// PKCEMethodS256 indicates that the code challenge is the base64url encoding of the
+	// SHA256 hash of the code verifier.
+	PKCEMethodS256 = "S256"
+)
+
+// VerifyCodeChallenge returns true if the given code verifier matches the given code challenge
+// computed with the given method as described in
+// https://tools.ietf.org/html/rfc7636#section-4.6. The method defaults to PKCEMethodPlain if
+// empty.
+func VerifyCodeChallenge(challenge, method, verifier string) bool {
+	if !validPKCEValue(verifier) {
+		return false
+	}
+	computed := verifier
+	switch method {
+	case "", PKCEMethodPlain:
+	case PKCEMethodS256:
+		h := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(h[:])
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// CheckCodeVerifier returns true if the code verifier sent with an access token request is
+// consistent with the code challenge the authorization code is bound to: the verifier must match
+// the challenge if there is one and must be empty otherwise as required by
+// https://datatracker.ietf.org/doc/html/rfc9700#section-2.1.1 so that an attacker cannot
+// redeem a code injected without a challenge.
+func CheckCodeVerifier(challenge, method, verifier string) bool {
+	if challenge == "" {
+		return verifier == ""
+	}
+	return VerifyCodeChallenge(challenge, method, verifier)
+}
+
+// validPKCEValue returns true if the given code verifier or challenge is made of 43 to 128
+// unreserved characters as required by https://tools.ietf.org/html/rfc7636#section-4.1
+func validPKCEValue(v string) bool {
+	if len(v) < 43 || len(v) > 128 {
+		return false
+	}
+	for _, c := range v {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,210 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goadesign/oauth2/app"
+)
+
+// Prompt values defined by https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest
+const (
+	// PromptNone requires the authorization server not to display any user interface. The
+	// request fails with a "login_required", "consent_required" or "interaction_required"
+	// error if the resource owner would have to interact.
+	PromptNone = "none"
+
+	// PromptLogin requires the resource owner to authenticate again.
+	PromptLogin = "login"
+
+	// PromptConsent requires the resource owner to consent before the authorization server
+	// returns information to the client.
+	PromptConsent = "consent"
+
+	// PromptSelectAccount requires the resource owner to select one of their accounts.
+	PromptSelectAccount = "select_account"
+)
+
+type (
+	// InteractionRequirer is the interface optionally implemented by providers that decide
+	// when the resource owner must interact with the authorization server beyond
+	// authentication, e.g. to consent to the requested scope. The controller itself requires
+	// a login when the request context has no subject, when the authentication is older than
+	// the requested maximum age or when the subject does not match the ID token hint.
+	InteractionRequirer interface {
+		// RequiredInteraction returns the interaction the resource owner must complete
+		// before the given request of an authenticated resource owner may be authorized:
+		// PromptLogin, PromptConsent, PromptSelectAccount or any other non-empty value for
+		// other interactions. It returns an empty string if no interaction is required.
+		RequiredInteraction(ctx context.Context, req *AuthorizationRequest) (string, error)
+	}
+
+	// InteractionHandler is called by Authorize when an authorization request requires the
+	// resource owner to interact with the authorization server, see WithInteractionHandler.
+	// It returns true if the interaction already took place and the request may proceed,
+	// e.g. when the user agent comes back from the login page. Otherwise it sends the
+	// response that starts the interaction such as a redirect to the login page and returns
+	// false. The interaction should complete by sending the user agent back to the
+	// authorization endpoint with the original request parameters.
+	InteractionHandler func(ctx context.Context, rw http.ResponseWriter, req *http.Request, i *Interaction) (bool, error)
+
+	// Interaction describes the interactions required by an authorization request.
+	Interaction struct {
+		// Prompts lists the required interactions in the order they should take place,
+		// e.g. PromptLogin followed by PromptConsent.
+		Prompts []string
+		// Request is the validated authorization request. It includes the login hint,
+		// the ID token hint subject, the UI locales and the ACR values requested by the
+		// client if any.
+		Request *AuthorizationRequest
+	}
+)
+
+// WithInteractionHandler configures the controller to delegate to the given handler the
+// authorization requests that require the resource owner to log in, consent or select an
+// account, either because the client asked for it with the "prompt" and "max_age" parameters or
+// because the controller or the provider require it, see InteractionRequirer. Without a handler
+// the service is responsible for authenticating the resource owner before the requests reach the
+// controller, the requests that require an interaction fail with a "login_required",
+// "consent_required" or "interaction_required" error.
+func WithInteractionHandler(h InteractionHandler) ProviderOption {
+	return func(c *ProviderController) {
+		c.interaction = h
+	}
+}
+
+// validateAuthentication validates the OpenID Connect authentication request parameters
+// described in https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest and records
+// them in the given request.
+func (c *ProviderController) validateAuthentication(params url.Values, r *AuthorizationRequest) *app.OAuth2ErrorMedia {
+	prompt := strings.Fields(params.Get("prompt"))
+	for _, p := range prompt {
+		switch p {
+		case PromptLogin, PromptConsent, PromptSelectAccount:
+		case PromptNone:
+			if len(prompt) > 1 {
+				return InvalidPrompt
+			}
+		default:
+			return InvalidPrompt
+		}
+	}
+	r.Prompt = prompt
+	if v, ok := params["max_age"]; ok && len(v) > 0 {
+		maxAge, err := strconv.Atoi(v[0])
+		if err != nil || maxAge < 0 {
+			return InvalidMaxAge
+		}
+		r.MaxAge = &maxAge
+	}
+	if hint := params.Get("id_token_hint"); hint != "" {
+		claims, err := c.idTokenHint(hint)
+		if err != nil || !claims.Audience.Contains(r.ClientID) {
+			return InvalidIDTokenHint
+		}
+		r.IDTokenHintSubject = claims.Subject
+	}
+	r.LoginHint = params.Get("login_hint")
+	r.UILocales = strings.Fields(params.Get("ui_locales"))
+	r.ACRValues = strings.Fields(params.Get("acr_values"))
+	return nil
+}
+
+// interact makes sure that the resource owner completed the interactions required by the given
+// authorization request. It returns the error response to send to the client if the request
+// requires an interaction and either has the "none" prompt or the controller has no interaction
+// handler, or if the provider fails. It returns false if the interaction handler sent the
+// response that starts the interactions.
+func (c *ProviderController) interact(ctx context.Context, rw http.ResponseWriter, req *http.Request, a *authorization) (bool, *app.OAuth2ErrorMedia, error) {
+	var (
+		r        = a.request
+		required []string
+		require  = func(p string) {
+			for _, q := range required {
+				if q == p {
+					return
+				}
+			}
+			required = append(required, p)
+		}
+	)
+	if c.loginRequired(r) {
+		require(PromptLogin)
+	}
+	if r.Subject != "" {
+		if ir, ok := c.provider.(InteractionRequirer); ok {
+			i, err := ir.RequiredInteraction(ctx, r)
+			if err != nil {
+				return false, errorToMedia(err), nil
+			}
+			if i != "" {
+				require(i)
+			}
+		}
+	}
+	for _, p := range r.Prompt {
+		if p != PromptNone {
+			require(p)
+			continue
+		}
+		if len(required) == 0 {
+			return true, nil, nil
+		}
+		return false, interactionError(required[0]), nil
+	}
+	if c.interaction == nil {
+		// The service authenticates the resource owner without a handler, a missing
+		// subject only requires a login if the client asked for one.
+		if len(required) > 0 && required[0] == PromptLogin && r.Subject == "" && r.MaxAge == nil && !hasPrompt(r.Prompt, PromptLogin) {
+			required = required[1:]
+		}
+		if len(required) == 0 {
+			return true, nil, nil
+		}
+		return false, interactionError(required[0]), nil
+	}
+	if len(required) == 0 {
+		return true, nil, nil
+	}
+	proceed, err := c.interaction(ctx, rw, req, &Interaction{Prompts: required, Request: r})
+	return proceed, nil, err
+}
+
+// interactionError returns the error response sent when the given interaction is required but
+// cannot take place.
+func interactionError(prompt string) *app.OAuth2ErrorMedia {
+	switch prompt {
+	case PromptLogin:
+		return LoginRequired
+	case PromptConsent:
+		return ConsentRequired
+	}
+	return InteractionRequired
+}
+
+// hasPrompt returns true if the given "prompt" parameter values include the given value.
+func hasPrompt(prompts []string, prompt string) bool {
+	for _, p := range prompts {
+		if p == prompt {
+			return true
+		}
+	}
+	return false
+}
+
+// loginRequired returns true if the resource owner of the given request must authenticate: the
+// request context has no subject, the authentication is older than the requested maximum age or
+// the subject does not match the ID token hint.
+func (c *ProviderController) loginRequired(r *AuthorizationRequest) bool {
+	if r.Subject == "" {
+		return true
+	}
+	if r.MaxAge != nil && (r.AuthTime.IsZero() || time.Since(r.AuthTime) > time.Duration(*r.MaxAge)*time.Second) {
+		return true
+	}
+	return r.IDTokenHintSubject != "" && r.IDTokenHintSubject != r.Subject
+}
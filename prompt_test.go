@@ -0,0 +1,68 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInteractWithoutHandler(t *testing.T) {
+	var (
+		maxAge   = 60
+		recent   = time.Now().Add(-time.Second)
+		outdated = time.Now().Add(-time.Hour)
+	)
+	cases := []struct {
+		Name    string
+		Request *AuthorizationRequest
+		Error   string
+	}{
+		{"authenticated", &AuthorizationRequest{Subject: "alice", AuthTime: recent}, ""},
+		{"no subject", &AuthorizationRequest{}, ""},
+		{"recent authentication", &AuthorizationRequest{Subject: "alice", AuthTime: recent, MaxAge: &maxAge}, ""},
+		{"outdated authentication", &AuthorizationRequest{Subject: "alice", AuthTime: outdated, MaxAge: &maxAge}, "login_required"},
+		{"max age without subject", &AuthorizationRequest{MaxAge: &maxAge}, "login_required"},
+		{"prompt login", &AuthorizationRequest{Subject: "alice", Prompt: []string{PromptLogin}}, "login_required"},
+		{"prompt login without subject", &AuthorizationRequest{Prompt: []string{PromptLogin}}, "login_required"},
+		{"prompt consent", &AuthorizationRequest{Subject: "alice", Prompt: []string{PromptConsent}}, "consent_required"},
+		{"prompt select account", &AuthorizationRequest{Subject: "alice", Prompt: []string{PromptSelectAccount}}, "interaction_required"},
+		{"hint mismatch", &AuthorizationRequest{Subject: "alice", IDTokenHintSubject: "bob"}, "login_required"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := NewProviderController(newTestService(), struct{ Provider }{})
+			proceed, m, err := c.interact(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/oauth2/authorize", nil), &authorization{request: tc.Request})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.Error == "" {
+				if !proceed || m != nil {
+					t.Errorf("got error %v, expected the request to proceed", m)
+				}
+				return
+			}
+			if proceed || m == nil || m.Error != tc.Error {
+				t.Errorf("got error %v, expected %q", m, tc.Error)
+			}
+		})
+	}
+}
+
+func TestInteractWithHandler(t *testing.T) {
+	var prompts []string
+	handler := func(ctx context.Context, rw http.ResponseWriter, req *http.Request, i *Interaction) (bool, error) {
+		prompts = i.Prompts
+		return false, nil
+	}
+	c := NewProviderController(newTestService(), struct{ Provider }{}, WithInteractionHandler(handler))
+	r := &AuthorizationRequest{Prompt: []string{PromptConsent}}
+	proceed, m, err := c.interact(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/oauth2/authorize", nil), &authorization{request: r})
+	if err != nil || m != nil || proceed {
+		t.Fatalf("got proceed %v, error %v and %v, expected the handler to start the interactions", proceed, m, err)
+	}
+	if len(prompts) != 2 || prompts[0] != PromptLogin || prompts[1] != PromptConsent {
+		t.Errorf("got prompts %v, expected login then consent", prompts)
+	}
+}
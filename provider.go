@@ -9,18 +9,51 @@ import (
 	"context"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/goadesign/goa"
 	"github.com/goadesign/oauth2/app"
+	jose "gopkg.in/square/go-jose.v2"
 )
 
 type (
 	// ProviderController implements the OAuth2Provider resource.
 	ProviderController struct {
 		*goa.Controller
-		provider Provider // User provided implementation
+		provider      Provider             // User provided implementation
+		refreshTokens *RefreshTokenManager // Optional refresh token rotation
+		scopes        *ScopeRegistry       // Optional scope registry
+		codes         *StatelessCodes      // Optional stateless authorization codes
+		clients       ClientRegistry       // Optional client registry
+		issuer        string               // Optional issuer identifier
+		keys          *SigningKeys         // Optional JWT signing keys
+		pushed        PushedRequestStore   // Optional pushed authorization requests
+		endpoints     Endpoints            // Endpoints advertised in the metadata
+		claims        []string             // Claims advertised in the metadata
+		interaction   InteractionHandler   // Optional resource owner interaction handler
+		sessions      SessionManager       // Optional resource owner session manager
+		sessionStore  SessionStore         // Optional session participation store
+		logoutSender  LogoutTokenSender    // Optional back-channel logout token sender
+
+		detailTypes *AuthorizationDetailTypes // Optional authorization details types
+		resources   *ResourceServers          // Optional resource servers
+		dpop        *DPoP                     // Optional DPoP proof verification
+
+		requestObjects bool                 // Whether request objects are enabled
+		fetcher        RequestObjectFetcher // Optional request object fetcher
+		decryptionKeys []jose.JSONWebKey    // Optional request object decryption keys
+		requestReplay  ReplayCache          // Used request object identifiers
+
+		idTokenLifetime time.Duration // Lifetime of ID tokens
+		pushedLifetime  time.Duration // Lifetime of pushed authorization requests
+		sessionLifetime time.Duration // Lifetime of session participation records
 	}
 
+	// ProviderOption configures optional features of a ProviderController.
+	ProviderOption func(*ProviderController)
+
 	// Provider is the interface that provides the actual implementation for the authorize
 	// and token endpoints.
 	Provider interface {
@@ -56,10 +89,27 @@ type (
 )
 
 // NewProviderController creates a OAuth2Provider controller.
-func NewProviderController(service *goa.Service, provider Provider) *ProviderController {
-	return &ProviderController{
-		Controller: service.NewController("OAuth2ProviderController"),
-		provider:   provider,
+func NewProviderController(service *goa.Service, provider Provider, opts ...ProviderOption) *ProviderController {
+	c := &ProviderController{
+		Controller:      service.NewController("OAuth2ProviderController"),
+		provider:        provider,
+		idTokenLifetime: DefaultIDTokenLifetime,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if _, ok := provider.(StatelessCodeProvider); c.codes != nil && !ok {
+		service.LogError("stateless codes ignored, the provider does not implement StatelessCodeProvider")
+		c.codes = nil
+	}
+	return c
+}
+
+// WithRefreshTokenRotation configures the controller to rotate refresh tokens using the given
+// manager. See RefreshTokenManager.
+func WithRefreshTokenRotation(m *RefreshTokenManager) ProviderOption {
+	return func(c *ProviderController) {
+		c.refreshTokens = m
 	}
 }
 
@@ -87,74 +137,428 @@ func NewOAuth2ClientBasicAuthMiddleware(provider Provider) goa.Middleware {
 }
 
 // Authorize is a request made by the resource owner to grant access to the client.  It redirects
-// to the client using a pre-registered redirect URI. The redirect URL contains the authorization
-// code as a query string value.
+// to the client using a pre-registered redirect URI. The authorization code is sent to the client
+// using the response mode requested by the client, the client default response mode or by
+// default in the redirect URI query string. Response types that include tokens ("token" and
+// "id_token") require a client registry and are only accepted for the clients that allow them,
+// their responses are sent in the redirect URI fragment by default. Errors are also sent to the
+// client using the response mode if the controller has a client registry. Without a registry the
+// redirect URI cannot be trusted before the provider validates it so errors are returned in the
+// response body instead. Requests may reference a pushed authorization request with the
+// "request_uri" parameter, see PushAuthorizationRequest, or include a signed request object, see
+// WithRequestObjects. Responses sent to the redirect URI include the controller issuer identifier
+// if configured, see WithIssuer. The OpenID Connect "prompt" and "max_age" parameters may require
+// the resource owner to interact with the authorization server first, see
+// WithInteractionHandler.
 func (c *ProviderController) Authorize(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	// Resolve pushed authorization request or request object if any
+	var (
+		params    = req.URL.Query()
+		pushedURI string
+		origin    requestOrigin
+		m         *app.OAuth2ErrorMedia
+		err       error
+	)
+	switch uri := params.Get("request_uri"); {
+	case strings.HasPrefix(uri, PushedRequestURIPrefix):
+		var r *PushedRequest
+		if r, m, err = c.pushedRequest(ctx, params); r != nil {
+			params, pushedURI = r.Params, uri
+			origin = requestOrigin{pushed: true, signed: r.Signed}
+		}
+	case uri != "" || params.Get("request") != "":
+		params, m, err = c.requestObjectParams(ctx, params)
+		origin.signed = true
+	}
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, m)
+	}
+
+	// Validate request
+	a, m, err := c.validateAuthorization(ctx, params, origin)
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		return c.authorizationError(ctx, rw, a, m)
+	}
+	r := a.request
+	r.Subject = ContextSubject(ctx)
+	r.AuthTime, r.ACR = ContextAuthTime(ctx), ContextACR(ctx)
+	r.SessionID = ContextSessionID(ctx)
+
+	// Make sure the resource owner completed the required interactions
+	proceed, m, err := c.interact(ctx, rw, req, a)
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		return c.authorizationError(ctx, rw, a, m)
+	}
+	if !proceed {
+		return nil
+	}
+	if a.responseType.idToken && r.Subject == "" {
+		return c.authorizationError(ctx, rw, a, UnauthenticatedSubject)
+	}
+
+	// Pushed requests may only be used once, consume them before any code or token is issued
+	if pushedURI != "" {
+		if _, err := c.pushed.TakePushedRequest(ctx, pushedURI); err == ErrPushedRequestNotFound {
+			return c.authorizationError(ctx, rw, a, InvalidRequestURI)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// Retrieve auth code
+	var (
+		code, accessToken string
+		expiresIn         int
+	)
+	if a.responseType.code {
+		if c.codes != nil {
+			code, err = c.statelessCode(ctx, r)
+		} else if ra, ok := c.provider.(RequestAuthorizer); ok {
+			code, err = ra.AuthorizeRequest(ctx, r)
+		} else {
+			code, err = c.provider.Authorize(r.ClientID, r.Scope, r.RedirectURI)
+		}
+		if err != nil {
+			return c.authorizationError(ctx, rw, a, errorToMedia(err))
+		}
+	}
+
+	// Retrieve access token, the provider also validates requests that do not ask for a code
+	if a.responseType.token || !a.responseType.code {
+		accessToken, expiresIn, err = c.provider.(ImplicitAuthorizer).AuthorizeImplicit(ctx, r)
+		if err != nil {
+			return c.authorizationError(ctx, rw, a, errorToMedia(err))
+		}
+	}
+
+	// Send code, tokens and state originally provided by client if any
+	resp := url.Values{}
+	if code != "" {
+		resp.Set("code", code)
+	}
+	if !a.responseType.token {
+		// Never send or hash an access token the response type does not ask for
+		accessToken = ""
+	}
+	if accessToken != "" {
+		resp.Set("access_token", accessToken)
+		resp.Set("token_type", "Bearer")
+		if expiresIn != 0 {
+			resp.Set("expires_in", strconv.Itoa(expiresIn))
+		}
+	}
+	if a.responseType.idToken {
+		idToken, err := c.idToken(r, code, accessToken)
+		if err != nil {
+			return err
+		}
+		resp.Set("id_token", idToken)
+	}
+	if r.State != "" {
+		resp.Set("state", r.State)
+	}
+
+	// Record the client participation in the resource owner session
+	if c.sessionStore != nil && r.SessionID != "" {
+		expiresAt := time.Now().Add(c.sessionLifetime)
+		if err := c.sessionStore.AddSessionClient(ctx, r.SessionID, r.ClientID, expiresAt); err != nil {
+			return err
+		}
+	}
+
+	return c.redirect(ctx, rw, a, resp)
+}
+
+// authorization is a validated authorization request.
+type authorization struct {
+	// client is the registered client, nil if the controller has no client registry.
+	client *Client
+	// redirectURI is the validated redirect URI.
+	redirectURI *url.URL
+	// responseMode is the response mode used to send the response.
+	responseMode string
+	// responseType is the parsed response type.
+	responseType responseType
+	// request contains the validated parameters.
+	request *AuthorizationRequest
+}
+
+// validateAuthorization validates the given authorization request parameters. It returns the
+// error response to send to the client if the request is invalid and a non-nil error if the
+// validation could not complete. The returned authorization is
+// nil if the error occurred before the redirect URI could be validated, it contains the redirect
+// URI and response mode otherwise. origin describes how the parameters were received.
+func (c *ProviderController) validateAuthorization(ctx context.Context, params url.Values, origin requestOrigin) (*authorization, *app.OAuth2ErrorMedia, error) {
 	var (
-		query        = req.URL.Query()
-		clientID     = query.Get("client_id")
-		responseType = query.Get("response_type")
-		redirectURI  = query.Get("redirect_uri")
-		scope        = query.Get("scope")
-		state        = query.Get("state")
+		clientID     = params.Get("client_id")
+		responseType = params.Get("response_type")
+		redirectURI  = params.Get("redirect_uri")
+		scope        = params.Get("scope")
+		state        = params.Get("state")
+		challenge    = params.Get("code_challenge")
+		method       = params.Get("code_challenge_method")
+		mode         = params.Get("response_mode")
+		nonce        = params.Get("nonce")
 	)
 	// Ensure there is a client identifier
 	if clientID == "" {
-		return c.Service.Send(ctx, http.StatusBadRequest, MissingClientID)
+		return nil, MissingClientID, nil
 	}
 
-	// Validate grant type
-	if responseType != "code" {
-		return c.Service.Send(ctx, http.StatusBadRequest, BadResponseType)
+	// Validate response type
+	rt, ok := parseResponseType(responseType)
+	if !ok {
+		return nil, BadResponseType, nil
+	}
+
+	// Match redirect URI against registered URIs
+	var client *Client
+	if c.clients != nil {
+		var err error
+		client, err = c.clients.Client(ctx, clientID)
+		if err == ErrClientNotFound {
+			return nil, UnknownClient, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if client.RequirePushedRequests && !origin.pushed {
+			return nil, PushedRequestRequired, nil
+		}
+		if client.RequireSignedRequestObject && !origin.signed {
+			return nil, RequestObjectRequired, nil
+		}
+		if redirectURI == "" {
+			redirectURI = client.DefaultRedirectURI()
+		} else if !client.MatchRedirectURI(redirectURI) {
+			return nil, UnregisteredRedirect, nil
+		}
 	}
 
 	// Ensure there is a redirect URI
 	if redirectURI == "" {
-		return c.Service.Send(ctx, http.StatusBadRequest, MissingRedirect)
+		return nil, MissingRedirect, nil
 	}
 
 	// Validate redirect URI
 	u, err := url.Parse(redirectURI)
-	if err != nil || u.Scheme == "" || u.Host == "" {
-		return c.Service.Send(ctx, http.StatusBadRequest, InvalidRedirect)
+	if err != nil || !validRedirectURI(u) {
+		return nil, InvalidRedirect, nil
 	}
 
-	// Retrieve auth code
-	code, err := c.provider.Authorize(clientID, scope, redirectURI)
+	// Validate response mode, tokens are sent in the fragment by default
+	if mode == "" && client != nil && !(rt.hasTokens() && client.ResponseMode == ResponseModeQuery) {
+		mode = client.ResponseMode
+	}
+	if mode == "" {
+		mode = ResponseModeQuery
+		if rt.hasTokens() {
+			mode = ResponseModeFragment
+		}
+	}
+	if !validResponseMode(mode) || (isJWTResponseMode(mode) && !c.signsJWTs()) {
+		return nil, InvalidResponseMode, nil
+	}
+	if mode == ResponseModeJWT {
+		mode = ResponseModeQueryJWT
+		if rt.hasTokens() {
+			mode = ResponseModeFragmentJWT
+		}
+	}
+	a := &authorization{
+		client:       client,
+		redirectURI:  u,
+		responseMode: mode,
+		responseType: rt,
+		request: &AuthorizationRequest{
+			ClientID:     clientID,
+			RedirectURI:  redirectURI,
+			State:        state,
+			ResponseType: rt.String(),
+			Nonce:        nonce,
+		},
+	}
+
+	// Make sure the response type is supported and allowed for the client, tokens must never
+	// be sent in the query string unless encrypted
+	if rt.hasTokens() {
+		if mode == ResponseModeQuery {
+			a.responseMode = ResponseModeFragment
+			return a, InvalidTokenResponseMode, nil
+		}
+		if mode == ResponseModeQueryJWT && (client == nil || client.ResponseEncryptionAlg == "") {
+			a.responseMode = ResponseModeFragmentJWT
+			return a, InvalidTokenResponseMode, nil
+		}
+		if client == nil || !c.supportsResponseType(rt) {
+			return a, BadResponseType, nil
+		}
+	}
+	if client != nil && !client.AllowsResponseType(responseType) {
+		return a, UnauthorizedResponseType, nil
+	}
+
+	// Validate scope
+	if c.scopes != nil {
+		requested, err := ParseScope(scope)
+		if err != nil {
+			return a, MalformedScope, nil
+		}
+		if len(requested) == 0 {
+			requested = c.scopes.DefaultScope(clientID)
+		}
+		if requested, err = c.scopes.Resolve(requested); err != nil {
+			return a, errorToMedia(err), nil
+		}
+		scope = requested.String()
+	}
+	a.request.Scope = scope
+
+	// Validate authorization details, providers that only implement Provider.Authorize cannot
+	// bind them to authorization codes
+	details, err := c.authorizationDetails(params.Get("authorization_details"))
 	if err != nil {
-		return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
+		return a, errorToMedia(err), nil
+	}
+	if details != nil && !c.carriesAuthorizationRequest(a.responseType) {
+		return a, UnsupportedAuthorizationDetails, nil
+	}
+	a.request.AuthorizationDetails = details
+
+	// Validate resource indicators
+	target, err := c.resourceTarget(params["resource"], scope)
+	if err != nil {
+		return a, errorToMedia(err), nil
+	}
+	if target != nil && !c.carriesAuthorizationRequest(rt) {
+		return a, UnsupportedResources, nil
+	}
+	if target != nil {
+		a.request.Resources = target.resources
+		a.request.Audience = target.audience
+		a.request.AccessTokenLifetime = target.lifetime
+	}
+
+	// Validate ID token request
+	if rt.idToken {
+		requested, err := ParseScope(scope)
+		if err != nil {
+			return a, MalformedScope, nil
+		}
+		if !requested.Contains("openid") {
+			return a, MissingOpenIDScope, nil
+		}
+		if nonce == "" {
+			return a, MissingNonce, nil
+		}
 	}
 
-	// Write code to URL query
-	q := u.Query()
-	q.Set("code", code)
+	// Validate OpenID Connect authentication parameters
+	if m := c.validateAuthentication(params, a.request); m != nil {
+		return a, m, nil
+	}
 
-	// Keep state originally provided by client if any
-	if state != "" {
-		q.Set("state", state)
+	// Validate PKCE code challenge, native apps must use the authorization code flow with PKCE.
+	// PKCE is only required for native redirect URIs if the provider supports it so that
+	// providers that do not keep working with loopback redirect URIs.
+	native := isNativeRedirect(u) || client != nil && client.Native
+	if native && !rt.code {
+		return a, UnauthorizedResponseType, nil
+	}
+	if challenge == "" && method != "" {
+		return a, InvalidCodeChallenge, nil
+	}
+	if challenge == "" && (client != nil && client.Native || native && c.supportsPKCE()) {
+		return a, MissingCodeChallenge, nil
+	}
+	if challenge != "" {
+		if !c.supportsPKCE() {
+			return a, UnsupportedPKCE, nil
+		}
+		if !validPKCEValue(challenge) {
+			return a, InvalidCodeChallenge, nil
+		}
+		if method == "" {
+			method = PKCEMethodPlain
+		}
+		if method != PKCEMethodPlain && method != PKCEMethodS256 {
+			return a, InvalidCodeChallengeMethod, nil
+		}
+		a.request.CodeChallenge = challenge
+		a.request.CodeChallengeMethod = method
 	}
 
-	u.RawQuery = q.Encode()
-	rw.Header().Set("Location", u.String())
+	return a, nil, nil
+}
 
-	return c.Service.Send(ctx, http.StatusFound, nil)
+// authorizationError sends the given error response to the client. The error is sent to the
+// redirect URI if the request client is registered, in the response body otherwise.
+func (c *ProviderController) authorizationError(ctx context.Context, rw http.ResponseWriter, a *authorization, m *app.OAuth2ErrorMedia) error {
+	if a == nil || a.client == nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, m)
+	}
+	return c.redirectError(ctx, rw, a, m)
 }
 
-// GetToken runs the get_token action.
+// GetToken runs the get_token action for the authorization code and refresh token grants. Use
+// GetTokenPayload to support the other grant types and token request parameters.
 func (c *ProviderController) GetToken(ctx context.Context, rw http.ResponseWriter, grantType string,
 	code, redirectURI, refreshToken, scope *string) error {
 
-	if grantType == "authorization_code" {
-		return c.exchange(ctx, rw, code, redirectURI)
+	return c.GetTokenPayload(ctx, rw, &app.TokenPayload{
+		GrantType:    grantType,
+		Code:         code,
+		RedirectURI:  redirectURI,
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	})
+}
+
+// GetTokenPayload runs the get_token action with all the token request parameters including the
+// ones used by token exchange, PKCE, rich authorization requests and resource indicators. The
+// payload is built from the payload generated in the service app package, see the README.
+func (c *ProviderController) GetTokenPayload(ctx context.Context, rw http.ResponseWriter, p *app.TokenPayload) error {
+	// Verify DPoP proof if any
+	ctx, err := c.verifyDPoP(ctx, rw)
+	if err != nil {
+		if _, ok := err.(Error); !ok {
+			return err
+		}
+		return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
 	}
-	if grantType == "refresh_token" {
-		return c.refresh(ctx, rw, refreshToken, scope)
+
+	switch p.GrantType {
+	case "authorization_code":
+		details, err := c.authorizationDetails(stringValue(p.AuthorizationDetails))
+		if err != nil {
+			return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
+		}
+		return c.exchange(ctx, rw, p.Code, p.RedirectURI, p.CodeVerifier, details, p.Resource)
+	case "refresh_token":
+		if p.AuthorizationDetails != nil {
+			return c.Service.Send(ctx, http.StatusBadRequest, UnsupportedTokenAuthorizationDetails)
+		}
+		return c.refresh(ctx, rw, p.RefreshToken, p.Scope, p.Resource)
+	case TokenExchangeGrantType:
+		return c.exchangeToken(ctx, rw, p)
 	}
 	return c.Service.Send(ctx, http.StatusBadRequest, InvalidGrantType)
 }
 
-// exchange returns a pair of refresh and access tokens from an authorization code.
-func (c *ProviderController) exchange(ctx context.Context, rw http.ResponseWriter, code, redirectURI *string) error {
+// exchange returns a pair of refresh and access tokens from an authorization code. details and
+// resources contain the authorization details and resource indicators requested in the token
+// request if any, only providers that implement RequestExchanger can take the authorization
+// details into account.
+func (c *ProviderController) exchange(ctx context.Context, rw http.ResponseWriter, code, redirectURI, verifier *string, details []AuthorizationDetail, resources []string) error {
 	// Ensure there is a client identifier
 	clientID := ContextClientID(ctx)
 	if clientID == "" {
@@ -166,6 +570,18 @@ func (c *ProviderController) exchange(ctx context.Context, rw http.ResponseWrite
 		return c.Service.Send(ctx, http.StatusBadRequest, MissingCode)
 	}
 
+	// Default redirect URI to the only registered URI if any
+	if redirectURI == nil && c.clients != nil {
+		client, err := c.clients.Client(ctx, clientID)
+		if err != nil && err != ErrClientNotFound {
+			return err
+		}
+		if client != nil && client.DefaultRedirectURI() != "" {
+			uri := client.DefaultRedirectURI()
+			redirectURI = &uri
+		}
+	}
+
 	// Ensure there is a redirect URI
 	if redirectURI == nil {
 		return c.Service.Send(ctx, http.StatusBadRequest, MissingRedirect)
@@ -173,19 +589,82 @@ func (c *ProviderController) exchange(ctx context.Context, rw http.ResponseWrite
 
 	// Validate redirect URI
 	u, err := url.Parse(*redirectURI)
-	if err != nil || u.Scheme == "" || u.Host == "" {
+	if err != nil || !validRedirectURI(u) {
 		return c.Service.Send(ctx, http.StatusBadRequest, InvalidRedirect)
 	}
 
-	// Retrieve tokens code
-	refreshToken, accessToken, expiresIn, err := c.provider.Exchange(clientID, *code, *redirectURI)
+	// Reject code verifiers if codes cannot be bound to code challenges
+	if verifier != nil && !c.supportsPKCE() {
+		return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(NewError(ErrInvalidGrant, "invalid code verifier", "")))
+	}
+
+	// Retrieve tokens
+	var (
+		refreshToken, accessToken string
+		expiresIn                 int
+		auth                      *Authentication
+		codeScope                 string
+	)
+	e, exchanger := c.provider.(RequestExchanger)
+	if details != nil && (c.codes != nil || !exchanger) {
+		return c.Service.Send(ctx, http.StatusBadRequest, UnsupportedTokenAuthorizationDetails)
+	}
+	if len(resources) > 0 && c.codes == nil && !exchanger {
+		return c.Service.Send(ctx, http.StatusBadRequest, UnsupportedTokenResources)
+	}
+
+	// Validate resource indicators, the scope granted with the code is checked against them
+	// when the code is redeemed
+	target, err := c.resourceTarget(resources, "")
+	if err != nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
+	}
+	if target == nil {
+		target = &resourceTarget{}
+	}
+	jkt := ContextDPoPThumbprint(ctx)
+	if c.codes != nil {
+		var g *CodeGrant
+		if g, err = c.codes.redeem(*code, clientID, *redirectURI, stringValue(verifier)); err == nil {
+			g.DPoPJKT = jkt
+			if err = c.narrowCodeGrant(g, resources); err == nil {
+				refreshToken, accessToken, expiresIn, err = c.provider.(StatelessCodeProvider).IssueGrant(ctx, g)
+			}
+			auth = &Authentication{Subject: g.Subject, Nonce: g.Nonce, AuthTime: g.AuthTime, ACR: g.ACR, SessionID: g.SessionID}
+			codeScope = g.Scope
+		}
+	} else if exchanger {
+		req := &ExchangeRequest{
+			ClientID:             clientID,
+			Code:                 *code,
+			RedirectURI:          *redirectURI,
+			CodeVerifier:         stringValue(verifier),
+			AuthorizationDetails: details,
+			Resources:            target.resources,
+			Audience:             target.audience,
+			AccessTokenLifetime:  target.lifetime,
+			CheckResourceScope:   target.checkScope(c),
+			DPoPJKT:              jkt,
+		}
+		refreshToken, accessToken, expiresIn, err = e.ExchangeRequest(ctx, req)
+		auth = req.Authentication
+	} else {
+		refreshToken, accessToken, expiresIn, err = c.provider.Exchange(clientID, *code, *redirectURI)
+	}
 	if err != nil {
 		return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
 	}
 
+	// Start new refresh token family if rotating
+	if c.refreshTokens != nil && refreshToken != "" {
+		if refreshToken, err = c.refreshTokens.issue(clientID, refreshToken); err != nil {
+			return err
+		}
+	}
+
 	m := app.TokenMedia{
 		AccessToken: accessToken,
-		TokenType:   "Bearer",
+		TokenType:   accessTokenType(c.boundJKT(ctx, accessToken)),
 	}
 	if refreshToken != "" {
 		m.RefreshToken = &refreshToken
@@ -193,32 +672,155 @@ func (c *ProviderController) exchange(ctx context.Context, rw http.ResponseWrite
 	if expiresIn != 0 {
 		m.ExpiresIn = &expiresIn
 	}
+	granted := c.grantedScope(ctx, accessToken)
+	if len(granted) > 0 {
+		s := granted.String()
+		m.Scope = &s
+	}
+	m.AuthorizationDetails = c.grantedAuthorizationDetails(ctx, accessToken)
 
-	rw.Header().Set("Content-Type", "application/json")
+	// Issue an ID token if the code was granted the "openid" scope
+	if granted == nil {
+		granted = NewScopeSet(strings.Fields(codeScope)...)
+	}
+	if auth != nil && granted.Contains("openid") && c.signsJWTs() {
+		r := &AuthorizationRequest{
+			ClientID:  clientID,
+			Subject:   auth.Subject,
+			Nonce:     auth.Nonce,
+			AuthTime:  auth.AuthTime,
+			ACR:       auth.ACR,
+			SessionID: auth.SessionID,
+		}
+		idToken, err := c.idToken(r, "", accessToken)
+		if err != nil {
+			return err
+		}
+		m.IDToken = &idToken
+	}
+
+	return c.sendToken(ctx, rw, &m)
+}
+
+// supportsPKCE returns true if the controller can bind authorization codes to PKCE code
+// challenges.
+func (c *ProviderController) supportsPKCE() bool {
+	if c.codes != nil {
+		return true
+	}
+	_, authorizer := c.provider.(RequestAuthorizer)
+	_, exchanger := c.provider.(RequestExchanger)
+	return authorizer && exchanger
+}
+
+// carriesAuthorizationRequest returns true if the controller gives the complete authorization
+// request to the provider when issuing the artifacts of the given response type so that the
+// provider can honor request parameters that Provider.Authorize does not accept such as
+// authorization details or resource indicators.
+func (c *ProviderController) carriesAuthorizationRequest(rt responseType) bool {
+	if !rt.code || c.codes != nil {
+		return true
+	}
+	_, ok := c.provider.(RequestAuthorizer)
+	return ok
+}
 
-	return c.Service.Send(ctx, http.StatusOK, &m)
+// supportsResponseType returns true if the controller can issue the artifacts of the given
+// response type: ID tokens require an issuer and signing keys and access tokens or responses
+// without an authorization code require a provider that implements ImplicitAuthorizer.
+func (c *ProviderController) supportsResponseType(rt responseType) bool {
+	if rt.idToken && !c.signsJWTs() {
+		return false
+	}
+	if rt.token || !rt.code {
+		_, ok := c.provider.(ImplicitAuthorizer)
+		return ok
+	}
+	return true
 }
 
-// refresh refreshes an access token given a refresh token.
-func (c *ProviderController) refresh(ctx context.Context, rw http.ResponseWriter, refreshToken, scope *string) error {
+// statelessCode returns a stateless authorization code for the given request.
+func (c *ProviderController) statelessCode(ctx context.Context, r *AuthorizationRequest) (string, error) {
+	scope, err := c.provider.(StatelessCodeProvider).AuthorizeGrant(ctx, r)
+	if err != nil {
+		return "", err
+	}
+	return c.codes.create(&CodeGrant{
+		ClientID:             r.ClientID,
+		RedirectURI:          r.RedirectURI,
+		Scope:                scope,
+		Subject:              r.Subject,
+		CodeChallenge:        r.CodeChallenge,
+		CodeChallengeMethod:  r.CodeChallengeMethod,
+		AuthorizationDetails: r.AuthorizationDetails,
+		Nonce:                r.Nonce,
+		AuthTime:             r.AuthTime,
+		ACR:                  r.ACR,
+		SessionID:            r.SessionID,
+		Resources:            r.Resources,
+	})
+}
+
+// refresh refreshes an access token given a refresh token. resources contains the resource
+// indicators requested in the refresh request if any, only providers that implement
+// RequestRefresher can take them into account.
+func (c *ProviderController) refresh(ctx context.Context, rw http.ResponseWriter, refreshToken, scope *string, resources []string) error {
 	// Ensure there is a refresh token
 	if refreshToken == nil {
 		return c.Service.Send(ctx, http.StatusBadRequest, MissingRefreshToken)
 	}
 
-	// Retrieve tokens
-	var s string
+	// Validate scope
+	var requested ScopeSet
 	if scope != nil {
-		s = *scope
+		var err error
+		if requested, err = ParseScope(*scope); err != nil {
+			return c.Service.Send(ctx, http.StatusBadRequest, MalformedScope)
+		}
+		if c.scopes != nil {
+			if requested, err = c.scopes.Resolve(requested); err != nil {
+				return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
+			}
+		}
+	}
+
+	// Validate resource indicators
+	_, refresher := c.provider.(RequestRefresher)
+	if len(resources) > 0 && !refresher {
+		return c.Service.Send(ctx, http.StatusBadRequest, UnsupportedTokenResources)
+	}
+	target, err := c.resourceTarget(resources, requested.String())
+	if err != nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
+	}
+
+	// Retrieve tokens
+	var (
+		aToken    string
+		expiresIn int
+		granted   ScopeSet
+	)
+	refresh := func(grant string) (string, error) {
+		var (
+			rToken string
+			err    error
+		)
+		rToken, aToken, expiresIn, granted, err = c.refreshGrant(ctx, grant, requested, target)
+		return rToken, err
+	}
+	var rToken string
+	if c.refreshTokens != nil {
+		rToken, err = c.refreshTokens.rotate(ctx, ContextClientID(ctx), *refreshToken, refresh)
+	} else {
+		rToken, err = refresh(*refreshToken)
 	}
-	rToken, aToken, expiresIn, err := c.provider.Refresh(*refreshToken, s)
 	if err != nil {
 		return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
 	}
 
 	m := app.TokenMedia{
 		AccessToken: aToken,
-		TokenType:   "Bearer",
+		TokenType:   accessTokenType(c.boundJKT(ctx, aToken)),
 	}
 	if rToken != "" {
 		m.RefreshToken = &rToken
@@ -226,11 +828,101 @@ func (c *ProviderController) refresh(ctx context.Context, rw http.ResponseWriter
 	if expiresIn != 0 {
 		m.ExpiresIn = &expiresIn
 	}
-	if scope != nil {
-		m.Scope = scope
+	if len(granted) > 0 {
+		s := granted.String()
+		m.Scope = &s
 	}
+	m.AuthorizationDetails = c.grantedAuthorizationDetails(ctx, aToken)
 
+	return c.sendToken(ctx, rw, &m)
+}
+
+// refreshGrant refreshes the access token of the grant identified by the given provider refresh
+// token. If the provider implements GrantScoper refreshGrant makes sure that the requested scope
+// does not exceed the scope originally granted as required by
+// https://tools.ietf.org/html/rfc6749#section-6 and returns the scope effectively granted to the
+// new access token. The returned scope is nil otherwise, the scope is then omitted from the
+// response since the scope effectively granted is unknown. target describes the resource servers
+// requested in the refresh request if any.
+func (c *ProviderController) refreshGrant(ctx context.Context, refreshToken string, scope ScopeSet, target *resourceTarget) (string, string, int, ScopeSet, error) {
+	scoper, ok := c.provider.(GrantScoper)
+	if ok && len(scope) > 0 {
+		s, err := scoper.RefreshTokenScope(refreshToken)
+		if err != nil {
+			return "", "", 0, nil, err
+		}
+		original, err := ParseScope(s)
+		if err != nil {
+			return "", "", 0, nil, err
+		}
+		if !c.scopeCovers(original, scope) {
+			return "", "", 0, nil, NewError(ErrInvalidScope, "requested scope exceeds the scope originally granted", "")
+		}
+	}
+	var (
+		rToken, aToken string
+		expiresIn      int
+		err            error
+	)
+	if r, ok := c.provider.(RequestRefresher); ok {
+		req := &RefreshRequest{
+			ClientID:     ContextClientID(ctx),
+			RefreshToken: refreshToken,
+			Scope:        scope.String(),
+			DPoPJKT:      ContextDPoPThumbprint(ctx),
+		}
+		if target != nil {
+			req.Resources, req.Audience, req.AccessTokenLifetime = target.resources, target.audience, target.lifetime
+			req.CheckResourceScope = target.checkScope(c)
+		}
+		rToken, aToken, expiresIn, err = r.RefreshRequest(ctx, req)
+	} else {
+		rToken, aToken, expiresIn, err = c.provider.Refresh(refreshToken, scope.String())
+	}
+	if err != nil {
+		return "", "", 0, nil, err
+	}
+	return rToken, aToken, expiresIn, c.grantedScope(ctx, aToken), nil
+}
+
+// scopeCovers returns true if the requested scope does not exceed the granted scope. It takes
+// scope implications into account if the controller has a scope registry.
+func (c *ProviderController) scopeCovers(granted, requested ScopeSet) bool {
+	if c.scopes != nil {
+		return c.scopes.Covers(granted, requested)
+	}
+	return requested.IsSubsetOf(granted)
+}
+
+// grantedScope returns the scope effectively granted to the given access token if the provider
+// implements GrantScoper, nil otherwise. The tokens are already issued when the scope is looked
+// up so failures are logged and the scope is omitted from the response rather than discarding
+// the tokens.
+func (c *ProviderController) grantedScope(ctx context.Context, accessToken string) ScopeSet {
+	scoper, ok := c.provider.(GrantScoper)
+	if !ok {
+		return nil
+	}
+	s, err := scoper.AccessTokenScope(accessToken)
+	if err == nil {
+		var granted ScopeSet
+		if granted, err = ParseScope(s); err == nil {
+			return granted
+		}
+	}
+	goa.LogError(ctx, "failed to retrieve granted scope", "err", err)
+	return nil
+}
+
+// sendToken writes a successful access token response. The response includes a fresh DPoP
+// nonce if DPoP nonces are required.
+func (c *ProviderController) sendToken(ctx context.Context, rw http.ResponseWriter, m *app.TokenMedia) error {
 	rw.Header().Set("Content-Type", "application/json")
+	if c.dpop != nil {
+		if err := c.dpop.SetNonce(rw); err != nil {
+			return err
+		}
+	}
 
-	return c.Service.Send(ctx, http.StatusOK, &m)
+	return c.Service.Send(ctx, http.StatusOK, m)
 }
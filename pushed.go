@@ -0,0 +1,247 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goadesign/oauth2/app"
+)
+
+// DefaultPushedRequestLifetime is the lifetime of the request URIs returned by the pushed
+// authorization request endpoint unless configured otherwise with WithPushedRequests.
+const DefaultPushedRequestLifetime = time.Minute
+
+// PushedRequestURIPrefix is the prefix of the request URIs returned by the pushed authorization
+// request endpoint, see https://tools.ietf.org/html/rfc9126#section-2.2
+const PushedRequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+type (
+	// PushedRequestStore persists the authorization requests pushed by clients to the pushed
+	// authorization request endpoint described in https://tools.ietf.org/html/rfc9126
+	PushedRequestStore interface {
+		// SavePushedRequest persists the given request under the given request URI.
+		SavePushedRequest(ctx context.Context, requestURI string, r *PushedRequest) error
+		// PushedRequest returns the request saved under the given request URI. It
+		// returns ErrPushedRequestNotFound if there is no such request or if the request
+		// has expired.
+		PushedRequest(ctx context.Context, requestURI string) (*PushedRequest, error)
+		// TakePushedRequest atomically loads and deletes the request saved under the
+		// given request URI so that each request can be used at most once. It returns
+		// ErrPushedRequestNotFound if there is no such request or if the request has
+		// expired.
+		TakePushedRequest(ctx context.Context, requestURI string) (*PushedRequest, error)
+	}
+
+	// PushedRequest is an authorization request pushed by a client.
+	PushedRequest struct {
+		// ClientID is the identifier of the authenticated client that pushed the request.
+		ClientID string
+		// Params contains the authorization request parameters.
+		Params url.Values
+		// Signed is true if the parameters come from a signed request object.
+		Signed bool
+		// ExpiresAt is the expiration time of the request URI.
+		ExpiresAt time.Time
+	}
+
+	// memoryPushedRequestStore is an in-memory implementation of PushedRequestStore.
+	memoryPushedRequestStore struct {
+		lock     sync.Mutex
+		requests map[string]*PushedRequest
+		purged   time.Time
+	}
+)
+
+// ErrPushedRequestNotFound is the error returned by PushedRequestStore implementations when a
+// request does not exist or has expired.
+var ErrPushedRequestNotFound = errors.New("pushed request not found")
+
+// NewMemoryPushedRequestStore creates a PushedRequestStore that keeps the requests in memory.
+// It is only suitable for deployments that run a single instance of the service.
+func NewMemoryPushedRequestStore() PushedRequestStore {
+	return &memoryPushedRequestStore{requests: make(map[string]*PushedRequest)}
+}
+
+// WithPushedRequests enables the pushed authorization request endpoint. The controller saves
+// the pushed requests in the given store for the given lifetime, the lifetime defaults to
+// DefaultPushedRequestLifetime if zero.
+func WithPushedRequests(s PushedRequestStore, lifetime time.Duration) ProviderOption {
+	return func(c *ProviderController) {
+		if lifetime == 0 {
+			lifetime = DefaultPushedRequestLifetime
+		}
+		c.pushed = s
+		c.pushedLifetime = lifetime
+	}
+}
+
+// PushAuthorizationRequest implements the pushed authorization request endpoint described in
+// https://tools.ietf.org/html/rfc9126#section-2. The client must be authenticated with
+// NewOAuth2ClientBasicAuthMiddleware. The request parameters are validated like the parameters of
+// authorization requests then saved until the client uses the returned request URI in an
+// authorization request. The parameters may be sent in a signed request object with the "request"
+// parameter if request objects are enabled, see WithRequestObjects.
+func (c *ProviderController) PushAuthorizationRequest(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+	// Ensure pushed requests are enabled
+	if c.pushed == nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, UnsupportedPushedRequests)
+	}
+
+	// Ensure there is a client identifier
+	clientID := ContextClientID(ctx)
+	if clientID == "" {
+		return c.Service.Send(ctx, http.StatusBadRequest, MissingClientID)
+	}
+
+	// Read request parameters
+	if err := req.ParseForm(); err != nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, MalformedBody)
+	}
+	params := make(url.Values, len(req.PostForm))
+	for k, vs := range req.PostForm {
+		params[k] = vs
+	}
+	if id := params.Get("client_id"); id != "" && id != clientID {
+		return c.Service.Send(ctx, http.StatusBadRequest, PushedClientMismatch)
+	}
+	if _, ok := params["request_uri"]; ok {
+		return c.Service.Send(ctx, http.StatusBadRequest, PushedRequestURI)
+	}
+	params.Set("client_id", clientID)
+
+	// Verify request object if any
+	origin := requestOrigin{pushed: true}
+	if params.Get("request") != "" {
+		var (
+			m   *app.OAuth2ErrorMedia
+			err error
+		)
+		if params, m, err = c.requestObjectParams(ctx, params); err != nil {
+			return err
+		}
+		if m != nil {
+			return c.Service.Send(ctx, http.StatusBadRequest, m)
+		}
+		origin.signed = true
+	}
+
+	// Validate request
+	_, m, err := c.validateAuthorization(ctx, params, origin)
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, m)
+	}
+
+	// Save request
+	uri, err := newRequestURI()
+	if err != nil {
+		return err
+	}
+	r := &PushedRequest{
+		ClientID:  clientID,
+		Params:    params,
+		Signed:    origin.signed,
+		ExpiresAt: time.Now().Add(c.pushedLifetime),
+	}
+	if err := c.pushed.SavePushedRequest(ctx, uri, r); err != nil {
+		return err
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	return c.Service.Send(ctx, http.StatusCreated, &app.PushedAuthorizationMedia{
+		RequestURI: uri,
+		ExpiresIn:  int(c.pushedLifetime.Seconds()),
+	})
+}
+
+// pushedRequest returns the pushed authorization request referenced by the "request_uri"
+// parameter of the given authorization request parameters. The authorization
+// request must not include parameters other than "client_id" and "request_uri" and its client
+// must be the client that pushed the request.
+func (c *ProviderController) pushedRequest(ctx context.Context, query url.Values) (*PushedRequest, *app.OAuth2ErrorMedia, error) {
+	uri := query.Get("request_uri")
+	if c.pushed == nil || !strings.HasPrefix(uri, PushedRequestURIPrefix) {
+		return nil, InvalidRequestURI, nil
+	}
+	for k := range query {
+		if k != "client_id" && k != "request_uri" {
+			return nil, MixedPushedRequest, nil
+		}
+	}
+	clientID := query.Get("client_id")
+	if clientID == "" {
+		return nil, MissingClientID, nil
+	}
+	r, err := c.pushed.PushedRequest(ctx, uri)
+	if err == ErrPushedRequestNotFound {
+		return nil, InvalidRequestURI, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.ClientID != clientID || !time.Now().Before(r.ExpiresAt) {
+		return nil, InvalidRequestURI, nil
+	}
+	return r, nil, nil
+}
+
+// newRequestURI generates a new pushed authorization request URI.
+func newRequestURI() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return PushedRequestURIPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SavePushedRequest implements PushedRequestStore.
+func (s *memoryPushedRequestStore) SavePushedRequest(ctx context.Context, requestURI string, r *PushedRequest) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	if now.Sub(s.purged) > time.Minute {
+		for uri, r := range s.requests {
+			if !now.Before(r.ExpiresAt) {
+				delete(s.requests, uri)
+			}
+		}
+		s.purged = now
+	}
+	s.requests[requestURI] = r
+	return nil
+}
+
+// PushedRequest implements PushedRequestStore.
+func (s *memoryPushedRequestStore) PushedRequest(ctx context.Context, requestURI string) (*PushedRequest, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, ok := s.requests[requestURI]
+	if !ok || !time.Now().Before(r.ExpiresAt) {
+		return nil, ErrPushedRequestNotFound
+	}
+	return r, nil
+}
+
+// TakePushedRequest implements PushedRequestStore.
+func (s *memoryPushedRequestStore) TakePushedRequest(ctx context.Context, requestURI string) (*PushedRequest, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, ok := s.requests[requestURI]
+	if !ok {
+		return nil, ErrPushedRequestNotFound
+	}
+	delete(s.requests, requestURI)
+	if !time.Now().Before(r.ExpiresAt) {
+		return nil, ErrPushedRequestNotFound
+	}
+	return r, nil
+}
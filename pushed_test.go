@@ -0,0 +1,47 @@
+package oauth2
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTakePushedRequest(t *testing.T) {
+	var (
+		ctx = context.Background()
+		s   = NewMemoryPushedRequestStore()
+		r   = &PushedRequest{ClientID: "client", ExpiresAt: time.Now().Add(time.Minute)}
+	)
+	if err := s.SavePushedRequest(ctx, "uri", r); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		wg    sync.WaitGroup
+		lock  sync.Mutex
+		taken int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.TakePushedRequest(ctx, "uri")
+			switch err {
+			case nil:
+				lock.Lock()
+				taken++
+				lock.Unlock()
+			case ErrPushedRequestNotFound:
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != 1 {
+		t.Errorf("took the request %d times, expected 1", taken)
+	}
+	if _, err := s.PushedRequest(ctx, "uri"); err != ErrPushedRequestNotFound {
+		t.Errorf("got error %v, expected ErrPushedRequestNotFound", err)
+	}
+}
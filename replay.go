@@ -0,0 +1,52 @@
+package oauth2
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// ReplayCache records the identifiers of single-use artifacts such as the "jti" claim of
+	// signed assertions so that they can be rejected if presented twice. Identifiers only need
+	// to be remembered until the artifact they identify expires.
+	ReplayCache interface {
+		// Use records the given identifier until the given expiration time. It returns
+		// false if the identifier was already recorded and has not expired yet.
+		Use(id string, expiresAt time.Time) (bool, error)
+	}
+
+	// memoryReplayCache is an in-memory implementation of ReplayCache.
+	memoryReplayCache struct {
+		lock  sync.Mutex
+		ids   map[string]time.Time
+		now   func() time.Time
+		purge time.Time
+	}
+)
+
+// NewMemoryReplayCache creates a ReplayCache that keeps identifiers in memory. It is suitable for
+// single node deployments, multi-node deployments must share a cache such as the one provided by
+// the store/redisstore package.
+func NewMemoryReplayCache() ReplayCache {
+	return &memoryReplayCache{ids: make(map[string]time.Time), now: time.Now}
+}
+
+// Use implements ReplayCache. Expired identifiers are purged at most once per minute.
+func (c *memoryReplayCache) Use(id string, expiresAt time.Time) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := c.now()
+	if now.Sub(c.purge) > time.Minute {
+		for i, exp := range c.ids {
+			if !now.Before(exp) {
+				delete(c.ids, i)
+			}
+		}
+		c.purge = now
+	}
+	if exp, ok := c.ids[id]; ok && now.Before(exp) {
+		return false, nil
+	}
+	c.ids[id] = expiresAt
+	return true, nil
+}
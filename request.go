@@ -0,0 +1,181 @@
+package oauth2
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	// RequestAuthorizer is the interface optionally implemented by providers that need the
+	// request context or the complete authorization request. When the provider implements it
+	// the controller calls AuthorizeRequest instead of Provider.Authorize.
+	RequestAuthorizer interface {
+		// AuthorizeRequest implements https://tools.ietf.org/html/rfc6749#section-4.1.1
+		// It has the same semantic as Provider.Authorize. The authorization code must be
+		// bound to the PKCE code challenge of the request if any.
+		AuthorizeRequest(ctx context.Context, req *AuthorizationRequest) (code string, err error)
+	}
+
+	// RequestExchanger is the interface optionally implemented by providers that need the
+	// request context or the complete access token request. When the provider implements it
+	// the controller calls ExchangeRequest instead of Provider.Exchange. Providers must
+	// implement RequestExchanger to support PKCE, authorization requests with a code
+	// challenge are rejected otherwise.
+	RequestExchanger interface {
+		// ExchangeRequest implements https://tools.ietf.org/html/rfc6749#section-4.1.3
+		// It has the same semantic as Provider.Exchange. In addition if the authorization
+		// code is bound to a PKCE code challenge ExchangeRequest must check that the code
+		// verifier matches the challenge and it must reject code verifiers sent for codes
+		// that are not bound to a challenge, see CheckCodeVerifier.
+		ExchangeRequest(ctx context.Context, req *ExchangeRequest) (refreshToken, accessToken string, expiresIn int, err error)
+	}
+
+	// RequestRefresher is the interface optionally implemented by providers that need the
+	// request context or the complete refresh request. When the provider implements it the
+	// controller calls RefreshRequest instead of Provider.Refresh. Providers must implement
+	// RequestRefresher to support resource indicators in refresh requests, see
+	// WithResourceServers.
+	RequestRefresher interface {
+		// RefreshRequest implements https://tools.ietf.org/html/rfc6749#section-6
+		// It has the same semantic as Provider.Refresh. In addition the resources of the
+		// request must not exceed the resources originally granted.
+		RefreshRequest(ctx context.Context, req *RefreshRequest) (newRefreshToken, accessToken string, expiresIn int, err error)
+	}
+
+	// AuthorizationRequest contains the validated parameters of an authorization request.
+	AuthorizationRequest struct {
+		// ClientID is the client identifier.
+		ClientID string
+		// RedirectURI is the redirection endpoint.
+		RedirectURI string
+		// Scope is the scope of the access request.
+		Scope string
+		// State is the opaque value used by the client to maintain state between the
+		// request and callback.
+		State string
+		// Subject is the identifier of the resource owner as set in the request context
+		// with WithSubject.
+		Subject string
+		// CodeChallenge is the PKCE code challenge if any, see
+		// https://tools.ietf.org/html/rfc7636#section-4.3
+		CodeChallenge string
+		// CodeChallengeMethod is the PKCE code challenge method, it is set if and only if
+		// CodeChallenge is.
+		CodeChallengeMethod string
+		// ResponseType is the requested response type in canonical order, e.g. "code" or
+		// "code id_token token".
+		ResponseType string
+		// Nonce is the OpenID Connect nonce included in the ID token if any.
+		Nonce string
+		// Prompt lists the OpenID Connect prompt values of the request if any: PromptNone,
+		// PromptLogin, PromptConsent and PromptSelectAccount.
+		Prompt []string
+		// MaxAge is the maximum authentication age in seconds requested by the client if
+		// any.
+		MaxAge *int
+		// LoginHint is the hint about the login identifier of the resource owner if any.
+		LoginHint string
+		// IDTokenHintSubject is the subject of the ID token given as "id_token_hint" if
+		// any.
+		IDTokenHintSubject string
+		// UILocales lists the preferred languages of the resource owner for the user
+		// interface if any, as BCP47 language tags.
+		UILocales []string
+		// ACRValues lists the authentication context class references requested by the
+		// client in order of preference if any.
+		ACRValues []string
+		// AuthTime is the time when the resource owner authenticated as set in the request
+		// context with WithAuthTime, the zero time if unknown.
+		AuthTime time.Time
+		// ACR is the authentication context class reference satisfied by the authentication
+		// as set in the request context with WithACR.
+		ACR string
+		// SessionID is the identifier of the session of the resource owner with the
+		// authorization server as set in the request context with WithSessionID.
+		SessionID string
+		// AuthorizationDetails contains the validated authorization details of rich
+		// authorization requests if any, see WithAuthorizationDetailTypes.
+		AuthorizationDetails []AuthorizationDetail
+		// Resources lists the resource indicators of the resource servers where the
+		// client intends to use the access tokens if any, see WithResourceServers.
+		Resources []string
+		// Audience lists the audience of the access tokens, one value per resource
+		// server listed in Resources.
+		Audience []string
+		// AccessTokenLifetime is the access token lifetime set by the resource servers
+		// listed in Resources, zero if the provider default lifetime applies.
+		AccessTokenLifetime time.Duration
+	}
+
+	// ExchangeRequest contains the validated parameters of an access token request made with
+	// an authorization code.
+	ExchangeRequest struct {
+		// ClientID is the identifier of the authenticated client.
+		ClientID string
+		// Code is the authorization code.
+		Code string
+		// RedirectURI is the redirection endpoint used in the authorization request.
+		RedirectURI string
+		// CodeVerifier is the PKCE code verifier if any, see
+		// https://tools.ietf.org/html/rfc7636#section-4.5
+		CodeVerifier string
+		// AuthorizationDetails contains the validated authorization details requested in
+		// the token request if any. The provider must make sure that they do not exceed
+		// the authorization details granted with the code, see
+		// https://tools.ietf.org/html/rfc9396#section-6.1
+		AuthorizationDetails []AuthorizationDetail
+		// Resources lists the resource indicators requested in the token request if any.
+		// The provider must make sure that they were requested in the authorization
+		// request, see https://tools.ietf.org/html/rfc8707#section-2.2
+		Resources []string
+		// Audience lists the audience of the access token, one value per resource server
+		// listed in Resources.
+		Audience []string
+		// AccessTokenLifetime is the access token lifetime set by the resource servers
+		// listed in Resources, zero if the provider default lifetime applies.
+		AccessTokenLifetime time.Duration
+		// CheckResourceScope makes sure that each token of the given scope is accepted by
+		// at least one of the resource servers listed in Resources. It is nil if there
+		// are no resource indicators, the provider must call it with the scope granted
+		// with the code otherwise.
+		CheckResourceScope func(scope string) error
+		// DPoPJKT is the JWK SHA-256 thumbprint of the key used to sign the DPoP proof of
+		// the request if any. The access token must be bound to the key, see
+		// https://tools.ietf.org/html/rfc9449#section-6
+		DPoPJKT string
+		// Authentication is set by the provider to the authentication recorded with the
+		// code when the code was issued, see AuthorizationRequest. The controller needs it
+		// to return an ID token if the code was granted the "openid" scope.
+		Authentication *Authentication
+	}
+
+	// RefreshRequest contains the validated parameters of an access token request made with a
+	// refresh token.
+	RefreshRequest struct {
+		// ClientID is the identifier of the authenticated client if any.
+		ClientID string
+		// RefreshToken is the refresh token.
+		RefreshToken string
+		// Scope is the requested scope, the scope originally granted if empty.
+		Scope string
+		// Resources lists the resource indicators requested in the refresh request if any.
+		// The provider must make sure that they were originally granted.
+		Resources []string
+		// Audience lists the audience of the access token, one value per resource server
+		// listed in Resources.
+		Audience []string
+		// AccessTokenLifetime is the access token lifetime set by the resource servers
+		// listed in Resources, zero if the provider default lifetime applies.
+		AccessTokenLifetime time.Duration
+		// CheckResourceScope makes sure that each token of the given scope is accepted by
+		// at least one of the resource servers listed in Resources. It is nil if there
+		// are no resource indicators, the provider must call it with the scope of the new
+		// access token otherwise.
+		CheckResourceScope func(scope string) error
+		// DPoPJKT is the JWK SHA-256 thumbprint of the key used to sign the DPoP proof of
+		// the request if any. The access token must be bound to the key. The refresh
+		// tokens of public clients are bound to the key used in the initial token
+		// request, see https://tools.ietf.org/html/rfc9449#section-5
+		DPoPJKT string
+	}
+)
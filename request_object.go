@@ -0,0 +1,312 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goadesign/oauth2/app"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// maxRequestObjectSize is the maximum size of the request objects retrieved by
+// NewHTTPRequestObjectFetcher.
+const maxRequestObjectSize = 64 << 10
+
+type (
+	// RequestObjectFetcher retrieves the request objects that clients pass by reference with
+	// the "request_uri" parameter, see https://tools.ietf.org/html/rfc9101#section-5.2
+	RequestObjectFetcher interface {
+		// FetchRequestObject returns the request object located at the given URI.
+		FetchRequestObject(ctx context.Context, uri string) (string, error)
+	}
+
+	// RequestObjectFetcherFunc is a function that implements RequestObjectFetcher.
+	RequestObjectFetcherFunc func(ctx context.Context, uri string) (string, error)
+
+	// httpRequestObjectFetcher is a RequestObjectFetcher that retrieves request objects with
+	// HTTP requests.
+	httpRequestObjectFetcher struct {
+		client *http.Client
+	}
+
+	// requestOrigin describes how the parameters of an authorization request were received.
+	requestOrigin struct {
+		// pushed is true if the parameters come from a pushed authorization request.
+		pushed bool
+		// signed is true if the parameters come from a signed request object.
+		signed bool
+	}
+)
+
+// FetchRequestObject calls f.
+func (f RequestObjectFetcherFunc) FetchRequestObject(ctx context.Context, uri string) (string, error) {
+	return f(ctx, uri)
+}
+
+// NewHTTPRequestObjectFetcher creates a RequestObjectFetcher that retrieves request objects from
+// https URIs using the given HTTP client, http.DefaultClient if nil.
+func NewHTTPRequestObjectFetcher(client *http.Client) RequestObjectFetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpRequestObjectFetcher{client: client}
+}
+
+// WithRequestObjects enables JWT-secured authorization requests as described in
+// https://tools.ietf.org/html/rfc9101. Authorization requests may then include a signed request
+// object with the "request" parameter or, if fetcher is not nil, reference one registered by the
+// client with the "request_uri" parameter, see Client.RequestURIs. Request objects must be signed
+// with one of the keys of the client, see Client.JWKS, and must include the "exp" claim and the
+// controller issuer in the "aud" claim. Request objects may also be encrypted with one of the
+// given decryption keys. Each request object can only be used once, see
+// WithRequestObjectReplayCache. JWT-secured authorization requests require a client registry
+// and an issuer, see WithClientRegistry and WithIssuer.
+func WithRequestObjects(fetcher RequestObjectFetcher, decryptionKeys ...jose.JSONWebKey) ProviderOption {
+	return func(c *ProviderController) {
+		c.requestObjects = true
+		c.fetcher = fetcher
+		c.decryptionKeys = decryptionKeys
+		if c.requestReplay == nil {
+			c.requestReplay = NewMemoryReplayCache()
+		}
+	}
+}
+
+// WithRequestObjectReplayCache sets the cache used to reject request objects that were already
+// used. The identifier of a request object is its "jti" claim if any, the hash of the request
+// object otherwise. The cache defaults to an in-memory cache which is only suitable for single
+// node deployments.
+func WithRequestObjectReplayCache(r ReplayCache) ProviderOption {
+	return func(c *ProviderController) {
+		c.requestReplay = r
+	}
+}
+
+// FetchRequestObject implements RequestObjectFetcher.
+func (f *httpRequestObjectFetcher) FetchRequestObject(ctx context.Context, uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("request URI %q does not use https", uri)
+	}
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/oauth-authz-req+jwt")
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request URI %q returned status %d", uri, resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxRequestObjectSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(b) > maxRequestObjectSize {
+		return "", fmt.Errorf("request object at %q is too large", uri)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// requestObjectParams returns the parameters of the request object passed by value with the
+// "request" parameter or by reference with the "request_uri" parameter of the given
+// authorization request parameters. The request object must be signed by the client identified
+// by the "client_id" parameter and request objects passed by reference must be located at one of
+// the client registered request URIs. Only the parameters of the request object are used, the
+// other parameters of the authorization request are ignored.
+func (c *ProviderController) requestObjectParams(ctx context.Context, query url.Values) (url.Values, *app.OAuth2ErrorMedia, error) {
+	if !c.requestObjects || c.clients == nil || c.issuer == "" {
+		return nil, RequestObjectNotSupported, nil
+	}
+	var (
+		clientID = query.Get("client_id")
+		request  = query.Get("request")
+		uri      = query.Get("request_uri")
+	)
+	if clientID == "" {
+		return nil, MissingClientID, nil
+	}
+	if request != "" && uri != "" {
+		return nil, MixedRequestObject, nil
+	}
+	if uri != "" && c.fetcher == nil {
+		return nil, RequestURINotSupported, nil
+	}
+
+	// Load client keys
+	client, err := c.clients.Client(ctx, clientID)
+	if err == ErrClientNotFound {
+		return nil, UnknownClient, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if client.JWKS == nil || len(client.JWKS.Keys) == 0 {
+		return nil, InvalidRequestObject, nil
+	}
+
+	// Retrieve request object passed by reference from a registered URI only so that the
+	// controller cannot be used to send requests to arbitrary URIs
+	if uri != "" {
+		if !client.MatchRequestURI(uri) {
+			return nil, InvalidRequestURI, nil
+		}
+		if request, err = c.fetcher.FetchRequestObject(ctx, uri); err != nil {
+			return nil, InvalidRequestURI, nil
+		}
+	}
+
+	// Decrypt and verify request object
+	if strings.Count(request, ".") == 4 {
+		if request, err = c.decryptRequestObject(request); err != nil {
+			return nil, InvalidRequestObject, nil
+		}
+	}
+	var (
+		claims jwt.Claims
+		values map[string]interface{}
+	)
+	if err := verifyJWT(request, client.JWKS, &claims, &values); err != nil {
+		return nil, InvalidRequestObject, nil
+	}
+
+	// Validate request object claims
+	now := time.Now()
+	if claims.Expiry == nil || len(claims.Audience) == 0 {
+		return nil, InvalidRequestObject, nil
+	}
+	if err := claims.Validate(jwt.Expected{Audience: jwt.Audience{c.issuer}, Time: now}); err != nil {
+		return nil, InvalidRequestObject, nil
+	}
+	if claims.Issuer != "" && claims.Issuer != clientID {
+		return nil, InvalidRequestObject, nil
+	}
+	if id, _ := values["client_id"].(string); id != clientID {
+		return nil, InvalidRequestObject, nil
+	}
+
+	// Reject replayed request objects
+	id := claims.ID
+	if id == "" {
+		h := sha256.Sum256([]byte(request))
+		id = base64.RawURLEncoding.EncodeToString(h[:])
+	}
+	fresh, err := c.requestReplay.Use("request:"+clientID+":"+id, claims.Expiry.Time().Add(jwt.DefaultLeeway))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !fresh {
+		return nil, InvalidRequestObject, nil
+	}
+
+	// Convert claims into request parameters
+	params := url.Values{}
+	for name, v := range values {
+		switch name {
+		case "iss", "aud", "exp", "nbf", "iat", "jti", "sub":
+			continue
+		case "request", "request_uri":
+			return nil, InvalidRequestObject, nil
+		}
+		vs, err := claimParam(v)
+		if err != nil {
+			return nil, InvalidRequestObject, nil
+		}
+		params[name] = vs
+	}
+
+	return params, nil, nil
+}
+
+// claimParam converts the value of a request object claim into request parameter values. Strings,
+// numbers and booleans are converted to a single value, arrays of strings to multiple values and
+// other values to their JSON encoding, e.g. "authorization_details" or "claims".
+func claimParam(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case []interface{}:
+		vs := make([]string, len(v))
+		for i, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				vs = nil
+				break
+			}
+			vs[i] = s
+		}
+		if vs != nil {
+			return vs, nil
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return []string{string(b)}, nil
+}
+
+// decryptRequestObject decrypts the given encrypted request object with the decryption key
+// identified by its "kid" header or, if it has none, with the first key that succeeds.
+func (c *ProviderController) decryptRequestObject(request string) (string, error) {
+	enc, err := jose.ParseEncrypted(request)
+	if err != nil {
+		return "", err
+	}
+	for _, k := range c.decryptionKeys {
+		if enc.Header.KeyID != "" && k.KeyID != enc.Header.KeyID {
+			continue
+		}
+		if b, err := enc.Decrypt(k); err == nil {
+			return string(b), nil
+		}
+	}
+	return "", errors.New("no decryption key")
+}
+
+// verifyJWT verifies the signature of the given compact JWS with the key of the given set
+// identified by its "kid" header or, if it has none, with the first key that succeeds. It then
+// decodes the claims into dest.
+func verifyJWT(token string, keys *jose.JSONWebKeySet, dest ...interface{}) error {
+	tok, err := jwt.ParseSigned(token)
+	if err != nil {
+		return err
+	}
+	if len(tok.Headers) != 1 {
+		return errors.New("JWT must have exactly one signature")
+	}
+	h := tok.Headers[0]
+	for _, k := range keys.Keys {
+		if h.KeyID != "" && k.KeyID != h.KeyID {
+			continue
+		}
+		if (k.Use != "" && k.Use != "sig") || (k.Algorithm != "" && k.Algorithm != h.Algorithm) {
+			continue
+		}
+		if err := tok.Claims(k.Key, dest...); err == nil {
+			return nil
+		}
+	}
+	return errors.New("invalid JWT signature")
+}
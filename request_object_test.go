@@ -0,0 +1,162 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const testIssuer = "https://auth.example.com"
+
+// newRequestObjectController creates a controller that accepts the request objects signed with
+// the returned signer by the "client" client.
+func newRequestObjectController(t *testing.T, fetcher RequestObjectFetcher) (*ProviderController, jose.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{
+		ID:           "client",
+		RedirectURIs: []string{"https://client.example.com/cb"},
+		JWKS:         &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, Algorithm: "ES256", Use: "sig"}}},
+		RequestURIs:  []string{"https://client.example.com/request.jwt"},
+	}
+	c := &ProviderController{}
+	opts := []ProviderOption{
+		WithClientRegistry(NewMemoryClientRegistry(client)),
+		WithIssuer(testIssuer),
+		WithRequestObjects(fetcher),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, signer
+}
+
+// signRequestObject returns a request object signed with the given signer.
+func signRequestObject(t *testing.T, signer jose.Signer, claims map[string]interface{}) string {
+	request, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+func TestRequestObjectClaims(t *testing.T) {
+	exp := time.Now().Add(time.Minute).Unix()
+	cases := []struct {
+		Name   string
+		Claims map[string]interface{}
+		Valid  bool
+	}{
+		{"valid", map[string]interface{}{"client_id": "client", "aud": testIssuer, "exp": exp}, true},
+		{"missing exp", map[string]interface{}{"client_id": "client", "aud": testIssuer}, false},
+		{"expired", map[string]interface{}{"client_id": "client", "aud": testIssuer, "exp": time.Now().Add(-time.Hour).Unix()}, false},
+		{"missing aud", map[string]interface{}{"client_id": "client", "exp": exp}, false},
+		{"wrong aud", map[string]interface{}{"client_id": "client", "aud": "https://other.example.com", "exp": exp}, false},
+		{"wrong client", map[string]interface{}{"client_id": "other", "aud": testIssuer, "exp": exp}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c, signer := newRequestObjectController(t, nil)
+			query := url.Values{"client_id": {"client"}, "request": {signRequestObject(t, signer, tc.Claims)}}
+			_, m, err := c.requestObjectParams(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.Valid && m != nil {
+				t.Errorf("got error %q, expected none", m.Error)
+			}
+			if !tc.Valid && m == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestRequestObjectReplay(t *testing.T) {
+	c, signer := newRequestObjectController(t, nil)
+	exp := time.Now().Add(time.Minute).Unix()
+	for _, claims := range []map[string]interface{}{
+		{"client_id": "client", "aud": testIssuer, "exp": exp, "jti": "request-1"},
+		{"client_id": "client", "aud": testIssuer, "exp": exp, "scope": "openid"},
+	} {
+		query := url.Values{"client_id": {"client"}, "request": {signRequestObject(t, signer, claims)}}
+		if _, m, err := c.requestObjectParams(context.Background(), query); err != nil || m != nil {
+			t.Fatalf("got %v, %v for the first use, expected no error", m, err)
+		}
+		if _, m, err := c.requestObjectParams(context.Background(), query); err != nil || m == nil {
+			t.Errorf("got %v, %v for a replay, expected an error", m, err)
+		}
+	}
+}
+
+func TestRequestObjectURIRegistration(t *testing.T) {
+	var fetched []string
+	fetcher := RequestObjectFetcherFunc(func(ctx context.Context, uri string) (string, error) {
+		fetched = append(fetched, uri)
+		return "", fmt.Errorf("not found")
+	})
+	c, _ := newRequestObjectController(t, fetcher)
+	for _, uri := range []string{"https://attacker.example.com/request.jwt", "https://client.example.com/request.jwt"} {
+		query := url.Values{"client_id": {"client"}, "request_uri": {uri}}
+		if _, m, err := c.requestObjectParams(context.Background(), query); err != nil || m == nil {
+			t.Errorf("%s: got %v, %v, expected an error", uri, m, err)
+		}
+	}
+	if len(fetched) != 1 || fetched[0] != "https://client.example.com/request.jwt" {
+		t.Errorf("fetched %v, expected only the registered request URI", fetched)
+	}
+}
+
+func TestHTTPRequestObjectFetcher(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/request.jwt":
+			if accept := req.Header.Get("Accept"); accept != "application/oauth-authz-req+jwt" {
+				t.Errorf("got Accept header %q", accept)
+			}
+			fmt.Fprintln(rw, "header.payload.signature")
+		case "/large.jwt":
+			rw.Write([]byte(strings.Repeat("a", maxRequestObjectSize+1)))
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer srv.Close()
+	f := NewHTTPRequestObjectFetcher(srv.Client())
+	ctx := context.Background()
+
+	request, err := f.FetchRequestObject(ctx, srv.URL+"/request.jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request != "header.payload.signature" {
+		t.Errorf("got request object %q, expected %q", request, "header.payload.signature")
+	}
+	invalid := []string{
+		srv.URL + "/missing.jwt",
+		srv.URL + "/large.jwt",
+		strings.Replace(srv.URL, "https://", "http://", 1) + "/request.jwt",
+	}
+	for _, uri := range invalid {
+		if _, err := f.FetchRequestObject(ctx, uri); err == nil {
+			t.Errorf("%s: expected an error", uri)
+		}
+	}
+}
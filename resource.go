@@ -0,0 +1,200 @@
+package oauth2
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// identityScopes lists the OpenID Connect scopes that target the authorization server itself
+// rather than a resource server. They are accepted regardless of the requested resources.
+var identityScopes = NewScopeSet("openid", "profile", "email", "address", "phone", "offline_access")
+
+type (
+	// ResourceServers records the resource servers known to the authorization server. Clients
+	// select the resource servers where they intend to use an access token with the "resource"
+	// parameter described in https://tools.ietf.org/html/rfc8707.
+	ResourceServers struct {
+		lock    sync.RWMutex
+		servers map[string]*ResourceServer
+	}
+
+	// ResourceServer describes a registered resource server.
+	ResourceServer struct {
+		// URI is the resource indicator of the resource server, an absolute URI with no
+		// fragment.
+		URI string
+		// Audience is the audience of the access tokens issued for the resource server,
+		// it defaults to URI.
+		Audience string
+		// Scopes lists the scopes accepted by the resource server, it accepts any scope if
+		// empty. Scopes ending with "*" are wildcard patterns, see ScopeRegistry.
+		Scopes []string
+		// AccessTokenLifetime is the lifetime of the access tokens issued for the resource
+		// server, the provider default lifetime applies if zero.
+		AccessTokenLifetime time.Duration
+	}
+
+	// resourceTarget describes the validated resource servers of a request.
+	resourceTarget struct {
+		// resources lists the requested resource indicators.
+		resources []string
+		// audience lists the audiences of the requested resource servers.
+		audience []string
+		// lifetime is the shortest access token lifetime of the requested resource
+		// servers, zero if none of them has one.
+		lifetime time.Duration
+	}
+)
+
+// NewResourceServers creates an empty resource server registry.
+func NewResourceServers() *ResourceServers {
+	return &ResourceServers{servers: make(map[string]*ResourceServer)}
+}
+
+// WithResourceServers enables resource indicators as described in
+// https://tools.ietf.org/html/rfc8707. The "resource" parameters of authorization and token
+// requests must identify resource servers registered in the given registry and the requested
+// scope must be accepted by at least one of them. The resources, the audience and the access
+// token lifetime that follow are passed to the provider, see AuthorizationRequest.Resources.
+// Requests with resource indicators are rejected if no registry is configured.
+func WithResourceServers(r *ResourceServers) ProviderOption {
+	return func(c *ProviderController) {
+		c.resources = r
+	}
+}
+
+// Register registers the given resource server. Registering a resource server that already
+// exists overrides its definition.
+func (r *ResourceServers) Register(s *ResourceServer) error {
+	u, err := url.Parse(s.URI)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return fmt.Errorf("resource indicator %q must be an absolute URI with no fragment", s.URI)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.servers[s.URI] = s
+	return nil
+}
+
+// ResourceServer returns the resource server with the given resource indicator, nil if there is
+// none.
+func (r *ResourceServers) ResourceServer(uri string) *ResourceServer {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.servers[uri]
+}
+
+// URIs returns the sorted resource indicators of all the registered resource servers.
+func (r *ResourceServers) URIs() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	uris := make([]string, 0, len(r.servers))
+	for u := range r.servers {
+		uris = append(uris, u)
+	}
+	sort.Strings(uris)
+	return uris
+}
+
+// TokenAudience returns the audience of the access tokens issued for the resource server.
+func (s *ResourceServer) TokenAudience() string {
+	if s.Audience != "" {
+		return s.Audience
+	}
+	return s.URI
+}
+
+// accepts returns true if the resource server accepts the given scope token.
+func (s *ResourceServer) accepts(token string) bool {
+	return len(s.Scopes) == 0 || scopeSatisfied(NewScopeSet(s.Scopes...), token)
+}
+
+// resourceTarget validates the given resource indicators against the resource server registry
+// and makes sure that each token of the given scope is accepted by at least one of the resource
+// servers. It returns nil if there are no resource indicators.
+func (c *ProviderController) resourceTarget(resources []string, scope string) (*resourceTarget, error) {
+	if len(resources) == 0 {
+		return nil, nil
+	}
+	if c.resources == nil {
+		return nil, NewError(ErrInvalidTarget, "resource indicators are not supported", "")
+	}
+	var (
+		t       = &resourceTarget{}
+		servers = make([]*ResourceServer, 0, len(resources))
+	)
+	for _, r := range resources {
+		u, err := url.Parse(r)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return nil, NewError(ErrInvalidTarget, "resource must be an absolute URI with no fragment", "")
+		}
+		s := c.resources.ResourceServer(r)
+		if s == nil {
+			return nil, NewError(ErrInvalidTarget, fmt.Sprintf("unknown resource %q", r), "")
+		}
+		servers = append(servers, s)
+		t.resources = append(t.resources, r)
+		t.audience = append(t.audience, s.TokenAudience())
+		if s.AccessTokenLifetime > 0 && (t.lifetime == 0 || s.AccessTokenLifetime < t.lifetime) {
+			t.lifetime = s.AccessTokenLifetime
+		}
+	}
+	requested, err := ParseScope(scope)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range requested {
+		if identityScopes.Contains(token) {
+			continue
+		}
+		accepted := false
+		for _, s := range servers {
+			accepted = accepted || s.accepts(token)
+		}
+		if !accepted {
+			return nil, NewError(ErrInvalidScope, fmt.Sprintf("scope %q is not accepted by the requested resources", token), "")
+		}
+	}
+	return t, nil
+}
+
+// checkScope returns a function that makes sure that each token of a scope is accepted by at
+// least one of the target resource servers, nil if there are no resource indicators. Providers
+// call it when token requests narrow down the resources of the original grant.
+func (t *resourceTarget) checkScope(c *ProviderController) func(string) error {
+	if t == nil || len(t.resources) == 0 {
+		return nil
+	}
+	return func(scope string) error {
+		_, err := c.resourceTarget(t.resources, scope)
+		return err
+	}
+}
+
+// narrowCodeGrant restricts the resources of the given stateless code grant to the given resource
+// indicators requested in the token request if any. It makes sure that the scope of the grant
+// is accepted by the remaining resource servers then sets the audience and access token lifetime
+// of the grant from the resource server registry.
+func (c *ProviderController) narrowCodeGrant(g *CodeGrant, resources []string) error {
+	for _, r := range resources {
+		found := false
+		for _, gr := range g.Resources {
+			found = found || r == gr
+		}
+		if !found {
+			return NewError(ErrInvalidTarget, fmt.Sprintf("resource %q was not requested in the authorization request", r), "")
+		}
+	}
+	if len(resources) > 0 {
+		g.Resources = resources
+	}
+	t, err := c.resourceTarget(g.Resources, g.Scope)
+	if err != nil || t == nil {
+		return err
+	}
+	g.Audience, g.AccessTokenLifetime = t.audience, t.lifetime
+	return nil
+}
@@ -0,0 +1,105 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/goadesign/oauth2/app"
+)
+
+// newResourceController creates a controller with a billing and an admin resource server.
+func newResourceController(t *testing.T, p Provider) *ProviderController {
+	rs := NewResourceServers()
+	for _, s := range []*ResourceServer{
+		{URI: "https://billing.example.com", Scopes: []string{"billing:*"}},
+		{URI: "https://admin.example.com", Audience: "admin", Scopes: []string{"admin"}, AccessTokenLifetime: 5 * time.Minute},
+	} {
+		if err := rs.Register(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewProviderController(newTestService(), p, WithResourceServers(rs))
+}
+
+func TestResourcesRequireRequestAuthorizer(t *testing.T) {
+	params := url.Values{
+		"client_id":     {"client"},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://client.example.com/cb"},
+		"resource":      {"https://billing.example.com"},
+	}
+	c := newResourceController(t, struct{ Provider }{})
+	if _, m, err := c.validateAuthorization(context.Background(), params, requestOrigin{}); err != nil || m == nil || m.Error != string(ErrInvalidTarget) {
+		t.Errorf("got %v, %v, expected an %q error", m, err, ErrInvalidTarget)
+	}
+	c = newResourceController(t, requestAuthorizer{})
+	a, m, err := c.validateAuthorization(context.Background(), params, requestOrigin{})
+	if err != nil || m != nil {
+		t.Fatalf("got %v, %v, expected no error", m, err)
+	}
+	if len(a.request.Resources) != 1 || a.request.Audience[0] != "https://billing.example.com" {
+		t.Errorf("got resources %v and audience %v", a.request.Resources, a.request.Audience)
+	}
+}
+
+func TestNarrowCodeGrant(t *testing.T) {
+	c := newResourceController(t, struct{ Provider }{})
+	resources := []string{"https://billing.example.com", "https://admin.example.com"}
+
+	g := &CodeGrant{Scope: "billing:read admin", Resources: resources}
+	if err := c.narrowCodeGrant(g, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Audience) != 2 || g.AccessTokenLifetime != 5*time.Minute {
+		t.Errorf("got audience %v and lifetime %v", g.Audience, g.AccessTokenLifetime)
+	}
+
+	g = &CodeGrant{Scope: "billing:read admin", Resources: resources}
+	if err := c.narrowCodeGrant(g, []string{"https://billing.example.com"}); err == nil {
+		t.Error("expected an error when the remaining resources do not accept the granted scope")
+	}
+
+	g = &CodeGrant{Scope: "billing:read", Resources: resources}
+	if err := c.narrowCodeGrant(g, []string{"https://billing.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Resources) != 1 || g.AccessTokenLifetime != 0 {
+		t.Errorf("got resources %v and lifetime %v", g.Resources, g.AccessTokenLifetime)
+	}
+
+	g = &CodeGrant{Scope: "billing:read", Resources: resources[:1]}
+	if err := c.narrowCodeGrant(g, resources[1:]); err == nil {
+		t.Error("expected an error when requesting a resource that was not authorized")
+	}
+}
+
+func TestExchangeTokenResources(t *testing.T) {
+	p := &tokenExchanger{token: &ExchangedToken{Token: "token"}}
+	payload := func(resource string) *app.TokenPayload {
+		return &app.TokenPayload{
+			SubjectToken:     str("subject"),
+			SubjectTokenType: str(AccessTokenType),
+			Scope:            str("admin"),
+			Resource:         []string{resource},
+		}
+	}
+
+	c := NewProviderController(newTestService(), p)
+	if code, body := exchangeTestToken(t, c, payload("https://admin.example.com")); code != http.StatusBadRequest || body["error"] != string(ErrInvalidTarget) {
+		t.Errorf("got status %d and body %v without a registry, expected an %q error", code, body, ErrInvalidTarget)
+	}
+
+	c = newResourceController(t, p)
+	if code, body := exchangeTestToken(t, c, payload("https://other.example.com")); code != http.StatusBadRequest || body["error"] != string(ErrInvalidTarget) {
+		t.Errorf("got status %d and body %v for an unknown resource, expected an %q error", code, body, ErrInvalidTarget)
+	}
+	if code, body := exchangeTestToken(t, c, payload("https://admin.example.com")); code != http.StatusOK {
+		t.Fatalf("got status %d and body %v", code, body)
+	}
+	if len(p.req.ResourceAudience) != 1 || p.req.ResourceAudience[0] != "admin" || p.req.AccessTokenLifetime != 5*time.Minute {
+		t.Errorf("got audience %v and lifetime %v", p.req.ResourceAudience, p.req.AccessTokenLifetime)
+	}
+}
@@ -0,0 +1,206 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/goadesign/oauth2/app"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// DefaultResponseJWTLifetime is the lifetime of the JWTs sent by the JWT response modes.
+const DefaultResponseJWTLifetime = 10 * time.Minute
+
+// Response modes defined by
+// https://openid.net/specs/oauth-v2-multiple-response-types-1_0.html#ResponseModes,
+// https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html and
+// https://openid.net/specs/oauth-v2-jarm.html
+const (
+	// ResponseModeQuery encodes the authorization response parameters in the query string of
+	// the redirect URI. It is the default response mode for the "code" response type.
+	ResponseModeQuery = "query"
+
+	// ResponseModeFragment encodes the authorization response parameters in the fragment of
+	// the redirect URI.
+	ResponseModeFragment = "fragment"
+
+	// ResponseModeFormPost sends the authorization response parameters to the redirect URI
+	// with an auto-submitting HTML form that uses the POST method.
+	ResponseModeFormPost = "form_post"
+
+	// ResponseModeQueryJWT sends the authorization response parameters in a signed JWT in
+	// the "response" parameter of the redirect URI query string.
+	ResponseModeQueryJWT = "query.jwt"
+
+	// ResponseModeFragmentJWT sends the authorization response parameters in a signed JWT
+	// in the "response" parameter of the redirect URI fragment.
+	ResponseModeFragmentJWT = "fragment.jwt"
+
+	// ResponseModeFormPostJWT sends the authorization response parameters in a signed JWT
+	// in the "response" parameter of an auto-submitting HTML form.
+	ResponseModeFormPostJWT = "form_post.jwt"
+
+	// ResponseModeJWT is ResponseModeQueryJWT for the "code" response type and
+	// ResponseModeFragmentJWT for response types that include tokens.
+	ResponseModeJWT = "jwt"
+)
+
+// formPostTemplate is the template of the HTML page returned when using the form_post response
+// mode.
+var formPostTemplate = template.Must(template.New("form_post").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Submit This Form</title></head>
+<body onload="javascript:document.forms[0].submit()">
+<form method="post" action="{{ .Action }}">
+{{- range $name, $values := .Params }}{{ range $values }}
+<input type="hidden" name="{{ $name }}" value="{{ . }}"/>
+{{- end }}{{ end }}
+<noscript><input type="submit" value="Continue"/></noscript>
+</form>
+</body>
+</html>
+`))
+
+// validResponseMode returns true if the given response mode is supported.
+func validResponseMode(mode string) bool {
+	switch mode {
+	case ResponseModeQuery, ResponseModeFragment, ResponseModeFormPost:
+		return true
+	case ResponseModeQueryJWT, ResponseModeFragmentJWT, ResponseModeFormPostJWT, ResponseModeJWT:
+		return true
+	}
+	return false
+}
+
+// isJWTResponseMode returns true if the given response mode sends the response parameters in a
+// JWT.
+func isJWTResponseMode(mode string) bool {
+	return mode == ResponseModeJWT || strings.HasSuffix(mode, ".jwt")
+}
+
+// redirect sends the given authorization response parameters to the redirect URI of the given
+// authorization request using its response mode. The JWT response modes wrap the parameters in
+// a JWT signed with the controller signing keys and optionally encrypted with the client key.
+// The other response modes add the "iss" parameter described in
+// https://tools.ietf.org/html/rfc9207#section-2 if the controller has an issuer, the JWT
+// already includes it as a claim.
+func (c *ProviderController) redirect(ctx context.Context, rw http.ResponseWriter, a *authorization, params url.Values) error {
+	var (
+		u    = a.redirectURI
+		mode = a.responseMode
+	)
+	if isJWTResponseMode(mode) {
+		response, err := c.responseJWT(a, params)
+		if err != nil {
+			return err
+		}
+		params = url.Values{"response": {response}}
+		mode = strings.TrimSuffix(mode, ".jwt")
+	} else if c.issuer != "" {
+		params.Set("iss", c.issuer)
+	}
+	switch mode {
+	case ResponseModeFragment:
+		dest := *u
+		dest.Fragment = ""
+		rw.Header().Set("Location", dest.String()+"#"+params.Encode())
+	case ResponseModeFormPost:
+		rw.Header().Set("Content-Type", "text/html;charset=UTF-8")
+		rw.Header().Set("Cache-Control", "no-store")
+		rw.Header().Set("Pragma", "no-cache")
+		rw.WriteHeader(http.StatusOK)
+		return formPostTemplate.Execute(rw, struct {
+			Action template.URL
+			Params url.Values
+		}{formAction(u), params})
+	default:
+		dest := *u
+		q := dest.Query()
+		for k, vs := range params {
+			q[k] = vs
+		}
+		dest.RawQuery = q.Encode()
+		rw.Header().Set("Location", dest.String())
+	}
+
+	return c.Service.Send(ctx, http.StatusFound, nil)
+}
+
+// formAction returns the given validated redirect URI as the action of the form_post page.
+// html/template replaces URLs that do not use the http, https or mailto schemes with
+// "#ZgotmplZ" which would break the private-use URI schemes of native apps. Redirect URIs
+// using other schemes may not be safe to render and are replaced the same way.
+func formAction(u *url.URL) template.URL {
+	if u.Scheme == "http" || u.Scheme == "https" || isPrivateUseScheme(u) {
+		return template.URL(u.String())
+	}
+	return template.URL("#ZgotmplZ")
+}
+
+// redirectError sends the given error to the redirect URI of the given authorization request
+// using its response mode as described in https://tools.ietf.org/html/rfc6749#section-4.1.2.1
+func (c *ProviderController) redirectError(ctx context.Context, rw http.ResponseWriter, a *authorization, m *app.OAuth2ErrorMedia) error {
+	params := url.Values{"error": {m.Error}}
+	if m.ErrorDescription != nil {
+		params.Set("error_description", *m.ErrorDescription)
+	}
+	if m.ErrorURI != nil {
+		params.Set("error_uri", *m.ErrorURI)
+	}
+	if a.request.State != "" {
+		params.Set("state", a.request.State)
+	}
+	return c.redirect(ctx, rw, a, params)
+}
+
+// responseJWT returns the JWT containing the given authorization response parameters as
+// described in https://openid.net/specs/oauth-v2-jarm.html#section-2.1 The JWT is encrypted
+// if the client registered a response encryption algorithm.
+func (c *ProviderController) responseJWT(a *authorization, params url.Values) (string, error) {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": c.issuer,
+		"aud": a.request.ClientID,
+		"exp": now.Add(DefaultResponseJWTLifetime).Unix(),
+	}
+	for k := range params {
+		claims[k] = params.Get(k)
+	}
+	token, err := c.keys.sign(claims)
+	if err != nil {
+		return "", err
+	}
+	if a.client == nil || a.client.ResponseEncryptionAlg == "" {
+		return token, nil
+	}
+	return encryptJWT(token, a.client, a.client.ResponseEncryptionAlg, a.client.ResponseEncryptionEnc)
+}
+
+// encryptJWT encrypts the given signed JWT with the client encryption key for the given
+// algorithm, the content encryption algorithm defaults to A128CBC-HS256.
+func encryptJWT(token string, client *Client, alg, enc string) (string, error) {
+	key := client.encryptionKey(alg)
+	if key == nil {
+		return "", fmt.Errorf("client %q has no %s encryption key", client.ID, alg)
+	}
+	if enc == "" {
+		enc = string(jose.A128CBC_HS256)
+	}
+	encrypter, err := jose.NewEncrypter(
+		jose.ContentEncryption(enc),
+		jose.Recipient{Algorithm: jose.KeyAlgorithm(alg), Key: key.Key, KeyID: key.KeyID},
+		(&jose.EncrypterOptions{}).WithType("JWT").WithContentType("JWT"))
+	if err != nil {
+		return "", err
+	}
+	jwe, err := encrypter.Encrypt([]byte(token))
+	if err != nil {
+		return "", err
+	}
+	return jwe.CompactSerialize()
+}
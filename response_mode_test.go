@@ -0,0 +1,248 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"html"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// responseJWTClaims are the claims of the JWTs sent by the JWT response modes.
+type responseJWTClaims struct {
+	Issuer           string `json:"iss"`
+	Audience         string `json:"aud"`
+	Expiry           int64  `json:"exp"`
+	Code             string `json:"code"`
+	State            string `json:"state"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// formPostInput matches the hidden inputs of the form_post response mode page.
+var formPostInput = regexp.MustCompile(`<input type="hidden" name="([^"]+)" value="([^"]*)"/>`)
+
+// jarmParams returns the parameters of an authorization request made by the "client" client
+// with the given response type and mode.
+func jarmParams(responseType, mode string) url.Values {
+	return url.Values{
+		"client_id":     {"client"},
+		"response_type": {responseType},
+		"response_mode": {mode},
+		"redirect_uri":  {testRedirectURI},
+		"scope":         {"openid"},
+		"nonce":         {"nonce"},
+		"state":         {"state"},
+	}
+}
+
+func TestFormPostAction(t *testing.T) {
+	cases := map[string]string{
+		"https://client.example.com/cb": `action="https://client.example.com/cb"`,
+		"com.example.app://callback":    `action="com.example.app://callback"`,
+		"javascript://x/%0aalert(1)":    `action="#ZgotmplZ"`,
+	}
+	for uri, expected := range cases {
+		u, err := url.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			c   = &ProviderController{}
+			rec = httptest.NewRecorder()
+			a   = &authorization{redirectURI: u, responseMode: ResponseModeFormPost}
+		)
+		if err := c.redirect(context.Background(), rec, a, url.Values{"code": {"abc"}}); err != nil {
+			t.Fatal(err)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, expected) {
+			t.Errorf("%s: got page %s, expected %s", uri, body, expected)
+		}
+	}
+}
+
+func TestResponseJWT(t *testing.T) {
+	cases := []struct {
+		Name         string
+		ResponseType string
+		Code         string
+		Error        string
+	}{
+		{"success", "code", "code", ""},
+		{"error", "code token", "", string(ErrUnauthorizedClient)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := newImplicitController(t)
+			params := redirectParams(t, authorizeTest(t, c, jarmParams(tc.ResponseType, ResponseModeJWT)))
+			if len(params) != 1 {
+				t.Errorf("got parameters %v, expected the response JWT only", params)
+			}
+			var claims responseJWTClaims
+			if err := verifyJWT(params.Get("response"), c.keys.PublicKeys(), &claims); err != nil {
+				t.Fatal(err)
+			}
+			if claims.Issuer != testIssuer || claims.Audience != "client" || claims.State != "state" {
+				t.Errorf("got claims %+v, expected the issuer, client and state", claims)
+			}
+			if exp := time.Unix(claims.Expiry, 0); exp.Before(time.Now()) || exp.After(time.Now().Add(DefaultResponseJWTLifetime)) {
+				t.Errorf("got expiry %v, expected it within the JWT lifetime", exp)
+			}
+			if claims.Code != tc.Code || claims.Error != tc.Error {
+				t.Errorf("got code %q and error %q, expected %q and %q", claims.Code, claims.Error, tc.Code, tc.Error)
+			}
+			if tc.Error != "" && claims.ErrorDescription == "" {
+				t.Error("got no error description")
+			}
+		})
+	}
+}
+
+func TestJWTResponseModeDefaults(t *testing.T) {
+	cases := []struct {
+		ResponseType string
+		Mode         string
+		Expected     string
+		Error        bool
+	}{
+		{"code", ResponseModeJWT, ResponseModeQueryJWT, false},
+		{"code id_token", ResponseModeJWT, ResponseModeFragmentJWT, false},
+		{"id_token", ResponseModeJWT, ResponseModeFragmentJWT, false},
+		{"code", ResponseModeFormPostJWT, ResponseModeFormPostJWT, false},
+		{"code id_token", ResponseModeQueryJWT, ResponseModeFragmentJWT, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.ResponseType+" "+tc.Mode, func(t *testing.T) {
+			c := newImplicitController(t)
+			a, m, err := c.validateAuthorization(context.Background(), jarmParams(tc.ResponseType, tc.Mode), requestOrigin{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (m != nil) != tc.Error {
+				t.Errorf("got error %v", m)
+			}
+			if a == nil || a.responseMode != tc.Expected {
+				t.Errorf("got authorization %+v, expected response mode %q", a, tc.Expected)
+			}
+		})
+	}
+
+	c := NewProviderController(newTestService(), implicitAuthorizer{},
+		WithClientRegistry(NewMemoryClientRegistry(&Client{ID: "client", RedirectURIs: []string{testRedirectURI}})))
+	_, m, err := c.validateAuthorization(context.Background(), jarmParams("code", ResponseModeJWT), requestOrigin{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Error != InvalidResponseMode.Error {
+		t.Errorf("got error %v, expected JWT response modes to require signing keys", m)
+	}
+}
+
+func TestResponseJWTEncryption(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{
+		ID:                    "client",
+		RedirectURIs:          []string{testRedirectURI},
+		ResponseTypes:         []string{"code", "code id_token"},
+		JWKS:                  &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "enc", Use: "enc"}}},
+		ResponseEncryptionAlg: string(jose.RSA_OAEP_256),
+	}
+	c := newImplicitController(t, WithClientRegistry(NewMemoryClientRegistry(client)))
+
+	// Encrypted responses may carry tokens in the query string
+	params := redirectParams(t, authorizeTest(t, c, jarmParams("code id_token", ResponseModeQueryJWT)))
+	jwe, err := jose.ParseEncrypted(params.Get("response"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwe.Header.KeyID != "enc" || jwe.Header.Algorithm != string(jose.RSA_OAEP_256) || jwe.Header.ExtraHeaders["enc"] != string(jose.A128CBC_HS256) {
+		t.Errorf("got JWE header %+v, expected the client key and the default content encryption", jwe.Header)
+	}
+	signed, err := jwe.Decrypt(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims responseJWTClaims
+	if err := verifyJWT(string(signed), c.keys.PublicKeys(), &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Audience != "client" || claims.Code != "code" {
+		t.Errorf("got claims %+v, expected the code sent to the client", claims)
+	}
+
+	client.ResponseEncryptionAlg = string(jose.ECDH_ES)
+	if _, err := encryptJWT(string(signed), client, client.ResponseEncryptionAlg, ""); err == nil {
+		t.Error("got no error without a key for the encryption algorithm")
+	}
+}
+
+func TestIssuerResponseParameter(t *testing.T) {
+	cases := []struct {
+		Mode  string
+		Error bool
+	}{
+		{ResponseModeQuery, false},
+		{ResponseModeQuery, true},
+		{ResponseModeFragment, false},
+		{ResponseModeFragment, true},
+		{ResponseModeFormPost, false},
+		{ResponseModeFormPost, true},
+	}
+	for _, tc := range cases {
+		name := tc.Mode + " success"
+		if tc.Error {
+			name = tc.Mode + " error"
+		}
+		t.Run(name, func(t *testing.T) {
+			params := url.Values{
+				"client_id":     {"client"},
+				"response_type": {"code"},
+				"response_mode": {tc.Mode},
+				"redirect_uri":  {testRedirectURI},
+				"state":         {"state"},
+			}
+			if tc.Error {
+				params.Set("prompt", "none login")
+			}
+			rw := authorizeTest(t, newImplicitController(t), params)
+			var resp url.Values
+			if tc.Mode == ResponseModeFormPost {
+				resp = url.Values{}
+				for _, m := range formPostInput.FindAllStringSubmatch(rw.Body.String(), -1) {
+					resp.Set(m[1], html.UnescapeString(m[2]))
+				}
+			} else {
+				resp = redirectParams(t, rw)
+				if u, _ := url.Parse(rw.Header().Get("Location")); (u.Fragment != "") != (tc.Mode == ResponseModeFragment) {
+					t.Errorf("got redirect %s, expected the %s response mode", u, tc.Mode)
+				}
+			}
+			if resp.Get("iss") != testIssuer || resp.Get("state") != "state" {
+				t.Errorf("got response %v, expected the issuer and state", resp)
+			}
+			if tc.Error && resp.Get("error") != string(ErrInvalidRequest) {
+				t.Errorf("got response %v, expected an %q error", resp, ErrInvalidRequest)
+			}
+			if !tc.Error && resp.Get("code") != "code" {
+				t.Errorf("got response %v, expected the code", resp)
+			}
+		})
+	}
+
+	c := NewProviderController(newTestService(), implicitAuthorizer{},
+		WithClientRegistry(NewMemoryClientRegistry(&Client{ID: "client", RedirectURIs: []string{testRedirectURI}})))
+	params := redirectParams(t, authorizeTest(t, c, url.Values{"client_id": {"client"}, "response_type": {"code"}}))
+	if _, ok := params["iss"]; ok {
+		t.Errorf("got response %v, expected no issuer without one configured", params)
+	}
+}
@@ -0,0 +1,96 @@
+package oauth2
+
+import "strings"
+
+// Response type values defined by https://tools.ietf.org/html/rfc6749#section-3.1.1 and
+// https://openid.net/specs/oauth-v2-multiple-response-types-1_0.html. Authorization requests
+// may combine them in space-delimited lists such as "code id_token" in any order.
+const (
+	// ResponseTypeCode requests an authorization code.
+	ResponseTypeCode = "code"
+
+	// ResponseTypeToken requests an access token issued directly by the authorization
+	// endpoint (implicit grant).
+	ResponseTypeToken = "token"
+
+	// ResponseTypeIDToken requests an OpenID Connect ID token.
+	ResponseTypeIDToken = "id_token"
+)
+
+// responseType is a parsed response type.
+type responseType struct {
+	code, token, idToken bool
+}
+
+// parseResponseType parses a space-delimited list of response type values. It returns false if
+// the list is empty, contains an unknown value or repeats a value.
+func parseResponseType(s string) (responseType, bool) {
+	var rt responseType
+	values := strings.Fields(s)
+	if len(values) == 0 {
+		return rt, false
+	}
+	for _, v := range values {
+		var flag *bool
+		switch v {
+		case ResponseTypeCode:
+			flag = &rt.code
+		case ResponseTypeToken:
+			flag = &rt.token
+		case ResponseTypeIDToken:
+			flag = &rt.idToken
+		default:
+			return rt, false
+		}
+		if *flag {
+			return rt, false
+		}
+		*flag = true
+	}
+	return rt, true
+}
+
+// String returns the canonical representation of the response type.
+func (rt responseType) String() string {
+	var values []string
+	if rt.code {
+		values = append(values, ResponseTypeCode)
+	}
+	if rt.idToken {
+		values = append(values, ResponseTypeIDToken)
+	}
+	if rt.token {
+		values = append(values, ResponseTypeToken)
+	}
+	return strings.Join(values, " ")
+}
+
+// hasTokens returns true if the response type includes an access token or an ID token which
+// must not be sent in the redirect URI query string.
+func (rt responseType) hasTokens() bool {
+	return rt.token || rt.idToken
+}
+
+// isCode returns true if the response type is "code" alone.
+func (rt responseType) isCode() bool {
+	return rt == responseType{code: true}
+}
+
+// AllowsResponseType returns true if the client may use the given response type. Clients may
+// only use "code" unless ResponseTypes is set. The order of the values in the response types
+// does not matter.
+func (c *Client) AllowsResponseType(responseType string) bool {
+	rt, ok := parseResponseType(responseType)
+	if !ok {
+		return false
+	}
+	if len(c.ResponseTypes) == 0 {
+		return rt.isCode()
+	}
+	for _, allowed := range c.ResponseTypes {
+		if a, ok := parseResponseType(allowed); ok && a == rt {
+			return true
+		}
+	}
+	return false
+}
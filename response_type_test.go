@@ -0,0 +1,208 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/goadesign/goa"
+)
+
+// implicitAuthorizer is a provider that issues the "code" authorization code and the "access"
+// access token to all the requests, whether their response type asks for them or not.
+type implicitAuthorizer struct {
+	Provider
+}
+
+func (implicitAuthorizer) AuthorizeRequest(ctx context.Context, req *AuthorizationRequest) (string, error) {
+	return "code", nil
+}
+
+func (implicitAuthorizer) AuthorizeImplicit(ctx context.Context, req *AuthorizationRequest) (string, int, error) {
+	return "access", 3600, nil
+}
+
+// newImplicitController creates a controller that issues ID tokens to the "client" client
+// which may use all the response types.
+func newImplicitController(t *testing.T, opts ...ProviderOption) *ProviderController {
+	client := &Client{
+		ID:            "client",
+		RedirectURIs:  []string{testRedirectURI},
+		ResponseTypes: []string{"code", "token", "id_token", "code id_token", "id_token token", "code id_token token"},
+	}
+	opts = append([]ProviderOption{
+		WithClientRegistry(NewMemoryClientRegistry(client)),
+		WithIssuer(testIssuer),
+		WithSigningKeys(newTestSigningKeys(t)),
+	}, opts...)
+	return NewProviderController(newTestService(), implicitAuthorizer{}, opts...)
+}
+
+// authorizeTest sends an authorization request with the given parameters on behalf of the
+// "alice" resource owner.
+func authorizeTest(t *testing.T, c *ProviderController, params url.Values) *httptest.ResponseRecorder {
+	var (
+		rw  = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/oauth2/authorize?"+params.Encode(), nil)
+		ctx = goa.NewContext(WithSubject(context.Background(), "alice"), rw, req, nil)
+	)
+	if err := c.Authorize(ctx, rw, req); err != nil {
+		t.Fatal(err)
+	}
+	return rw
+}
+
+// redirectParams returns the parameters of the redirect sent in the given response, read from
+// the fragment or the query string.
+func redirectParams(t *testing.T, rw *httptest.ResponseRecorder) url.Values {
+	if rw.Code != http.StatusFound {
+		t.Fatalf("got status %d and body %s, expected a redirect", rw.Code, rw.Body)
+	}
+	u, err := url.Parse(rw.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Fragment != "" {
+		params, err := url.ParseQuery(u.Fragment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return params
+	}
+	return u.Query()
+}
+
+func TestParseResponseType(t *testing.T) {
+	cases := []struct {
+		Value     string
+		Canonical string
+		Valid     bool
+	}{
+		{"code", "code", true},
+		{"token", "token", true},
+		{"id_token", "id_token", true},
+		{"token id_token code", "code id_token token", true},
+		{" id_token  code ", "code id_token", true},
+		{"", "", false},
+		{"none", "", false},
+		{"code code", "", false},
+		{"code Token", "", false},
+	}
+	for _, tc := range cases {
+		rt, ok := parseResponseType(tc.Value)
+		if ok != tc.Valid {
+			t.Errorf("%q: got valid %v, expected %v", tc.Value, ok, tc.Valid)
+			continue
+		}
+		if ok && rt.String() != tc.Canonical {
+			t.Errorf("%q: got response type %q, expected %q", tc.Value, rt, tc.Canonical)
+		}
+	}
+}
+
+func TestAllowsResponseType(t *testing.T) {
+	var (
+		plain  = &Client{ID: "plain"}
+		hybrid = &Client{ID: "hybrid", ResponseTypes: []string{"code", "code id_token", "invalid"}}
+	)
+	cases := []struct {
+		Client       *Client
+		ResponseType string
+		Allowed      bool
+	}{
+		{plain, "code", true},
+		{plain, "token", false},
+		{plain, "code id_token", false},
+		{hybrid, "code", true},
+		{hybrid, "id_token code", true},
+		{hybrid, "id_token", false},
+		{hybrid, "code id_token token", false},
+		{hybrid, "invalid", false},
+		{hybrid, "code code", false},
+	}
+	for _, tc := range cases {
+		if allowed := tc.Client.AllowsResponseType(tc.ResponseType); allowed != tc.Allowed {
+			t.Errorf("%s client and %q: got %v, expected %v", tc.Client.ID, tc.ResponseType, allowed, tc.Allowed)
+		}
+	}
+}
+
+func TestTokenHash(t *testing.T) {
+	// The SHA-256 values are the examples of
+	// https://openid.net/specs/openid-connect-core-1_0.html#code-id_tokenExample and
+	// https://openid.net/specs/openid-connect-core-1_0.html#id_token-tokenExample
+	const (
+		code        = "Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk"
+		accessToken = "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"
+	)
+	cases := []struct {
+		Alg      string
+		Value    string
+		Expected string
+	}{
+		{"RS256", code, "LDktKdoQak3Pk0cnXxCltA"},
+		{"RS256", accessToken, "77QmUPtjPfzWtF2AnpK9RQ"},
+		{"ES256", accessToken, "77QmUPtjPfzWtF2AnpK9RQ"},
+		{"PS384", accessToken, "jtAeDp945y1dDqU3nkIVGNZP1HjH_MFs"},
+		{"ES512", accessToken, "q7nS86GgvvFaZkzALLWqJYaJIKw2wCDAVfCAsm5CrBM"},
+		{"EdDSA", code, "E9z1C-c0Az4eTEzE0Nm3OQ3BS2BhMgxuP7x5JAQj1_4"},
+	}
+	for _, tc := range cases {
+		hash, err := TokenHash(tc.Alg, tc.Value)
+		if err != nil {
+			t.Errorf("%s: %v", tc.Alg, err)
+			continue
+		}
+		if hash != tc.Expected {
+			t.Errorf("%s: got hash %q, expected %q", tc.Alg, hash, tc.Expected)
+		}
+	}
+	if _, err := TokenHash("none", code); err == nil {
+		t.Error("got no error for an unsupported algorithm")
+	}
+}
+
+func TestAuthorizeResponseTypes(t *testing.T) {
+	cases := []struct {
+		ResponseType string
+		Code         bool
+		AccessToken  bool
+	}{
+		{"id_token", false, false},
+		{"code id_token", true, false},
+		{"id_token token", false, true},
+		{"code id_token token", true, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.ResponseType, func(t *testing.T) {
+			c := newImplicitController(t)
+			params := redirectParams(t, authorizeTest(t, c, url.Values{
+				"client_id":     {"client"},
+				"response_type": {tc.ResponseType},
+				"redirect_uri":  {testRedirectURI},
+				"scope":         {"openid"},
+				"nonce":         {"nonce"},
+			}))
+			if code := params.Get("code"); (code != "") != tc.Code {
+				t.Errorf("got code %q in %v", code, params)
+			}
+			for _, p := range []string{"access_token", "token_type", "expires_in"} {
+				if v := params.Get(p); (v != "") != tc.AccessToken {
+					t.Errorf("got %s %q in %v", p, v, params)
+				}
+			}
+			var claims idTokenClaims
+			if err := verifyJWT(params.Get("id_token"), c.keys.PublicKeys(), &claims); err != nil {
+				t.Fatal(err)
+			}
+			if (claims.CodeHash != "") != tc.Code || (claims.AccessTokenHash != "") != tc.AccessToken {
+				t.Errorf("got c_hash %q and at_hash %q", claims.CodeHash, claims.AccessTokenHash)
+			}
+			if claims.Subject != "alice" || claims.Nonce != "nonce" {
+				t.Errorf("got claims %+v", claims)
+			}
+		})
+	}
+}
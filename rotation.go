@@ -0,0 +1,448 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/goadesign/goa"
+)
+
+// DefaultRefreshTokenFamilyLifetime is the duration during which the in-memory refresh token store
+// keeps the token families that issued no new token unless configured otherwise, see
+// NewRefreshTokenMemoryStore.
+const DefaultRefreshTokenFamilyLifetime = 30 * 24 * time.Hour
+
+type (
+	// RefreshTokenManager implements refresh token rotation with reuse detection as
+	// recommended by https://tools.ietf.org/html/draft-ietf-oauth-security-topics section
+	// 4.13.2. The manager sits in front of the provider: the refresh token returned by
+	// Provider.Exchange becomes the grant of a new token family and is never sent to the
+	// client. Instead the client receives a token generated by the manager which is replaced
+	// by a new token each time it is used. Presenting a token that has already been rotated
+	// revokes the entire family and reports a security event.
+	RefreshTokenManager struct {
+		// GracePeriod is the duration during which a rotated refresh token may still be
+		// used. This accommodates clients that send concurrent refresh requests with the
+		// same token: the requests are serialized and all receive the refresh token issued
+		// by the first one so that the family does not fork. Reuse detected after the grace
+		// period revokes the token family.
+		GracePeriod time.Duration
+
+		// OnReuse is called when the reuse of a rotated refresh token is detected, after
+		// the token family has been revoked. The event is always logged.
+		OnReuse func(ctx context.Context, e *RefreshTokenReuseEvent)
+
+		store RefreshTokenStore
+		now   func() time.Time
+
+		lock     sync.Mutex
+		locks    map[string]*tokenLock // Locks of the tokens being rotated
+		children map[string]childToken // Tokens issued by recent rotations
+		purged   time.Time
+	}
+
+	// tokenLock serializes the concurrent rotations of a refresh token.
+	tokenLock struct {
+		sync.Mutex
+		refs int
+	}
+
+	// childToken is a refresh token issued by the rotation of another token. It is kept in
+	// memory during the grace period so that concurrent requests receive the same token.
+	childToken struct {
+		token     string
+		expiresAt time.Time
+	}
+
+	// RefreshTokenReuseEvent is the security event reported when a refresh token that has
+	// already been rotated is presented again after the grace period.
+	RefreshTokenReuseEvent struct {
+		// ClientID is the identifier of the client the token family was issued to.
+		ClientID string
+		// FamilyID is the identifier of the revoked token family.
+		FamilyID string
+		// RotatedAt is the time the reused token was first rotated.
+		RotatedAt time.Time
+		// DetectedAt is the time the reuse was detected.
+		DetectedAt time.Time
+	}
+
+	// RefreshTokenStore is the interface used by RefreshTokenManager to persist token
+	// families. Tokens are identified by the SHA256 hash of their value, raw token values
+	// are never given to the store.
+	RefreshTokenStore interface {
+		// CreateFamily persists a new token family.
+		CreateFamily(f *RefreshTokenFamily) error
+		// Family loads the token family with the given identifier. It returns
+		// ErrRefreshTokenNotFound if there is no such family.
+		Family(id string) (*RefreshTokenFamily, error)
+		// UpdateFamily persists the grant and revocation state of an existing family.
+		UpdateFamily(f *RefreshTokenFamily) error
+		// SaveRefreshToken persists a refresh token issued to a family.
+		SaveRefreshToken(t *RotatedRefreshToken) error
+		// RefreshToken loads the refresh token with the given hash. It returns
+		// ErrRefreshTokenNotFound if there is no such token.
+		RefreshToken(hash string) (*RotatedRefreshToken, error)
+		// MarkRotated atomically records that the refresh token with the given hash was
+		// rotated at the given time unless it already was. It returns the time the token
+		// was first rotated or the zero time if this call marked it.
+		MarkRotated(hash string, at time.Time) (time.Time, error)
+	}
+
+	// RefreshTokenFamily is the lineage of refresh tokens that derive from a single grant.
+	RefreshTokenFamily struct {
+		// ID is the unique identifier of the family.
+		ID string
+		// ClientID is the identifier of the client the family was issued to.
+		ClientID string
+		// Grant is the refresh token returned by the provider, it is given to
+		// Provider.Refresh when a token of the family is used.
+		Grant string
+		// Revoked is true once reuse has been detected.
+		Revoked bool
+		// CreatedAt is the family creation time.
+		CreatedAt time.Time
+	}
+
+	// RotatedRefreshToken is a refresh token issued by RefreshTokenManager.
+	RotatedRefreshToken struct {
+		// Hash is the SHA256 hash of the token value.
+		Hash string
+		// FamilyID is the identifier of the family the token belongs to.
+		FamilyID string
+		// Parent is the hash of the token that was rotated to issue this token, empty
+		// for the first token of the family.
+		Parent string
+		// IssuedAt is the token issuance time.
+		IssuedAt time.Time
+		// RotatedAt is the time the token was first used, zero if it never was.
+		RotatedAt time.Time
+	}
+
+	// memoryRefreshTokenStore is an in-memory implementation of RefreshTokenStore.
+	memoryRefreshTokenStore struct {
+		lock     sync.Mutex
+		families map[string]RefreshTokenFamily
+		tokens   map[string]RotatedRefreshToken
+		active   map[string]time.Time // Last token issuance time by family
+		lifetime time.Duration
+		now      func() time.Time
+		purged   time.Time
+	}
+)
+
+// ErrRefreshTokenNotFound is the error returned by RefreshTokenStore implementations when a
+// token or family does not exist.
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+// NewRefreshTokenManager creates a refresh token manager that persists token families in the
+// given store. Use NewRefreshTokenMemoryStore for single node deployments.
+func NewRefreshTokenManager(store RefreshTokenStore) *RefreshTokenManager {
+	return &RefreshTokenManager{
+		store:    store,
+		now:      time.Now,
+		locks:    make(map[string]*tokenLock),
+		children: make(map[string]childToken),
+	}
+}
+
+// NewRefreshTokenMemoryStore creates a RefreshTokenStore that keeps token families in memory. A
+// family and its tokens are deleted once the family issued no new token for the given lifetime,
+// DefaultRefreshTokenFamilyLifetime if zero. The lifetime should not be shorter than the lifetime
+// of the refresh tokens issued by the provider.
+func NewRefreshTokenMemoryStore(lifetime time.Duration) RefreshTokenStore {
+	if lifetime == 0 {
+		lifetime = DefaultRefreshTokenFamilyLifetime
+	}
+	return &memoryRefreshTokenStore{
+		families: make(map[string]RefreshTokenFamily),
+		tokens:   make(map[string]RotatedRefreshToken),
+		active:   make(map[string]time.Time),
+		lifetime: lifetime,
+		now:      time.Now,
+	}
+}
+
+// issue creates a new token family for the given provider refresh token and returns the first
+// refresh token of the family.
+func (m *RefreshTokenManager) issue(clientID, grant string) (string, error) {
+	id, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	now := m.now()
+	f := RefreshTokenFamily{ID: id, ClientID: clientID, Grant: grant, CreatedAt: now}
+	if err := m.store.CreateFamily(&f); err != nil {
+		return "", err
+	}
+	return m.next(&f, "", now)
+}
+
+// rotate validates the given refresh token, calls refresh with the grant of the token family and
+// returns a new refresh token for the family. refresh must return the new provider refresh token
+// if any. The given token is only rotated if refresh succeeds. Tokens used again during the grace
+// period return the refresh token issued by the first rotation, the request fails if it was
+// issued by another node.
+func (m *RefreshTokenManager) rotate(ctx context.Context, clientID, token string, refresh func(grant string) (string, error)) (string, error) {
+	hash := hashToken(token)
+	unlock := m.lockToken(hash)
+	defer unlock()
+	t, err := m.store.RefreshToken(hash)
+	if err == ErrRefreshTokenNotFound {
+		return "", NewError(ErrInvalidGrant, "invalid refresh token", "")
+	}
+	if err != nil {
+		return "", err
+	}
+	f, err := m.store.Family(t.FamilyID)
+	if err == ErrRefreshTokenNotFound {
+		return "", NewError(ErrInvalidGrant, "invalid refresh token", "")
+	}
+	if err != nil {
+		return "", err
+	}
+	if f.Revoked || clientID != "" && clientID != f.ClientID {
+		return "", NewError(ErrInvalidGrant, "invalid refresh token", "")
+	}
+
+	// Detect reuse
+	now := m.now()
+	if m.reused(t.RotatedAt, now) {
+		return "", m.revoke(ctx, f, t.RotatedAt, now)
+	}
+	child, concurrent := "", !t.RotatedAt.IsZero()
+	if concurrent {
+		if child = m.child(hash, now); child == "" {
+			return "", NewError(ErrInvalidGrant, "invalid refresh token", "")
+		}
+	}
+
+	// Refresh grant
+	grant, err := refresh(f.Grant)
+	if err != nil {
+		return "", err
+	}
+	if grant != "" && grant != f.Grant {
+		f.Grant = grant
+		if err := m.store.UpdateFamily(f); err != nil {
+			return "", err
+		}
+	}
+	if concurrent {
+		return child, nil
+	}
+	rotatedAt, err := m.store.MarkRotated(hash, now)
+	if err != nil {
+		return "", err
+	}
+	if m.reused(rotatedAt, now) {
+		return "", m.revoke(ctx, f, rotatedAt, now)
+	}
+	if !rotatedAt.IsZero() {
+		// Rotated concurrently by another node
+		return "", NewError(ErrInvalidGrant, "invalid refresh token", "")
+	}
+	if child, err = m.next(f, hash, now); err != nil {
+		return "", err
+	}
+	m.addChild(hash, child, now)
+	return child, nil
+}
+
+// lockToken locks the refresh token with the given hash and returns the function that unlocks
+// it.
+func (m *RefreshTokenManager) lockToken(hash string) func() {
+	m.lock.Lock()
+	l, ok := m.locks[hash]
+	if !ok {
+		l = &tokenLock{}
+		m.locks[hash] = l
+	}
+	l.refs++
+	m.lock.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(m.locks, hash)
+		}
+	}
+}
+
+// child returns the refresh token issued by the rotation of the token with the given hash if it
+// was rotated by this manager during the grace period, an empty string otherwise.
+func (m *RefreshTokenManager) child(hash string, now time.Time) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	c, ok := m.children[hash]
+	if !ok || now.After(c.expiresAt) {
+		return ""
+	}
+	return c.token
+}
+
+// addChild records the refresh token issued by the rotation of the token with the given hash
+// for the duration of the grace period.
+func (m *RefreshTokenManager) addChild(hash, token string, now time.Time) {
+	if m.GracePeriod <= 0 {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if now.Sub(m.purged) > time.Minute {
+		for h, c := range m.children {
+			if now.After(c.expiresAt) {
+				delete(m.children, h)
+			}
+		}
+		m.purged = now
+	}
+	m.children[hash] = childToken{token: token, expiresAt: now.Add(m.GracePeriod)}
+}
+
+// reused returns true if a token rotated at the given time is being reused after the grace
+// period.
+func (m *RefreshTokenManager) reused(rotatedAt, now time.Time) bool {
+	return !rotatedAt.IsZero() && now.Sub(rotatedAt) > m.GracePeriod
+}
+
+// revoke revokes the given token family and reports the reuse. It returns the error sent back
+// to the client.
+func (m *RefreshTokenManager) revoke(ctx context.Context, f *RefreshTokenFamily, rotatedAt, now time.Time) error {
+	f.Revoked = true
+	if err := m.store.UpdateFamily(f); err != nil {
+		return err
+	}
+	e := RefreshTokenReuseEvent{ClientID: f.ClientID, FamilyID: f.ID, RotatedAt: rotatedAt, DetectedAt: now}
+	goa.LogError(ctx, "refresh token reuse detected, token family revoked", "client", e.ClientID, "family", e.FamilyID)
+	if m.OnReuse != nil {
+		m.OnReuse(ctx, &e)
+	}
+	return NewError(ErrInvalidGrant, "invalid refresh token", "")
+}
+
+// next generates and stores a new refresh token for the given family.
+func (m *RefreshTokenManager) next(f *RefreshTokenFamily, parent string, now time.Time) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	t := RotatedRefreshToken{Hash: hashToken(token), FamilyID: f.ID, Parent: parent, IssuedAt: now}
+	if err := m.store.SaveRefreshToken(&t); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// memoryRefreshTokenStore implements RefreshTokenStore.
+func (s *memoryRefreshTokenStore) CreateFamily(f *RefreshTokenFamily) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.purge()
+	s.families[f.ID] = *f
+	s.active[f.ID] = f.CreatedAt
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) Family(id string) (*RefreshTokenFamily, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, ok := s.families[id]
+	if !ok || s.expired(id) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	return &f, nil
+}
+
+func (s *memoryRefreshTokenStore) UpdateFamily(f *RefreshTokenFamily) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.families[f.ID]; !ok {
+		return ErrRefreshTokenNotFound
+	}
+	s.families[f.ID] = *f
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) SaveRefreshToken(t *RotatedRefreshToken) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tokens[t.Hash] = *t
+	if t.IssuedAt.After(s.active[t.FamilyID]) {
+		s.active[t.FamilyID] = t.IssuedAt
+	}
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) RefreshToken(hash string) (*RotatedRefreshToken, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t, ok := s.tokens[hash]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+	return &t, nil
+}
+
+func (s *memoryRefreshTokenStore) MarkRotated(hash string, at time.Time) (time.Time, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t, ok := s.tokens[hash]
+	if !ok {
+		return time.Time{}, ErrRefreshTokenNotFound
+	}
+	if !t.RotatedAt.IsZero() {
+		return t.RotatedAt, nil
+	}
+	t.RotatedAt = at
+	s.tokens[hash] = t
+	return time.Time{}, nil
+}
+
+// expired returns true if the family with the given identifier issued no token for the store
+// lifetime.
+func (s *memoryRefreshTokenStore) expired(id string) bool {
+	return s.now().Sub(s.active[id]) > s.lifetime
+}
+
+// purge deletes the expired families and their tokens, at most once per minute.
+func (s *memoryRefreshTokenStore) purge() {
+	now := s.now()
+	if now.Sub(s.purged) < time.Minute {
+		return
+	}
+	for id := range s.families {
+		if s.expired(id) {
+			delete(s.families, id)
+			delete(s.active, id)
+		}
+	}
+	for h, t := range s.tokens {
+		if _, ok := s.families[t.FamilyID]; !ok {
+			delete(s.tokens, h)
+		}
+	}
+	s.purged = now
+}
+
+// newToken generates a random URL safe token with 256 bits of entropy.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the URL safe base64 encoding of the SHA256 hash of the given token.
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
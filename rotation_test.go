@@ -0,0 +1,155 @@
+package oauth2
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// refreshGrant returns a rotate callback that counts its calls and returns the given error.
+func refreshGrant(calls *int, err error) func(string) (string, error) {
+	var lock sync.Mutex
+	return func(grant string) (string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		*calls++
+		return "", err
+	}
+}
+
+func newTestManager(grace time.Duration) (*RefreshTokenManager, *time.Time) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewRefreshTokenMemoryStore(0).(*memoryRefreshTokenStore)
+	s.now = func() time.Time { return now }
+	m := NewRefreshTokenManager(s)
+	m.GracePeriod = grace
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	m, _ := newTestManager(0)
+	token, err := m.issue("client", "grant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int
+	next, err := m.rotate(context.Background(), "client", token, refreshGrant(&calls, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == "" || next == token {
+		t.Errorf("got refresh token %q, expected a new token", next)
+	}
+	if _, err := m.rotate(context.Background(), "other", next, refreshGrant(&calls, nil)); err == nil {
+		t.Error("expected an error when the token is used by another client")
+	}
+	if calls != 1 {
+		t.Errorf("got %d provider calls, expected 1", calls)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	m, now := newTestManager(10 * time.Second)
+	var events []*RefreshTokenReuseEvent
+	m.OnReuse = func(ctx context.Context, e *RefreshTokenReuseEvent) { events = append(events, e) }
+	token, _ := m.issue("client", "grant")
+	var calls int
+	next, err := m.rotate(context.Background(), "client", token, refreshGrant(&calls, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*now = now.Add(time.Minute)
+	if _, err := m.rotate(context.Background(), "client", token, refreshGrant(&calls, nil)); err == nil {
+		t.Fatal("expected an error when reusing a rotated token")
+	}
+	if len(events) != 1 || events[0].ClientID != "client" {
+		t.Fatalf("got reuse events %v, expected one event", events)
+	}
+	if _, err := m.rotate(context.Background(), "client", next, refreshGrant(&calls, nil)); err == nil {
+		t.Error("expected the tokens of the revoked family to be rejected")
+	}
+	if calls != 1 {
+		t.Errorf("got %d provider calls, expected 1", calls)
+	}
+}
+
+func TestRefreshTokenFailedRefreshKeepsToken(t *testing.T) {
+	m, now := newTestManager(0)
+	token, _ := m.issue("client", "grant")
+	var calls int
+	invalid := NewError(ErrInvalidScope, "invalid scope", "")
+	if _, err := m.rotate(context.Background(), "client", token, refreshGrant(&calls, invalid)); err != invalid {
+		t.Fatalf("got error %v, expected the provider error", err)
+	}
+
+	*now = now.Add(time.Minute)
+	if _, err := m.rotate(context.Background(), "client", token, refreshGrant(&calls, nil)); err != nil {
+		t.Errorf("got error %v, expected the token to still be valid", err)
+	}
+}
+
+func TestRefreshTokenConcurrentRotation(t *testing.T) {
+	m, _ := newTestManager(10 * time.Second)
+	token, _ := m.issue("client", "grant")
+	var (
+		calls    int
+		wg       sync.WaitGroup
+		children = make([]string, 5)
+		errs     = make([]error, 5)
+	)
+	for i := range children {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			children[i], errs[i] = m.rotate(context.Background(), "client", token, refreshGrant(&calls, nil))
+		}(i)
+	}
+	wg.Wait()
+	for i, child := range children {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if child != children[0] {
+			t.Fatalf("got refresh tokens %q and %q, expected the same token", children[0], child)
+		}
+	}
+	if _, err := m.rotate(context.Background(), "client", children[0], refreshGrant(&calls, nil)); err != nil {
+		t.Errorf("got error %v, expected the issued token to be valid", err)
+	}
+}
+
+func TestRefreshTokenMemoryStoreExpiry(t *testing.T) {
+	m, now := newTestManager(0)
+	s := m.store.(*memoryRefreshTokenStore)
+	token, err := m.issue("client", "grant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int
+	*now = now.Add(DefaultRefreshTokenFamilyLifetime - time.Hour)
+	if token, err = m.rotate(context.Background(), "client", token, refreshGrant(&calls, nil)); err != nil {
+		t.Fatalf("got error %v, expected the rotation to keep the family alive", err)
+	}
+
+	*now = now.Add(DefaultRefreshTokenFamilyLifetime - time.Hour)
+	if token, err = m.rotate(context.Background(), "client", token, refreshGrant(&calls, nil)); err != nil {
+		t.Fatalf("got error %v, expected the family to still be active", err)
+	}
+	if len(s.families) != 1 || len(s.tokens) != 3 {
+		t.Fatalf("got %d families and %d tokens, expected 1 and 3", len(s.families), len(s.tokens))
+	}
+
+	*now = now.Add(DefaultRefreshTokenFamilyLifetime + time.Hour)
+	if _, err := m.rotate(context.Background(), "client", token, refreshGrant(&calls, nil)); err == nil {
+		t.Error("got no error for the token of an expired family")
+	}
+	if _, err := m.issue("other", "grant"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.families) != 1 || len(s.tokens) != 1 {
+		t.Errorf("got %d families and %d tokens, expected the expired family to be purged", len(s.families), len(s.tokens))
+	}
+}
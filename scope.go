@@ -0,0 +1,87 @@
+package oauth2
+
+import (
+	"sort"
+	"strings"
+)
+
+type (
+	// ScopeSet is a normalized set of scope tokens as described in
+	// https://tools.ietf.org/html/rfc6749#section-3.3. The tokens are sorted and unique.
+	ScopeSet []string
+
+	// GrantScoper is the interface optionally implemented by providers that can report the
+	// scope of the grants they issue. When the provider implements it the controller makes
+	// sure that refresh requests do not ask for a scope that exceeds the scope originally
+	// granted and responds with the scope effectively granted to the access tokens.
+	GrantScoper interface {
+		// RefreshTokenScope returns the scope originally granted by the resource owner
+		// for the given refresh token. Upon failure the error should implement Error
+		// otherwise a generic error HTTP response is sent back to the client.
+		RefreshTokenScope(refreshToken string) (string, error)
+
+		// AccessTokenScope returns the scope granted to the given access token. Upon
+		// failure the error should implement Error otherwise a generic error HTTP response
+		// is sent back to the client.
+		AccessTokenScope(accessToken string) (string, error)
+	}
+)
+
+// ParseScope parses a space-delimited list of scope tokens. It returns an error if any token
+// contains characters that are not allowed by https://tools.ietf.org/html/rfc6749#section-3.3
+func ParseScope(scope string) (ScopeSet, error) {
+	tokens := strings.Split(scope, " ")
+	for _, t := range tokens {
+		for i := 0; i < len(t); i++ {
+			if c := t[i]; c < 0x21 || c == 0x22 || c == 0x5C || c > 0x7E {
+				return nil, NewError(ErrInvalidScope, "malformed scope", "")
+			}
+		}
+	}
+	return NewScopeSet(tokens...), nil
+}
+
+// NewScopeSet creates a scope set from the given tokens. Empty tokens are ignored.
+func NewScopeSet(tokens ...string) ScopeSet {
+	s := make(ScopeSet, 0, len(tokens))
+	for _, t := range tokens {
+		if t != "" {
+			s = append(s, t)
+		}
+	}
+	sort.Strings(s)
+	j := 0
+	for i, t := range s {
+		if i == 0 || t != s[j-1] {
+			s[j] = t
+			j++
+		}
+	}
+	return s[:j]
+}
+
+// String returns the space-delimited representation of the scope set.
+func (s ScopeSet) String() string {
+	return strings.Join(s, " ")
+}
+
+// Contains returns true if the set contains the given token.
+func (s ScopeSet) Contains(token string) bool {
+	i := sort.SearchStrings(s, token)
+	return i < len(s) && s[i] == token
+}
+
+// IsSubsetOf returns true if all the tokens of s are also in other.
+func (s ScopeSet) IsSubsetOf(other ScopeSet) bool {
+	for _, t := range s {
+		if !other.Contains(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns true if s and other contain the same tokens.
+func (s ScopeSet) Equal(other ScopeSet) bool {
+	return len(s) == len(other) && s.IsSubsetOf(other)
+}
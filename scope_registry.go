@@ -0,0 +1,228 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/goadesign/goa"
+)
+
+type (
+	// ScopeRegistry records the scopes known to the authorization server together with their
+	// descriptions and the scopes they imply. The registry of the scopes defined in the
+	// design can be generated with the scopegen goagen plugin.
+	//
+	// Scopes may be hierarchical: a scope registered as implying other scopes (e.g. api:write
+	// implying api:read) satisfies the requirement for any of the implied scopes. Scopes
+	// ending with "*" are wildcard patterns that stand for all the scopes that start with
+	// the pattern prefix (e.g. api:* stands for api:read and api:write).
+	ScopeRegistry struct {
+		lock     sync.RWMutex
+		scopes   map[string]*ScopeDefinition
+		defaults map[string]ScopeSet
+	}
+
+	// ScopeDefinition describes a registered scope.
+	ScopeDefinition struct {
+		// Name is the scope token.
+		Name string
+		// Description is a human readable description of the scope.
+		Description string
+		// Implies lists the scopes directly implied by the scope.
+		Implies []string
+	}
+)
+
+// NewScopeRegistry creates an empty scope registry.
+func NewScopeRegistry() *ScopeRegistry {
+	return &ScopeRegistry{
+		scopes:   make(map[string]*ScopeDefinition),
+		defaults: make(map[string]ScopeSet),
+	}
+}
+
+// WithScopeRegistry configures the controller to validate the scopes of authorization
+// requests against the given registry, to apply the client default scopes when authorization
+// requests do not specify a scope and to take scope implications into account when checking
+// that refresh requests do not exceed the scope originally granted.
+func WithScopeRegistry(r *ScopeRegistry) ProviderOption {
+	return func(c *ProviderController) {
+		c.scopes = r
+	}
+}
+
+// Register registers a scope with the given description and implied scopes. Registering a
+// scope that already exists overrides its definition.
+func (r *ScopeRegistry) Register(name, description string, implies ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.scopes[name] = &ScopeDefinition{Name: name, Description: description, Implies: implies}
+}
+
+// Scope returns the definition of the scope with the given name, nil if there is none.
+func (r *ScopeRegistry) Scope(name string) *ScopeDefinition {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.scopes[name]
+}
+
+// Names returns the sorted names of all the registered scopes.
+func (r *ScopeRegistry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	names := make([]string, 0, len(r.scopes))
+	for n := range r.scopes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetDefaultScope sets the scope used for authorization requests made by the given client that
+// do not specify a scope as allowed by https://tools.ietf.org/html/rfc6749#section-3.3
+func (r *ScopeRegistry) SetDefaultScope(clientID string, scope ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.defaults[clientID] = NewScopeSet(scope...)
+}
+
+// DefaultScope returns the default scope of the given client, nil if there is none.
+func (r *ScopeRegistry) DefaultScope(clientID string) ScopeSet {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.defaults[clientID]
+}
+
+// Validate returns an "invalid_scope" error if the given scope contains tokens that are
+// neither registered nor wildcard patterns matching at least one registered scope.
+func (r *ScopeRegistry) Validate(scope ScopeSet) error {
+	_, err := r.Resolve(scope)
+	return err
+}
+
+// Resolve validates the given requested scope like Validate and returns it with its wildcard
+// patterns replaced by the registered scopes they match. The controller resolves the scopes
+// requested by clients so that providers only receive registered scopes and never grant a
+// pattern such as "*" verbatim.
+func (r *ScopeRegistry) Resolve(scope ScopeSet) (ScopeSet, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	resolved := make([]string, 0, len(scope))
+	for _, t := range scope {
+		if !isScopePattern(t) {
+			if _, ok := r.scopes[t]; !ok {
+				return nil, NewError(ErrInvalidScope, fmt.Sprintf("unknown scope %q", t), "")
+			}
+			resolved = append(resolved, t)
+			continue
+		}
+		var matches []string
+		for _, n := range r.matching(t) {
+			if !isScopePattern(n) {
+				matches = append(matches, n)
+			}
+		}
+		if len(matches) == 0 {
+			return nil, NewError(ErrInvalidScope, fmt.Sprintf("unknown scope %q", t), "")
+		}
+		resolved = append(resolved, matches...)
+	}
+	return NewScopeSet(resolved...), nil
+}
+
+// Expand returns the set of scopes granted by the given scope: the scope itself, the
+// registered scopes matching its wildcard patterns and all the scopes they imply transitively.
+func (r *ScopeRegistry) Expand(scope ScopeSet) ScopeSet {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var (
+		seen  = make(map[string]bool)
+		queue = append([]string{}, scope...)
+	)
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		if isScopePattern(t) {
+			queue = append(queue, r.matching(t)...)
+		}
+		if def, ok := r.scopes[t]; ok {
+			queue = append(queue, def.Implies...)
+		}
+	}
+	expanded := make([]string, 0, len(seen))
+	for t := range seen {
+		expanded = append(expanded, t)
+	}
+	return NewScopeSet(expanded...)
+}
+
+// Satisfies returns true if the given granted scope satisfies all the required scopes taking
+// implications and wildcard patterns into account.
+func (r *ScopeRegistry) Satisfies(granted ScopeSet, required ...string) bool {
+	expanded := r.Expand(granted)
+	for _, t := range required {
+		if !scopeSatisfied(expanded, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Covers returns true if the requested scope does not exceed the granted scope taking
+// implications and wildcard patterns into account. The token endpoint uses Covers to check
+// that a refresh request does not ask for more than the scope originally granted.
+func (r *ScopeRegistry) Covers(granted, requested ScopeSet) bool {
+	return r.Satisfies(granted, requested...)
+}
+
+// CheckScopes returns an "insufficient_scope" error if the given scope granted to the access
+// token used to make the request does not satisfy the scopes required by the action being
+// executed. Resource server bearer token middlewares call CheckScopes once the token has been
+// validated. The required scopes are the ones defined in the design and stored in the
+// context by the generated security handlers.
+func (r *ScopeRegistry) CheckScopes(ctx context.Context, granted ScopeSet) error {
+	required := goa.ContextRequiredScopes(ctx)
+	if !r.Satisfies(granted, required...) {
+		return ErrInsufficientScope(fmt.Sprintf("required scopes: %s", strings.Join(required, " ")))
+	}
+	return nil
+}
+
+// matching returns the registered scopes that match the given wildcard pattern. The caller
+// must hold the registry lock.
+func (r *ScopeRegistry) matching(pattern string) []string {
+	var names []string
+	prefix := strings.TrimSuffix(pattern, "*")
+	for n := range r.scopes {
+		if strings.HasPrefix(n, prefix) && n != pattern {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// scopeSatisfied returns true if the given scope token is in the expanded granted scope or
+// matches one of its wildcard patterns.
+func scopeSatisfied(expanded ScopeSet, token string) bool {
+	if expanded.Contains(token) {
+		return true
+	}
+	for _, g := range expanded {
+		if isScopePattern(g) && strings.HasPrefix(token, strings.TrimSuffix(g, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isScopePattern returns true if the given scope token is a wildcard pattern.
+func isScopePattern(token string) bool {
+	return strings.HasSuffix(token, "*")
+}
@@ -0,0 +1,177 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/goadesign/goa"
+)
+
+func TestScopeRegistryResolve(t *testing.T) {
+	r := NewScopeRegistry()
+	r.Register("api:read", "Read access")
+	r.Register("api:write", "Write access")
+	r.Register("admin:*", "Administration")
+	r.Register("profile", "Profile")
+
+	cases := []struct {
+		Name     string
+		Scope    ScopeSet
+		Expected string
+		Invalid  bool
+	}{
+		{"registered", NewScopeSet("profile", "api:read"), "api:read profile", false},
+		{"prefix pattern", NewScopeSet("api:*"), "api:read api:write", false},
+		{"catch-all pattern", NewScopeSet("*"), "api:read api:write profile", false},
+		{"registered pattern", NewScopeSet("admin:*"), "", true},
+		{"unmatched pattern", NewScopeSet("billing:*"), "", true},
+		{"unknown", NewScopeSet("api:delete"), "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			resolved, err := r.Resolve(c.Scope)
+			if c.Invalid {
+				if err == nil {
+					t.Fatalf("got scope %q, expected an error", resolved)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resolved.String() != c.Expected {
+				t.Errorf("got scope %q, expected %q", resolved, c.Expected)
+			}
+		})
+	}
+}
+
+// newHierarchyRegistry creates a registry where "api:admin" implies "api:write" which implies
+// "api:read" and "billing:*" implies "profile".
+func newHierarchyRegistry() *ScopeRegistry {
+	r := NewScopeRegistry()
+	r.Register("api:read", "Read access")
+	r.Register("api:write", "Write access", "api:read")
+	r.Register("api:admin", "Administration", "api:write")
+	r.Register("billing:read", "Billing read access")
+	r.Register("billing:*", "Billing", "profile")
+	r.Register("profile", "Profile")
+	return r
+}
+
+func TestScopeRegistryExpand(t *testing.T) {
+	r := newHierarchyRegistry()
+	cases := []struct {
+		Name     string
+		Scope    ScopeSet
+		Expected string
+	}{
+		{"no implication", NewScopeSet("api:read"), "api:read"},
+		{"direct implication", NewScopeSet("api:write"), "api:read api:write"},
+		{"transitive implication", NewScopeSet("api:admin"), "api:admin api:read api:write"},
+		{"pattern", NewScopeSet("api:*"), "api:* api:admin api:read api:write"},
+		{"registered pattern", NewScopeSet("billing:*"), "billing:* billing:read profile"},
+		{"unknown", NewScopeSet("other"), "other"},
+		{"empty", NewScopeSet(), ""},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if expanded := r.Expand(c.Scope); expanded.String() != c.Expected {
+				t.Errorf("got scope %q, expected %q", expanded, c.Expected)
+			}
+		})
+	}
+}
+
+func TestScopeRegistrySatisfies(t *testing.T) {
+	r := newHierarchyRegistry()
+	cases := []struct {
+		Name      string
+		Granted   ScopeSet
+		Required  []string
+		Satisfied bool
+	}{
+		{"granted", NewScopeSet("api:read"), []string{"api:read"}, true},
+		{"implied", NewScopeSet("api:admin"), []string{"api:read", "api:write"}, true},
+		{"not implied", NewScopeSet("api:read"), []string{"api:write"}, false},
+		{"partially granted", NewScopeSet("api:read"), []string{"api:read", "profile"}, false},
+		{"granted pattern", NewScopeSet("api:*"), []string{"api:delete"}, true},
+		{"pattern implication", NewScopeSet("billing:*"), []string{"profile"}, true},
+		{"nothing required", NewScopeSet(), nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if ok := r.Satisfies(c.Granted, c.Required...); ok != c.Satisfied {
+				t.Errorf("got %v for %q granted and %v required, expected %v", ok, c.Granted, c.Required, c.Satisfied)
+			}
+		})
+	}
+	if !r.Covers(NewScopeSet("api:write"), NewScopeSet("api:read")) {
+		t.Error("got a narrower implied scope not covered")
+	}
+	if r.Covers(NewScopeSet("api:read"), NewScopeSet("api:read", "api:write")) {
+		t.Error("got a wider scope covered")
+	}
+}
+
+func TestScopeRegistryDefaultScope(t *testing.T) {
+	r := NewScopeRegistry()
+	if s := r.DefaultScope("client"); s != nil {
+		t.Errorf("got default scope %q, expected none", s)
+	}
+	r.SetDefaultScope("client", "profile", "api:read", "profile")
+	if s := r.DefaultScope("client"); s.String() != "api:read profile" {
+		t.Errorf("got default scope %q, expected %q", s, "api:read profile")
+	}
+	if s := r.DefaultScope("other"); s != nil {
+		t.Errorf("got default scope %q for another client, expected none", s)
+	}
+}
+
+func TestScopeRegistryCheckScopes(t *testing.T) {
+	r := newHierarchyRegistry()
+	ctx := goa.WithRequiredScopes(context.Background(), []string{"api:read"})
+	if err := r.CheckScopes(ctx, NewScopeSet("api:write")); err != nil {
+		t.Errorf("got error %v for an implied required scope", err)
+	}
+	if err := r.CheckScopes(context.Background(), NewScopeSet()); err != nil {
+		t.Errorf("got error %v without required scopes", err)
+	}
+	err := r.CheckScopes(ctx, NewScopeSet("profile"))
+	if e, ok := err.(*goa.ErrorResponse); !ok || e.Status != http.StatusForbidden || e.Code != "insufficient_scope" {
+		t.Errorf("got error %v, expected an insufficient_scope error", err)
+	}
+}
+
+func TestRefreshScopeHierarchy(t *testing.T) {
+	r := NewScopeRegistry()
+	r.Register("api:read", "Read access")
+	r.Register("profile", "Profile", "email")
+	r.Register("email", "Email")
+	cases := []struct {
+		Name  string
+		Scope string
+		Error bool
+	}{
+		{"implied scope", "email", false},
+		{"granted and implied scopes", "api:read email", false},
+		{"not granted", "api:read api:write", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			refreshed := ""
+			c := NewProviderController(newTestService(), scoperProvider{refreshed: &refreshed}, WithScopeRegistry(r))
+			code, body := refreshTestToken(t, c, str(tc.Scope))
+			if tc.Error {
+				if code != http.StatusBadRequest || body["error"] != string(ErrInvalidScope) {
+					t.Errorf("got status %d and body %v, expected an %q error", code, body, ErrInvalidScope)
+				}
+				return
+			}
+			if code != http.StatusOK || refreshed != tc.Scope {
+				t.Errorf("got status %d, body %v and scope %q given to the provider, expected %q", code, body, refreshed, tc.Scope)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goadesign/goa"
+)
+
+// scoperProvider is a provider that grants the "api:read profile" scope to its refresh tokens
+// and the refreshed scope, or the original one if none, to its access tokens.
+type scoperProvider struct {
+	Provider
+	refreshed *string
+}
+
+func (p scoperProvider) Refresh(refreshToken, scope string) (string, string, int, error) {
+	*p.refreshed = scope
+	return "", "access", 3600, nil
+}
+
+func (p scoperProvider) RefreshTokenScope(refreshToken string) (string, error) {
+	return "api:read profile", nil
+}
+
+func (p scoperProvider) AccessTokenScope(accessToken string) (string, error) {
+	if *p.refreshed == "" {
+		return "api:read profile", nil
+	}
+	return *p.refreshed, nil
+}
+
+// refreshTestToken sends a refresh request with the given scope and returns the response status
+// and decoded body.
+func refreshTestToken(t *testing.T, c *ProviderController, scope *string) (int, map[string]interface{}) {
+	var (
+		rw    = httptest.NewRecorder()
+		req   = httptest.NewRequest("POST", "/oauth2/token", nil)
+		ctx   = goa.NewContext(WithClientID(context.Background(), "client"), rw, req, nil)
+		token = "refresh"
+	)
+	if err := c.refresh(ctx, rw, &token, scope, nil); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return rw.Code, body
+}
+
+func TestParseScope(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Scope    string
+		Expected string
+		Invalid  bool
+	}{
+		{"empty", "", "", false},
+		{"single", "api:read", "api:read", false},
+		{"sorted", "profile api:read", "api:read profile", false},
+		{"duplicates", "profile api:read profile", "api:read profile", false},
+		{"extra spaces", " api:read  profile ", "api:read profile", false},
+		{"punctuation", "https://api.example.com/read!#$%", "https://api.example.com/read!#$%", false},
+		{"double quote", `api:"read"`, "", true},
+		{"backslash", `api\read`, "", true},
+		{"tab", "api:read\tprofile", "", true},
+		{"newline", "api:read\nprofile", "", true},
+		{"non ASCII", "api:lecture-é", "", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s, err := ParseScope(tc.Scope)
+			if tc.Invalid {
+				if e, ok := err.(Error); !ok || e.Code() != ErrInvalidScope {
+					t.Errorf("got scope %q and error %v, expected an %q error", s, err, ErrInvalidScope)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.String() != tc.Expected {
+				t.Errorf("got scope %q, expected %q", s, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestScopeSet(t *testing.T) {
+	s := NewScopeSet("profile", "", "api:read", "profile")
+	if len(s) != 2 || s.String() != "api:read profile" {
+		t.Fatalf("got scope set %v, expected sorted unique tokens", s)
+	}
+	if !s.Contains("profile") || s.Contains("api") || s.Contains("") {
+		t.Errorf("got wrong Contains results for %v", s)
+	}
+	if !NewScopeSet("api:read").IsSubsetOf(s) || !NewScopeSet().IsSubsetOf(s) {
+		t.Error("expected subsets to be reported")
+	}
+	if NewScopeSet("api:read", "api:write").IsSubsetOf(s) {
+		t.Error("got a superset reported as a subset")
+	}
+	if !s.Equal(NewScopeSet("api:read", "profile")) || s.Equal(NewScopeSet("api:read")) || s.Equal(NewScopeSet("api:read", "email")) {
+		t.Errorf("got wrong Equal results for %v", s)
+	}
+}
+
+func TestRefreshScope(t *testing.T) {
+	cases := []struct {
+		Name      string
+		Scope     *string
+		Refreshed string
+		Granted   string
+		Error     ErrorCode
+	}{
+		{"original scope", nil, "", "api:read profile", ""},
+		{"same scope", str("profile api:read"), "api:read profile", "api:read profile", ""},
+		{"narrowed scope", str("api:read"), "api:read", "api:read", ""},
+		{"expanded scope", str("api:read api:write"), "", "", ErrInvalidScope},
+		{"other scope", str("api:write"), "", "", ErrInvalidScope},
+		{"malformed scope", str(`api:"read"`), "", "", ErrInvalidScope},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			refreshed := ""
+			c := NewProviderController(newTestService(), scoperProvider{refreshed: &refreshed})
+			code, body := refreshTestToken(t, c, tc.Scope)
+			if tc.Error != "" {
+				if code != http.StatusBadRequest || body["error"] != string(tc.Error) {
+					t.Errorf("got status %d and body %v, expected an %q error", code, body, tc.Error)
+				}
+				return
+			}
+			if code != http.StatusOK {
+				t.Fatalf("got status %d and body %v", code, body)
+			}
+			if refreshed != tc.Refreshed {
+				t.Errorf("got scope %q given to the provider, expected %q", refreshed, tc.Refreshed)
+			}
+			if body["scope"] != tc.Granted {
+				t.Errorf("got granted scope %v, expected %q", body["scope"], tc.Granted)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Package scopegen is a goagen plugin that generates the OAuth2 scope registry from the scopes
+defined in the design with the Scope and ScopeImplies DSL functions. Run it with:
+
+	goagen gen -d <design package path> --pkg-path=github.com/goadesign/oauth2/scopegen
+
+The generated app/oauth2_scopes.go file defines the OAuth2Scopes variable which holds the
+registry.
+*/
+package scopegen
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/goadesign/goa/design"
+	"github.com/goadesign/goa/goagen/codegen"
+	"github.com/goadesign/goa/goagen/utils"
+	oauth2design "github.com/goadesign/oauth2/design"
+)
+
+// Generator is the scope registry code generator.
+type Generator struct {
+	API      *design.APIDefinition // The API definition
+	OutDir   string                // Path to output directory
+	genfiles []string              // Generated files
+}
+
+// scopeData is the data used to render a registered scope.
+type scopeData struct {
+	Name        string
+	Description string
+	Implies     []string
+}
+
+// Generate is the generator entry point called by the meta generator.
+func Generate() (files []string, err error) {
+	var outDir, ver string
+	set := flag.NewFlagSet("scopes", flag.PanicOnError)
+	set.StringVar(&outDir, "out", "", "")
+	set.StringVar(&ver, "version", "", "")
+	set.String("design", "", "")
+	set.Parse(os.Args[1:])
+
+	if err := codegen.CheckVersion(ver); err != nil {
+		return nil, err
+	}
+
+	g := &Generator{OutDir: outDir, API: design.Design}
+
+	return g.Generate()
+}
+
+// Generate produces the scope registry file.
+func (g *Generator) Generate() (_ []string, err error) {
+	if g.API == nil {
+		return nil, fmt.Errorf("missing API definition, make sure design is properly initialized")
+	}
+
+	go utils.Catch(nil, func() { g.Cleanup() })
+
+	defer func() {
+		if err != nil {
+			g.Cleanup()
+		}
+	}()
+
+	// Collect scopes of all OAuth2 security schemes
+	descs := make(map[string]string)
+	for _, scheme := range g.API.SecuritySchemes {
+		if scheme.Kind != design.OAuth2SecurityKind {
+			continue
+		}
+		for name, desc := range scheme.Scopes {
+			descs[name] = desc
+		}
+	}
+	names := make([]string, 0, len(descs))
+	for name := range descs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	scopes := make([]*scopeData, len(names))
+	for i, name := range names {
+		scopes[i] = &scopeData{
+			Name:        name,
+			Description: descs[name],
+			Implies:     oauth2design.ImpliedScopes(name),
+		}
+	}
+
+	appDir := filepath.Join(g.OutDir, "app")
+	if err = os.MkdirAll(appDir, 0755); err != nil {
+		return
+	}
+	scopesFile := filepath.Join(appDir, "oauth2_scopes.go")
+	os.Remove(scopesFile)
+	file, err := codegen.SourceFileFor(scopesFile)
+	if err != nil {
+		return
+	}
+	g.genfiles = append(g.genfiles, scopesFile)
+	title := fmt.Sprintf("%s: OAuth2 Scopes", g.API.Context())
+	imports := []*codegen.ImportSpec{
+		codegen.SimpleImport("github.com/goadesign/oauth2"),
+	}
+	if err = file.WriteHeader(title, "app", imports); err != nil {
+		return
+	}
+	if err = file.ExecuteTemplate("scopes", scopesT, nil, scopes); err != nil {
+		return
+	}
+	if err = file.FormatCode(); err != nil {
+		return
+	}
+
+	return g.genfiles, nil
+}
+
+// Cleanup removes all the files generated by this generator during the last invokation of Generate.
+func (g *Generator) Cleanup() {
+	for _, f := range g.genfiles {
+		os.Remove(f)
+	}
+	g.genfiles = nil
+}
+
+const scopesT = `// OAuth2Scopes is the registry of the OAuth2 scopes defined in the design.
+var OAuth2Scopes = oauth2.NewScopeRegistry()
+
+func init() {
+{{ range . }}	OAuth2Scopes.Register({{ printf "%q" .Name }}, {{ printf "%q" .Description }}{{ range .Implies }}, {{ printf "%q" . }}{{ end }})
+{{ end }}}
+`
@@ -0,0 +1,77 @@
+package scopegen
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goadesign/goa/design"
+	"github.com/goadesign/goa/dslengine"
+	oauth2design "github.com/goadesign/oauth2/design"
+)
+
+func TestGenerate(t *testing.T) {
+	scheme := &design.SecuritySchemeDefinition{
+		Kind: design.OAuth2SecurityKind,
+		Scopes: map[string]string{
+			"api:write": "Write access",
+			"api:read":  "Read access",
+		},
+	}
+	if !dslengine.Execute(func() { oauth2design.ScopeImplies("api:write", "api:read") }, scheme) {
+		t.Fatal(dslengine.Errors)
+	}
+	// The generated file must live in a Go workspace.
+	gopath := t.TempDir()
+	t.Setenv("GOPATH", gopath)
+	g := &Generator{
+		API: &design.APIDefinition{
+			Name: "test",
+			SecuritySchemes: []*design.SecuritySchemeDefinition{
+				scheme,
+				{Kind: design.APIKeySecurityKind, Scopes: map[string]string{"ignored": "Not an OAuth2 scope"}},
+			},
+		},
+		OutDir: filepath.Join(gopath, "src", "example"),
+	}
+	files, err := g.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(g.OutDir, "app", "oauth2_scopes.go")
+	if len(files) != 1 || files[0] != path {
+		t.Fatalf("got generated files %v, expected %s", files, path)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(b)
+	expected := []string{
+		"package app",
+		`"github.com/goadesign/oauth2"`,
+		"var OAuth2Scopes = oauth2.NewScopeRegistry()",
+		`OAuth2Scopes.Register("api:read", "Read access")` + "\n" +
+			"\t" + `OAuth2Scopes.Register("api:write", "Write access", "api:read")`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(code, e) {
+			t.Errorf("generated code does not contain %q:\n%s", e, code)
+		}
+	}
+	if strings.Contains(code, "ignored") {
+		t.Errorf("got scopes of a non OAuth2 security scheme generated:\n%s", code)
+	}
+
+	g.Cleanup()
+	if _, err := ioutil.ReadFile(path); err == nil {
+		t.Error("got the generated file kept after cleanup")
+	}
+}
+
+func TestGenerateMissingAPI(t *testing.T) {
+	if _, err := (&Generator{OutDir: t.TempDir()}).Generate(); err == nil {
+		t.Error("got no error without an API definition")
+	}
+}
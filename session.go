@@ -0,0 +1,109 @@
+package oauth2
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultSessionLifetime is the duration during which the participation of a client in a
+// session is remembered unless configured otherwise with WithSessionStore.
+const DefaultSessionLifetime = 24 * time.Hour
+
+type (
+	// SessionStore persists the clients that take part in the sessions of resource owners with
+	// the authorization server so that they can be notified when the sessions end, see
+	// WithSessionStore.
+	SessionStore interface {
+		// AddSessionClient records that the client with the given identifier takes part
+		// in the session with the given identifier until the given expiration time.
+		AddSessionClient(ctx context.Context, sid, clientID string, expiresAt time.Time) error
+		// SessionClients returns the identifiers of the clients that take part in the
+		// session with the given identifier. It returns an empty list if there is no such
+		// session or if the session has expired.
+		SessionClients(ctx context.Context, sid string) ([]string, error)
+		// DeleteSession deletes the clients recorded for the session with the given
+		// identifier.
+		DeleteSession(ctx context.Context, sid string) error
+	}
+
+	// memorySessionStore is an in-memory implementation of SessionStore.
+	memorySessionStore struct {
+		lock     sync.Mutex
+		sessions map[string]map[string]time.Time
+		purged   time.Time
+	}
+)
+
+// NewMemorySessionStore creates a SessionStore that keeps the sessions in memory.
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{sessions: make(map[string]map[string]time.Time)}
+}
+
+// WithSessionStore enables the notification of the clients that take part in a session when the
+// session ends at the end session endpoint, see WithBackChannelLogout and EndSession. Authorize
+// records the clients in the given store under the session identifier set in the request context
+// with WithSessionID. The participation of a client is remembered for the given lifetime after
+// its last authorization, the lifetime defaults to DefaultSessionLifetime if zero.
+func WithSessionStore(s SessionStore, lifetime time.Duration) ProviderOption {
+	return func(c *ProviderController) {
+		if lifetime == 0 {
+			lifetime = DefaultSessionLifetime
+		}
+		c.sessionStore = s
+		c.sessionLifetime = lifetime
+	}
+}
+
+// AddSessionClient implements SessionStore.
+func (s *memorySessionStore) AddSessionClient(ctx context.Context, sid, clientID string, expiresAt time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	if now.Sub(s.purged) > time.Minute {
+		for id, clients := range s.sessions {
+			for cid, exp := range clients {
+				if !now.Before(exp) {
+					delete(clients, cid)
+				}
+			}
+			if len(clients) == 0 {
+				delete(s.sessions, id)
+			}
+		}
+		s.purged = now
+	}
+	clients, ok := s.sessions[sid]
+	if !ok {
+		clients = make(map[string]time.Time)
+		s.sessions[sid] = clients
+	}
+	clients[clientID] = expiresAt
+	return nil
+}
+
+// SessionClients implements SessionStore.
+func (s *memorySessionStore) SessionClients(ctx context.Context, sid string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var (
+		now       = time.Now()
+		clientIDs []string
+	)
+	for cid, exp := range s.sessions[sid] {
+		if now.Before(exp) {
+			clientIDs = append(clientIDs, cid)
+		}
+	}
+	sort.Strings(clientIDs)
+	return clientIDs, nil
+}
+
+// DeleteSession implements SessionStore.
+func (s *memorySessionStore) DeleteSession(ctx context.Context, sid string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.sessions, sid)
+	return nil
+}
@@ -0,0 +1,246 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultStatelessCodeLifetime is the default lifetime of stateless authorization codes.
+const DefaultStatelessCodeLifetime = time.Minute
+
+type (
+	// StatelessCodeProvider is the interface that providers must implement to be used with
+	// stateless authorization codes, see WithStatelessCodes. The controller calls
+	// AuthorizeGrant instead of Provider.Authorize and IssueGrant instead of
+	// Provider.Exchange.
+	StatelessCodeProvider interface {
+		// AuthorizeGrant validates the authorization request the same way
+		// Provider.Authorize does but returns the scope granted by the resource owner
+		// instead of an authorization code. The controller creates the code.
+		AuthorizeGrant(ctx context.Context, req *AuthorizationRequest) (scope string, err error)
+
+		// IssueGrant issues a refresh and access token pair for the given grant. The
+		// controller has already checked that the code was created for the authenticated
+		// client and redirect URI, that it has not expired, that it has not been redeemed
+		// before and that the PKCE code verifier matches the challenge if any.
+		IssueGrant(ctx context.Context, g *CodeGrant) (refreshToken, accessToken string, expiresIn int, err error)
+	}
+
+	// CodeGrant is the content of a stateless authorization code.
+	CodeGrant struct {
+		// ID is the unique identifier of the code used to detect replays.
+		ID string `json:"jti"`
+		// ClientID is the identifier of the client the code was issued to.
+		ClientID string `json:"cid"`
+		// RedirectURI is the redirection endpoint used in the authorization request.
+		RedirectURI string `json:"uri"`
+		// Scope is the scope granted by the resource owner.
+		Scope string `json:"scope,omitempty"`
+		// Subject is the identifier of the resource owner.
+		Subject string `json:"sub,omitempty"`
+		// CodeChallenge is the PKCE code challenge if any.
+		CodeChallenge string `json:"cc,omitempty"`
+		// CodeChallengeMethod is the PKCE code challenge method if any.
+		CodeChallengeMethod string `json:"ccm,omitempty"`
+		// AuthorizationDetails contains the authorization details of the authorization
+		// request if any.
+		AuthorizationDetails []AuthorizationDetail `json:"ad,omitempty"`
+		// Nonce is the OpenID Connect nonce of the authorization request if any.
+		Nonce string `json:"nonce,omitempty"`
+		// AuthTime is the time when the resource owner authenticated, the zero time if
+		// unknown.
+		AuthTime time.Time `json:"auth"`
+		// ACR is the authentication context class reference satisfied by the
+		// authentication if any.
+		ACR string `json:"acr,omitempty"`
+		// SessionID is the identifier of the session of the resource owner with the
+		// authorization server if any.
+		SessionID string `json:"sid,omitempty"`
+		// Resources lists the resource indicators of the authorization request if any,
+		// restricted to the resources requested in the token request if any.
+		Resources []string `json:"res,omitempty"`
+		// Audience lists the audience of the access token, one value per resource server
+		// listed in Resources. It is set when the code is redeemed.
+		Audience []string `json:"-"`
+		// AccessTokenLifetime is the access token lifetime set by the resource servers
+		// listed in Resources. It is set when the code is redeemed.
+		AccessTokenLifetime time.Duration `json:"-"`
+		// DPoPJKT is the JWK SHA-256 thumbprint of the key used to sign the DPoP proof of
+		// the token request if any. It is set when the code is redeemed.
+		DPoPJKT string `json:"-"`
+		// ExpiresAt is the code expiration time.
+		ExpiresAt time.Time `json:"exp"`
+	}
+
+	// CodeKey is a key used to encrypt stateless authorization codes.
+	CodeKey struct {
+		// ID identifies the key. It is stored in clear in the codes so that they can be
+		// decrypted with the right key after a rotation. It must not contain ".".
+		ID string
+		// Secret is the AES key, it must be 16, 24 or 32 bytes long.
+		Secret []byte
+	}
+
+	// StatelessCodes creates and redeems authorization codes that carry the grant encrypted
+	// with AES-GCM instead of being persisted by the provider. Single-use semantics are
+	// preserved by recording the identifier of redeemed codes in a replay cache until they
+	// expire.
+	StatelessCodes struct {
+		// Lifetime is the lifetime of the codes.
+		Lifetime time.Duration
+
+		lock   sync.RWMutex
+		keys   []string               // Key IDs, the first one is used to encrypt
+		aeads  map[string]cipher.AEAD // AEADs indexed by key ID
+		replay ReplayCache
+		now    func() time.Time
+	}
+)
+
+// NewStatelessCodes creates stateless codes encrypted with the first given key. The other keys
+// are only used to decrypt codes created before a key rotation. The given replay cache records
+// redeemed codes, it defaults to an in-memory cache if nil which is only suitable for single
+// node deployments.
+func NewStatelessCodes(replay ReplayCache, keys ...CodeKey) (*StatelessCodes, error) {
+	if replay == nil {
+		replay = NewMemoryReplayCache()
+	}
+	s := &StatelessCodes{
+		Lifetime: DefaultStatelessCodeLifetime,
+		replay:   replay,
+		now:      time.Now,
+	}
+	if err := s.SetKeys(keys...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// WithStatelessCodes configures the controller to use the given stateless authorization codes.
+// The provider given to NewProviderController must implement StatelessCodeProvider,
+// NewProviderController logs an error and ignores the stateless codes otherwise.
+func WithStatelessCodes(s *StatelessCodes) ProviderOption {
+	return func(c *ProviderController) {
+		c.codes = s
+	}
+}
+
+// SetKeys replaces the keys used to encrypt and decrypt codes. Codes are encrypted with the
+// first key. To rotate keys set a new first key and keep the previous key for at least the code
+// lifetime so that the codes it encrypted can still be redeemed.
+func (s *StatelessCodes) SetKeys(keys ...CodeKey) error {
+	if len(keys) == 0 {
+		return errors.New("oauth2: stateless codes require at least one key")
+	}
+	ids := make([]string, len(keys))
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for i, k := range keys {
+		if k.ID == "" || strings.Contains(k.ID, ".") {
+			return errors.New(`oauth2: code key ID must be non empty and must not contain "."`)
+		}
+		block, err := aes.NewCipher(k.Secret)
+		if err != nil {
+			return err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		ids[i] = k.ID
+		aeads[k.ID] = aead
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.keys = ids
+	s.aeads = aeads
+	return nil
+}
+
+// create returns a new code for the given grant. It sets the grant identifier and expiration
+// time.
+func (s *StatelessCodes) create(g *CodeGrant) (string, error) {
+	id, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	g.ID = id
+	g.ExpiresAt = s.now().Add(s.Lifetime)
+	plain, err := json.Marshal(g)
+	if err != nil {
+		return "", err
+	}
+	s.lock.RLock()
+	kid := s.keys[0]
+	aead := s.aeads[kid]
+	s.lock.RUnlock()
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plain, []byte(kid))
+	return kid + "." + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// redeem decrypts the given code and checks that it can be redeemed by the given client with
+// the given redirect URI and PKCE code verifier. It records the code as redeemed.
+func (s *StatelessCodes) redeem(code, clientID, redirectURI, verifier string) (*CodeGrant, error) {
+	invalid := NewError(ErrInvalidGrant, "invalid authorization code", "")
+	g, err := s.open(code)
+	if err != nil {
+		return nil, invalid
+	}
+	if !s.now().Before(g.ExpiresAt) || g.ClientID != clientID || g.RedirectURI != redirectURI {
+		return nil, invalid
+	}
+	if !CheckCodeVerifier(g.CodeChallenge, g.CodeChallengeMethod, verifier) {
+		return nil, NewError(ErrInvalidGrant, "invalid code verifier", "")
+	}
+	fresh, err := s.replay.Use(g.ID, g.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, invalid
+	}
+	return g, nil
+}
+
+// open decrypts the given code.
+func (s *StatelessCodes) open(code string) (*CodeGrant, error) {
+	i := strings.IndexByte(code, '.')
+	if i < 0 {
+		return nil, errors.New("malformed code")
+	}
+	kid := code[:i]
+	s.lock.RLock()
+	aead, ok := s.aeads[kid]
+	s.lock.RUnlock()
+	if !ok {
+		return nil, errors.New("unknown key")
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(code[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("malformed code")
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, []byte(kid))
+	if err != nil {
+		return nil, err
+	}
+	var g CodeGrant
+	if err := json.Unmarshal(plain, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
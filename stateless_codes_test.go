@@ -0,0 +1,70 @@
+package oauth2
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestCodes(t *testing.T) *StatelessCodes {
+	codes, err := NewStatelessCodes(nil, CodeKey{ID: "k1", Secret: make([]byte, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codes
+}
+
+func TestStatelessCodeRedeem(t *testing.T) {
+	codes := newTestCodes(t)
+	code, err := codes.create(&CodeGrant{ClientID: "client", RedirectURI: "https://client.example.com/cb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codes.redeem(code, "other", "https://client.example.com/cb", ""); err == nil {
+		t.Error("expected an error when redeemed by another client")
+	}
+	if _, err := codes.redeem(code, "client", "https://client.example.com/cb", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codes.redeem(code, "client", "https://client.example.com/cb", ""); err == nil {
+		t.Error("expected an error when redeemed twice")
+	}
+}
+
+func TestStatelessCodeVerifier(t *testing.T) {
+	var (
+		verifier  = strings.Repeat("v", 43)
+		challenge = strings.Repeat("c", 43)
+	)
+	cases := []struct {
+		Name      string
+		Challenge string
+		Verifier  string
+		Valid     bool
+	}{
+		{"no challenge", "", "", true},
+		{"verifier without challenge", "", verifier, false},
+		{"matching verifier", verifier, verifier, true},
+		{"missing verifier", verifier, "", false},
+		{"wrong verifier", challenge, verifier, false},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			codes := newTestCodes(t)
+			g := &CodeGrant{ClientID: "client", RedirectURI: "https://client.example.com/cb", CodeChallenge: c.Challenge}
+			if c.Challenge != "" {
+				g.CodeChallengeMethod = PKCEMethodPlain
+			}
+			code, err := codes.create(g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = codes.redeem(code, "client", "https://client.example.com/cb", c.Verifier)
+			if c.Valid && err != nil {
+				t.Errorf("got error %v, expected none", err)
+			}
+			if !c.Valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,378 @@
+/*
+Package boltstore provides an implementation of store.Store on top of the bbolt embedded key-value
+store. It lets small deployments persist the state of the provider in a single file without
+running a separate database.
+
+Each kind of record is stored in its own bucket and encoded with JSON. Authorization codes and
+tokens that expire are also recorded in expiration index buckets whose keys start with the big
+endian expiration time so that DeleteExpired only visits the expired entries. Tokens are further
+indexed by grant so that RevokeGrant does not need to scan all the tokens.
+
+All the writes happen in bbolt transactions which are only acknowledged once synced to disk. In
+particular authorization codes are loaded and deleted in a single transaction so that a code can
+be redeemed at most once even if the process crashes.
+
+bbolt reuses the pages freed by deletions but never shrinks the database file. Use Compact to write
+a compacted copy of the database when DeleteExpired freed a large part of it.
+*/
+package boltstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/goadesign/oauth2/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store is a bbolt implementation of store.Store.
+type Store struct {
+	db *bolt.DB
+}
+
+// compactTxMaxSize is the size of the transactions used to copy the database in Compact.
+const compactTxMaxSize = 1 << 20
+
+// Bucket names.
+var (
+	clientsBucket     = []byte("oauth2_clients")
+	codesBucket       = []byte("oauth2_codes")
+	codeExpiryBucket  = []byte("oauth2_code_expiry")
+	tokensBucket      = []byte("oauth2_tokens")
+	tokenExpiryBucket = []byte("oauth2_token_expiry")
+	grantsBucket      = []byte("oauth2_grants")
+	consentsBucket    = []byte("oauth2_consents")
+)
+
+// Make sure Store implements store.Store.
+var _ store.Store = (*Store)(nil)
+
+// Open opens or creates the database file with the given path and returns a store that uses it.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	s, err := New(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// New returns a store that uses the given database. It creates the store buckets if they do not
+// exist yet.
+func New(db *bolt.DB) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		buckets := [][]byte{clientsBucket, codesBucket, codeExpiryBucket, tokensBucket,
+			tokenExpiryBucket, grantsBucket, consentsBucket}
+		for _, b := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Compact writes a compacted copy of the database to the file with the given path which must not
+// exist yet. The copy only contains the live records so that it may be much smaller than the
+// database file after many expired entries were deleted. Replace the database file with the copy
+// while no store uses it to reclaim the disk space.
+func (s *Store) Compact(path string) error {
+	dst, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	if err := bolt.Compact(dst, s.db, compactTxMaxSize); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// DeleteExpired deletes the authorization codes and tokens that expired at the given time. It
+// only visits the expired entries of the expiration indexes and should be called periodically.
+// Index entries that do not match a stored token are deleted.
+func (s *Store) DeleteExpired(now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var (
+			max    = expiryPrefix(now)
+			codes  = tx.Bucket(codesBucket)
+			tokens = tx.Bucket(tokensBucket)
+		)
+		c := tx.Bucket(codeExpiryBucket).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:8], max) <= 0; k, _ = c.First() {
+			if err := codes.Delete(k[8:]); err != nil {
+				return err
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		c = tx.Bucket(tokenExpiryBucket).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:8], max) <= 0; k, _ = c.First() {
+			t, err := loadToken(tokens, k[8:])
+			if err != nil && err != store.ErrNotFound {
+				return err
+			}
+			if err == store.ErrNotFound || !bytes.Equal(expiryKey(t.ExpiresAt, t.Signature), k) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := deleteToken(tx, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Client loads a client.
+func (s *Store) Client(id string) (*store.Client, error) {
+	var c store.Client
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return load(tx.Bucket(clientsBucket), []byte(id), &c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveClient creates or updates a client.
+func (s *Store) SaveClient(c *store.Client) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return save(tx.Bucket(clientsBucket), []byte(c.ID), c)
+	})
+}
+
+// DeleteClient deletes a client.
+func (s *Store) DeleteClient(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(clientsBucket).Delete([]byte(id))
+	})
+}
+
+// SaveCode persists an authorization code.
+func (s *Store) SaveCode(c *store.Code) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := save(tx.Bucket(codesBucket), []byte(c.Signature), c); err != nil {
+			return err
+		}
+		return tx.Bucket(codeExpiryBucket).Put(expiryKey(c.ExpiresAt, c.Signature), nil)
+	})
+}
+
+// ConsumeCode loads, checks and deletes an authorization code in a single transaction.
+func (s *Store) ConsumeCode(signature string, check func(*store.Code) error) (*store.Code, error) {
+	var c store.Code
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		codes := tx.Bucket(codesBucket)
+		if err := load(codes, []byte(signature), &c); err != nil {
+			return err
+		}
+		if err := check(&c); err != nil {
+			return err
+		}
+		if err := codes.Delete([]byte(signature)); err != nil {
+			return err
+		}
+		return tx.Bucket(codeExpiryBucket).Delete(expiryKey(c.ExpiresAt, c.Signature))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveToken persists a token.
+func (s *Store) SaveToken(t *store.Token) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		prev, err := loadToken(tx.Bucket(tokensBucket), []byte(t.Signature))
+		switch err {
+		case nil:
+			if err := deleteToken(tx, prev); err != nil {
+				return err
+			}
+		case store.ErrNotFound:
+		default:
+			return err
+		}
+		if err := save(tx.Bucket(tokensBucket), []byte(t.Signature), t); err != nil {
+			return err
+		}
+		if err := tx.Bucket(grantsBucket).Put(grantKey(t.GrantID, t.Signature), nil); err != nil {
+			return err
+		}
+		if t.ExpiresAt.IsZero() {
+			return nil
+		}
+		return tx.Bucket(tokenExpiryBucket).Put(expiryKey(t.ExpiresAt, t.Signature), nil)
+	})
+}
+
+// Token loads a token.
+func (s *Store) Token(signature string) (*store.Token, error) {
+	var t *store.Token
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		t, err = loadToken(tx.Bucket(tokensBucket), []byte(signature))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// DeleteToken deletes a token.
+func (s *Store) DeleteToken(signature string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		t, err := loadToken(tx.Bucket(tokensBucket), []byte(signature))
+		if err == store.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return deleteToken(tx, t)
+	})
+}
+
+// RevokeGrant deletes all the tokens of a grant.
+func (s *Store) RevokeGrant(grantID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var (
+			prefix = grantKey(grantID, "")
+			tokens = tx.Bucket(tokensBucket)
+			c      = tx.Bucket(grantsBucket).Cursor()
+		)
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+			t, err := loadToken(tokens, k[len(prefix):])
+			if err == store.ErrNotFound {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := deleteToken(tx, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Consent loads a consent.
+func (s *Store) Consent(subject, clientID string) (*store.Consent, error) {
+	var c store.Consent
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return load(tx.Bucket(consentsBucket), consentKey(subject, clientID), &c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveConsent creates or updates a consent.
+func (s *Store) SaveConsent(c *store.Consent) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return save(tx.Bucket(consentsBucket), consentKey(c.Subject, c.ClientID), c)
+	})
+}
+
+// DeleteConsent deletes a consent.
+func (s *Store) DeleteConsent(subject, clientID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(consentsBucket).Delete(consentKey(subject, clientID))
+	})
+}
+
+// deleteToken deletes the given token together with its index entries.
+func deleteToken(tx *bolt.Tx, t *store.Token) error {
+	if err := tx.Bucket(tokensBucket).Delete([]byte(t.Signature)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(grantsBucket).Delete(grantKey(t.GrantID, t.Signature)); err != nil {
+		return err
+	}
+	if t.ExpiresAt.IsZero() {
+		return nil
+	}
+	return tx.Bucket(tokenExpiryBucket).Delete(expiryKey(t.ExpiresAt, t.Signature))
+}
+
+// loadToken loads the token with the given signature from the given bucket.
+func loadToken(b *bolt.Bucket, signature []byte) (*store.Token, error) {
+	var t store.Token
+	if err := load(b, signature, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// load decodes the value stored under the given key into v. It returns store.ErrNotFound if
+// there is no such key.
+func load(b *bolt.Bucket, key []byte, v interface{}) error {
+	data := b.Get(key)
+	if data == nil {
+		return store.ErrNotFound
+	}
+	return json.Unmarshal(data, v)
+}
+
+// save encodes v and stores it under the given key.
+func save(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// expiryPrefix returns the big endian encoding of the given time which sorts chronologically.
+// Times before the Unix epoch are clamped to the epoch.
+func expiryPrefix(t time.Time) []byte {
+	n := t.UnixNano()
+	if n < 0 {
+		n = 0
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n))
+	return b
+}
+
+// expiryKey returns the key of the expiration index entry for the given expiration time and
+// signature.
+func expiryKey(t time.Time, signature string) []byte {
+	return append(expiryPrefix(t), signature...)
+}
+
+// grantKey returns the key of the grant index entry for the given grant and token signature.
+func grantKey(grantID, signature string) []byte {
+	return []byte(grantID + "\x00" + signature)
+}
+
+// consentKey returns the key of the consent given by the given subject to the given client.
+func consentKey(subject, clientID string) []byte {
+	return []byte(subject + "\x00" + clientID)
+}
@@ -0,0 +1,81 @@
+package boltstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goadesign/oauth2/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestStore(t *testing.T) *Store {
+	s, err := Open(filepath.Join(t.TempDir(), "oauth2.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestDeleteExpiredDanglingIndex(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Now()
+	tokens := []*store.Token{
+		{Signature: "expired", Kind: store.AccessToken, GrantID: "grant", ExpiresAt: now.Add(-time.Second)},
+		{Signature: "valid", Kind: store.AccessToken, GrantID: "grant", ExpiresAt: now.Add(time.Minute)},
+	}
+	for _, tok := range tokens {
+		if err := s.SaveToken(tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tokenExpiryBucket)
+		if err := b.Put(expiryKey(now.Add(-2*time.Second), "missing"), nil); err != nil {
+			return err
+		}
+		return b.Put(expiryKey(now.Add(-2*time.Second), "valid"), nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteExpired(now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Token("expired"); err != store.ErrNotFound {
+		t.Errorf("got error %v for the expired token, expected ErrNotFound", err)
+	}
+	if _, err := s.Token("valid"); err != nil {
+		t.Errorf("got error %v for the valid token, expected none", err)
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		if n := tx.Bucket(tokenExpiryBucket).Stats().KeyN; n != 1 {
+			t.Errorf("got %d expiration index entries, expected 1", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.SaveClient(&store.Client{ID: "client"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "compacted.db")
+	if err := s.Compact(path); err != nil {
+		t.Fatal(err)
+	}
+	compacted, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer compacted.Close()
+	if _, err := compacted.Client("client"); err != nil {
+		t.Errorf("got error %v, expected the client to be copied", err)
+	}
+}
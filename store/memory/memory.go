@@ -0,0 +1,320 @@
+/*
+Package memory provides a concurrency-safe in-memory implementation of store.Store suitable for
+local development, unit tests and single-node deployments. Expired authorization codes and tokens
+are purged by a background goroutine and the content of the store can be saved to and restored
+from a file.
+*/
+package memory
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/goadesign/oauth2/store"
+)
+
+// DefaultSweepInterval is the default interval between two purges of expired entries.
+const DefaultSweepInterval = time.Minute
+
+type (
+	// Store is an in-memory implementation of store.Store.
+	Store struct {
+		lock     sync.RWMutex
+		clients  map[string]store.Client
+		codes    map[string]store.Code
+		tokens   map[string]store.Token
+		consents map[consentKey]store.Consent
+
+		now      func() time.Time
+		interval time.Duration
+		done     chan struct{}
+		stop     sync.Once
+	}
+
+	// Option configures a Store.
+	Option func(*Store)
+
+	// consentKey is the key used to index consents.
+	consentKey struct {
+		subject  string
+		clientID string
+	}
+
+	// snapshot is the content of a store saved with Snapshot.
+	snapshot struct {
+		Clients  []store.Client
+		Codes    []store.Code
+		Tokens   []store.Token
+		Consents []store.Consent
+	}
+)
+
+// Make sure Store implements store.Store.
+var _ store.Store = (*Store)(nil)
+
+// WithClock sets the function used by the store to get the current time when purging expired
+// entries. It defaults to time.Now. Tests may use it together with Sweep to control expiry
+// deterministically.
+func WithClock(now func() time.Time) Option {
+	return func(s *Store) {
+		s.now = now
+	}
+}
+
+// WithSweepInterval sets the interval between two purges of expired entries by the background
+// goroutine. A zero or negative interval disables the background goroutine, expired entries
+// are then only purged by explicit calls to Sweep.
+func WithSweepInterval(d time.Duration) Option {
+	return func(s *Store) {
+		s.interval = d
+	}
+}
+
+// New creates an empty store and starts the goroutine that purges expired entries. Close stops
+// the goroutine.
+func New(opts ...Option) *Store {
+	s := &Store{
+		clients:  make(map[string]store.Client),
+		codes:    make(map[string]store.Code),
+		tokens:   make(map[string]store.Token),
+		consents: make(map[consentKey]store.Consent),
+		now:      time.Now,
+		interval: DefaultSweepInterval,
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.interval > 0 {
+		go s.sweep()
+	}
+	return s
+}
+
+// Close stops the goroutine that purges expired entries.
+func (s *Store) Close() error {
+	s.stop.Do(func() { close(s.done) })
+	return nil
+}
+
+// Sweep purges the expired authorization codes and tokens.
+func (s *Store) Sweep() {
+	now := s.now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for sig, c := range s.codes {
+		if c.Expired(now) {
+			delete(s.codes, sig)
+		}
+	}
+	for sig, t := range s.tokens {
+		if t.Expired(now) {
+			delete(s.tokens, sig)
+		}
+	}
+}
+
+// Snapshot saves the content of the store to the file with the given path. The file is
+// replaced atomically.
+func (s *Store) Snapshot(path string) error {
+	s.lock.RLock()
+	var snap snapshot
+	for _, c := range s.clients {
+		snap.Clients = append(snap.Clients, c)
+	}
+	for _, c := range s.codes {
+		snap.Codes = append(snap.Codes, c)
+	}
+	for _, t := range s.tokens {
+		snap.Tokens = append(snap.Tokens, t)
+	}
+	for _, c := range s.consents {
+		snap.Consents = append(snap.Consents, c)
+	}
+	s.lock.RUnlock()
+
+	b, err := json.Marshal(&snap)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Restore replaces the content of the store with the content of the file with the given path
+// created by Snapshot.
+func (s *Store) Restore(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clients = make(map[string]store.Client, len(snap.Clients))
+	for _, c := range snap.Clients {
+		s.clients[c.ID] = c
+	}
+	s.codes = make(map[string]store.Code, len(snap.Codes))
+	for _, c := range snap.Codes {
+		s.codes[c.Signature] = c
+	}
+	s.tokens = make(map[string]store.Token, len(snap.Tokens))
+	for _, t := range snap.Tokens {
+		s.tokens[t.Signature] = t
+	}
+	s.consents = make(map[consentKey]store.Consent, len(snap.Consents))
+	for _, c := range snap.Consents {
+		s.consents[consentKey{c.Subject, c.ClientID}] = c
+	}
+	return nil
+}
+
+// Client loads a client.
+func (s *Store) Client(id string) (*store.Client, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	c, ok := s.clients[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &c, nil
+}
+
+// SaveClient creates or updates a client.
+func (s *Store) SaveClient(c *store.Client) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clients[c.ID] = *c
+	return nil
+}
+
+// DeleteClient deletes a client.
+func (s *Store) DeleteClient(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.clients, id)
+	return nil
+}
+
+// SaveCode persists an authorization code.
+func (s *Store) SaveCode(c *store.Code) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.codes[c.Signature] = *c
+	return nil
+}
+
+// ConsumeCode loads, checks and deletes an authorization code.
+func (s *Store) ConsumeCode(signature string, check func(*store.Code) error) (*store.Code, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, ok := s.codes[signature]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	if err := check(&c); err != nil {
+		return nil, err
+	}
+	delete(s.codes, signature)
+	return &c, nil
+}
+
+// SaveToken persists a token.
+func (s *Store) SaveToken(t *store.Token) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tokens[t.Signature] = *t
+	return nil
+}
+
+// Token loads a token.
+func (s *Store) Token(signature string) (*store.Token, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	t, ok := s.tokens[signature]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &t, nil
+}
+
+// DeleteToken deletes a token.
+func (s *Store) DeleteToken(signature string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.tokens, signature)
+	return nil
+}
+
+// RevokeGrant deletes all the tokens of a grant.
+func (s *Store) RevokeGrant(grantID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for sig, t := range s.tokens {
+		if t.GrantID == grantID {
+			delete(s.tokens, sig)
+		}
+	}
+	return nil
+}
+
+// Consent loads a consent.
+func (s *Store) Consent(subject, clientID string) (*store.Consent, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	c, ok := s.consents[consentKey{subject, clientID}]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &c, nil
+}
+
+// SaveConsent creates or updates a consent.
+func (s *Store) SaveConsent(c *store.Consent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.consents[consentKey{c.Subject, c.ClientID}] = *c
+	return nil
+}
+
+// DeleteConsent deletes a consent.
+func (s *Store) DeleteConsent(subject, clientID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.consents, consentKey{subject, clientID})
+	return nil
+}
+
+// sweep purges expired entries periodically until the store is closed.
+func (s *Store) sweep() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Sweep()
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package memory
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goadesign/oauth2/store"
+)
+
+// testClock is a clock that only moves when advanced.
+type testClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func TestSweep(t *testing.T) {
+	clock := newTestClock()
+	s := New(WithClock(clock.Now), WithSweepInterval(0))
+	defer s.Close()
+	now := clock.Now()
+	if err := s.SaveCode(&store.Code{Signature: "code", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	tokens := []*store.Token{
+		{Signature: "access", Kind: store.AccessToken, ExpiresAt: now.Add(time.Hour)},
+		{Signature: "refresh", Kind: store.RefreshToken},
+	}
+	for _, tok := range tokens {
+		if err := s.SaveToken(tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.Sweep()
+	if _, err := s.ConsumeCode("code", func(*store.Code) error { return fmt.Errorf("keep") }); err == store.ErrNotFound {
+		t.Error("got the code purged before it expired")
+	}
+
+	clock.Advance(time.Minute)
+	s.Sweep()
+	if _, err := s.ConsumeCode("code", func(*store.Code) error { return nil }); err != store.ErrNotFound {
+		t.Errorf("got error %v for the expired code, expected ErrNotFound", err)
+	}
+	if _, err := s.Token("access"); err != nil {
+		t.Errorf("got error %v for the access token, expected none", err)
+	}
+
+	clock.Advance(time.Hour)
+	s.Sweep()
+	if _, err := s.Token("access"); err != store.ErrNotFound {
+		t.Errorf("got error %v for the expired access token, expected ErrNotFound", err)
+	}
+	if _, err := s.Token("refresh"); err != nil {
+		t.Errorf("got error %v for the token that never expires, expected none", err)
+	}
+}
+
+func TestBackgroundSweep(t *testing.T) {
+	clock := newTestClock()
+	s := New(WithClock(clock.Now), WithSweepInterval(time.Millisecond))
+	defer s.Close()
+	if err := s.SaveToken(&store.Token{Signature: "token", Kind: store.AccessToken, ExpiresAt: clock.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := s.Token("token"); err == store.ErrNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired token not purged by the background goroutine")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("got error %v when closing the store twice", err)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	var (
+		now     = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		client  = store.Client{ID: "client", RedirectURIs: []string{"https://client.example.com/cb"}}
+		code    = store.Code{Signature: "code", ClientID: "client", Scope: "api:read", ExpiresAt: now.Add(time.Minute)}
+		token   = store.Token{Signature: "token", Kind: store.RefreshToken, GrantID: "grant", ClientID: "client", ExpiresAt: now.Add(time.Hour)}
+		consent = store.Consent{Subject: "alice", ClientID: "client", Scope: "api:read", GrantedAt: now}
+		path    = filepath.Join(t.TempDir(), "snapshot.json")
+	)
+	s := New(WithSweepInterval(0))
+	defer s.Close()
+	if err := s.SaveClient(&client); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveCode(&code); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveToken(&token); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveConsent(&consent); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Snapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := New(WithSweepInterval(0))
+	defer restored.Close()
+	if err := restored.SaveClient(&store.Client{ID: "stale"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Restore(path); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := restored.Client("client"); err != nil || !reflect.DeepEqual(*c, client) {
+		t.Errorf("got client %+v and error %v, expected %+v", c, err, client)
+	}
+	if _, err := restored.Client("stale"); err != store.ErrNotFound {
+		t.Errorf("got error %v for a client missing from the snapshot, expected ErrNotFound", err)
+	}
+	if c, err := restored.ConsumeCode("code", func(*store.Code) error { return nil }); err != nil || !reflect.DeepEqual(*c, code) {
+		t.Errorf("got code %+v and error %v, expected %+v", c, err, code)
+	}
+	if tok, err := restored.Token("token"); err != nil || !reflect.DeepEqual(*tok, token) {
+		t.Errorf("got token %+v and error %v, expected %+v", tok, err, token)
+	}
+	if c, err := restored.Consent("alice", "client"); err != nil || !reflect.DeepEqual(*c, consent) {
+		t.Errorf("got consent %+v and error %v, expected %+v", c, err, consent)
+	}
+	if err := restored.Restore(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("got no error when restoring a missing snapshot")
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	s := New(WithSweepInterval(time.Millisecond))
+	defer s.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				sig := fmt.Sprintf("token-%d-%d", i, j)
+				if err := s.SaveToken(&store.Token{Signature: sig, GrantID: "grant", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := s.Token(sig); err != nil {
+					t.Error(err)
+					return
+				}
+				if j%10 == 0 {
+					s.RevokeGrant("other")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(s.tokens) != 800 {
+		t.Errorf("got %d tokens, expected 800", len(s.tokens))
+	}
+}
@@ -0,0 +1,661 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/goadesign/oauth2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Default lifetimes used by NewProvider.
+const (
+	// DefaultCodeLifetime is the default lifetime of authorization codes.
+	DefaultCodeLifetime = time.Minute
+	// DefaultAccessTokenLifetime is the default lifetime of access tokens.
+	DefaultAccessTokenLifetime = time.Hour
+	// DefaultRefreshTokenLifetime is the default lifetime of refresh tokens.
+	DefaultRefreshTokenLifetime = 30 * 24 * time.Hour
+)
+
+// Provider is an implementation of oauth2.Provider that persists clients, authorization codes,
+// tokens and consents in a Store. It also implements oauth2.RequestAuthorizer,
+// oauth2.RequestExchanger and oauth2.RequestRefresher so that authorization codes are bound to
+// the resource owner set in the request context with oauth2.WithSubject, to the PKCE code
+// challenge and to the resource indicators if any,
+// oauth2.GrantScoper so that the controller can enforce scope downscoping,
+// oauth2.StatelessCodeProvider so that it can be used with stateless authorization codes,
+// oauth2.ImplicitAuthorizer so that it supports the implicit and hybrid flows,
+// oauth2.AuthorizationDetailsGranter so that it supports rich authorization requests,
+// oauth2.DPoPBinder so that it supports DPoP and oauth2.TokenIntrospector so that it supports
+// token introspection.
+type Provider struct {
+	// CodeLifetime is the lifetime of authorization codes.
+	CodeLifetime time.Duration
+	// AccessTokenLifetime is the lifetime of access tokens.
+	AccessTokenLifetime time.Duration
+	// RefreshTokenLifetime is the lifetime of refresh tokens, refresh tokens never expire
+	// if zero.
+	RefreshTokenLifetime time.Duration
+	// Now returns the current time, it defaults to time.Now.
+	Now func() time.Time
+
+	store Store
+}
+
+var (
+	// Make sure Provider implements the optional provider interfaces.
+	_ oauth2.RequestAuthorizer     = (*Provider)(nil)
+	_ oauth2.RequestExchanger      = (*Provider)(nil)
+	_ oauth2.RequestRefresher      = (*Provider)(nil)
+	_ oauth2.GrantScoper           = (*Provider)(nil)
+	_ oauth2.StatelessCodeProvider = (*Provider)(nil)
+	_ oauth2.ClientRegistry        = (*Provider)(nil)
+	_ oauth2.ImplicitAuthorizer    = (*Provider)(nil)
+
+	_ oauth2.AuthorizationDetailsGranter = (*Provider)(nil)
+	_ oauth2.DPoPBinder                  = (*Provider)(nil)
+	_ oauth2.TokenIntrospector           = (*Provider)(nil)
+)
+
+// NewProvider creates a provider that persists its state in the given store.
+func NewProvider(s Store) *Provider {
+	return &Provider{
+		CodeLifetime:         DefaultCodeLifetime,
+		AccessTokenLifetime:  DefaultAccessTokenLifetime,
+		RefreshTokenLifetime: DefaultRefreshTokenLifetime,
+		Now:                  time.Now,
+		store:                s,
+	}
+}
+
+// HashSecret returns the bcrypt hash of the given client secret suitable for Client.SecretHash.
+func HashSecret(secret string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+}
+
+// Authorize creates an authorization code for an anonymous resource owner.
+func (p *Provider) Authorize(clientID, scope, redirectURI string) (string, error) {
+	return p.AuthorizeRequest(context.Background(), &oauth2.AuthorizationRequest{
+		ClientID:    clientID,
+		Scope:       scope,
+		RedirectURI: redirectURI,
+	})
+}
+
+// AuthorizeRequest makes sure the client exists, that the redirect URI is one of the client
+// registered URIs and that the scope does not exceed the client scope. It then records the
+// resource owner consent and creates a single-use authorization code bound to the client,
+// redirect URI, scope, resource owner, PKCE code challenge, authorization details and resource
+// indicators. The code also records the OpenID Connect nonce, the authentication time, class and
+// session of the request so that the token endpoint can issue an ID token.
+func (p *Provider) AuthorizeRequest(ctx context.Context, req *oauth2.AuthorizationRequest) (string, error) {
+	scope, err := p.AuthorizeGrant(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	code, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	err = p.store.SaveCode(&Code{
+		Signature:            signature(code),
+		ClientID:             req.ClientID,
+		RedirectURI:          req.RedirectURI,
+		Scope:                scope,
+		Subject:              req.Subject,
+		CodeChallenge:        req.CodeChallenge,
+		CodeChallengeMethod:  req.CodeChallengeMethod,
+		AuthorizationDetails: req.AuthorizationDetails,
+		Nonce:                req.Nonce,
+		AuthTime:             req.AuthTime,
+		ACR:                  req.ACR,
+		SessionID:            req.SessionID,
+		Resources:            req.Resources,
+		Audience:             req.Audience,
+		AccessTokenLifetime:  req.AccessTokenLifetime,
+		ExpiresAt:            p.Now().Add(p.CodeLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// AuthorizeGrant validates the authorization request and records the resource owner consent
+// like AuthorizeRequest but returns the granted scope instead of creating an authorization
+// code.
+func (p *Provider) AuthorizeGrant(ctx context.Context, req *oauth2.AuthorizationRequest) (string, error) {
+	client, err := p.client(req.ClientID)
+	if err != nil {
+		return "", err
+	}
+	if !oauth2Client(client).MatchRedirectURI(req.RedirectURI) {
+		return "", oauth2.NewError(oauth2.ErrInvalidRequest, "redirect URI is not registered", "")
+	}
+	if client.Native && req.CodeChallenge == "" {
+		return "", oauth2.NewError(oauth2.ErrInvalidRequest, "native apps must use PKCE", "")
+	}
+	scope, err := clientScope(client, req.Scope)
+	if err != nil {
+		return "", err
+	}
+	if req.Subject != "" {
+		consent := Consent{Subject: req.Subject, ClientID: client.ID, GrantedAt: p.Now()}
+		prev, err := p.store.Consent(req.Subject, client.ID)
+		switch err {
+		case nil:
+			granted, _ := oauth2.ParseScope(prev.Scope)
+			consent.Scope = oauth2.NewScopeSet(append(granted, scope...)...).String()
+		case ErrNotFound:
+			consent.Scope = scope.String()
+		default:
+			return "", err
+		}
+		if err := p.store.SaveConsent(&consent); err != nil {
+			return "", err
+		}
+	}
+	return scope.String(), nil
+}
+
+// AuthorizeImplicit validates the authorization request and records the resource owner consent
+// like AuthorizeRequest. If the response type includes "token" it issues an access token for the
+// requested resources that belongs to a new grant with no refresh token.
+func (p *Provider) AuthorizeImplicit(ctx context.Context, req *oauth2.AuthorizationRequest) (string, int, error) {
+	scope, err := p.AuthorizeGrant(ctx, req)
+	if err != nil {
+		return "", 0, err
+	}
+	token := false
+	for _, v := range strings.Fields(req.ResponseType) {
+		token = token || v == oauth2.ResponseTypeToken
+	}
+	if !token {
+		return "", 0, nil
+	}
+	grantID, err := newSecret()
+	if err != nil {
+		return "", 0, err
+	}
+	t := Token{
+		GrantID:              grantID,
+		ClientID:             req.ClientID,
+		Subject:              req.Subject,
+		Scope:                scope,
+		AuthorizationDetails: req.AuthorizationDetails,
+		Resources:            req.Resources,
+		Audience:             req.Audience,
+		AccessTokenLifetime:  req.AccessTokenLifetime,
+	}
+	accessToken, err := p.issue(AccessToken, t)
+	if err != nil {
+		return "", 0, err
+	}
+	return accessToken, p.expiresIn(t), nil
+}
+
+// Exchange redeems the given authorization code and issues a new pair of refresh and access
+// tokens.
+func (p *Provider) Exchange(clientID, code, redirectURI string) (string, string, int, error) {
+	return p.ExchangeRequest(context.Background(), &oauth2.ExchangeRequest{
+		ClientID:    clientID,
+		Code:        code,
+		RedirectURI: redirectURI,
+	})
+}
+
+// ExchangeRequest redeems the given authorization code and issues a new pair of refresh and
+// access tokens. It checks that the code verifier matches the code challenge if the code is
+// bound to one and that the requested authorization details and resources, if any, were granted
+// with the code. The access token is restricted to the requested authorization details and
+// resources while the refresh token keeps the ones granted with the code. The access token is
+// bound to the DPoP key of the request if any, so is the refresh token of public clients.
+// ExchangeRequest sets the authentication of the request to the one recorded with the code.
+func (p *Provider) ExchangeRequest(ctx context.Context, req *oauth2.ExchangeRequest) (string, string, int, error) {
+	var details []oauth2.AuthorizationDetail
+	c, err := p.store.ConsumeCode(signature(req.Code), func(c *Code) error {
+		if c.Expired(p.Now()) || c.ClientID != req.ClientID || c.RedirectURI != req.RedirectURI {
+			return oauth2.NewError(oauth2.ErrInvalidGrant, "invalid authorization code", "")
+		}
+		if !oauth2.CheckCodeVerifier(c.CodeChallenge, c.CodeChallengeMethod, req.CodeVerifier) {
+			return oauth2.NewError(oauth2.ErrInvalidGrant, "invalid code verifier", "")
+		}
+		if err := checkResources(c.Resources, req.Resources, req.CheckResourceScope, c.Scope); err != nil {
+			return err
+		}
+		var err error
+		details, err = narrowDetails(c.AuthorizationDetails, req.AuthorizationDetails)
+		return err
+	})
+	if err == ErrNotFound {
+		return "", "", 0, oauth2.NewError(oauth2.ErrInvalidGrant, "invalid authorization code", "")
+	}
+	if err != nil {
+		return "", "", 0, err
+	}
+	req.Authentication = &oauth2.Authentication{
+		Subject:   c.Subject,
+		Nonce:     c.Nonce,
+		AuthTime:  c.AuthTime,
+		ACR:       c.ACR,
+		SessionID: c.SessionID,
+	}
+	refresh := Token{
+		ClientID:             c.ClientID,
+		Subject:              c.Subject,
+		Scope:                c.Scope,
+		AuthorizationDetails: c.AuthorizationDetails,
+		Resources:            c.Resources,
+		Audience:             c.Audience,
+		AccessTokenLifetime:  c.AccessTokenLifetime,
+	}
+	access := refresh
+	access.AuthorizationDetails = details
+	if len(req.Resources) > 0 {
+		access.Resources, access.Audience, access.AccessTokenLifetime = req.Resources, req.Audience, req.AccessTokenLifetime
+	}
+	client, err := p.client(c.ClientID)
+	if err != nil {
+		return "", "", 0, err
+	}
+	p.bind(client, &refresh, &access, req.DPoPJKT)
+	return p.issueGrant(refresh, access)
+}
+
+// IssueGrant issues a new pair of refresh and access tokens for the grant carried by a
+// stateless authorization code.
+func (p *Provider) IssueGrant(ctx context.Context, g *oauth2.CodeGrant) (string, string, int, error) {
+	client, err := p.client(g.ClientID)
+	if err != nil {
+		return "", "", 0, err
+	}
+	t := Token{
+		ClientID:             g.ClientID,
+		Subject:              g.Subject,
+		Scope:                g.Scope,
+		AuthorizationDetails: g.AuthorizationDetails,
+		Resources:            g.Resources,
+		Audience:             g.Audience,
+		AccessTokenLifetime:  g.AccessTokenLifetime,
+	}
+	access := t
+	p.bind(client, &t, &access, g.DPoPJKT)
+	return p.issueGrant(t, access)
+}
+
+// Refresh issues a new access token for the grant of the given refresh token. The requested
+// scope must not exceed the scope of the refresh token. The access token has the authorization
+// details and resources of the refresh token.
+func (p *Provider) Refresh(refreshToken, scope string) (string, string, int, error) {
+	return p.RefreshRequest(context.Background(), &oauth2.RefreshRequest{RefreshToken: refreshToken, Scope: scope})
+}
+
+// RefreshRequest issues a new access token for the grant of the given refresh token like
+// Refresh. The refresh token must have been issued to the authenticated client if any and the
+// requested resources, if any, must have been granted with the refresh token. The access token
+// is then restricted to the requested resources. The access token is bound to the DPoP key of
+// the request if any, refresh tokens bound to a DPoP key can only be used with proofs signed
+// with the same key.
+func (p *Provider) RefreshRequest(ctx context.Context, req *oauth2.RefreshRequest) (string, string, int, error) {
+	t, err := p.token(RefreshToken, req.RefreshToken)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if req.ClientID != "" && req.ClientID != t.ClientID {
+		return "", "", 0, oauth2.NewError(oauth2.ErrInvalidGrant, "invalid "+string(RefreshToken), "")
+	}
+	if t.DPoPJKT != "" && t.DPoPJKT != req.DPoPJKT {
+		return "", "", 0, oauth2.NewError(oauth2.ErrInvalidGrant, "refresh token is bound to another DPoP key", "")
+	}
+	granted, err := oauth2.ParseScope(t.Scope)
+	if err != nil {
+		return "", "", 0, err
+	}
+	requested, err := oauth2.ParseScope(req.Scope)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if len(requested) == 0 {
+		requested = granted
+	}
+	if !requested.IsSubsetOf(granted) {
+		return "", "", 0, oauth2.NewError(oauth2.ErrInvalidScope, "requested scope exceeds the scope originally granted", "")
+	}
+	if err := checkResources(t.Resources, req.Resources, req.CheckResourceScope, requested.String()); err != nil {
+		return "", "", 0, err
+	}
+	access := Token{
+		GrantID:              t.GrantID,
+		ClientID:             t.ClientID,
+		Subject:              t.Subject,
+		Scope:                requested.String(),
+		AuthorizationDetails: t.AuthorizationDetails,
+		Resources:            t.Resources,
+		Audience:             t.Audience,
+		AccessTokenLifetime:  t.AccessTokenLifetime,
+		DPoPJKT:              req.DPoPJKT,
+	}
+	if len(req.Resources) > 0 {
+		access.Resources, access.Audience, access.AccessTokenLifetime = req.Resources, req.Audience, req.AccessTokenLifetime
+	}
+	accessToken, err := p.issue(AccessToken, access)
+	if err != nil {
+		return "", "", 0, err
+	}
+	return "", accessToken, p.expiresIn(access), nil
+}
+
+// Authenticate checks the given client secret against the client secret hash.
+func (p *Provider) Authenticate(clientID, clientSecret string) error {
+	client, err := p.client(clientID)
+	if err != nil {
+		return err
+	}
+	if len(client.SecretHash) == 0 || bcrypt.CompareHashAndPassword(client.SecretHash, []byte(clientSecret)) != nil {
+		return oauth2.NewError(oauth2.ErrInvalidClient, "invalid client credentials", "")
+	}
+	return nil
+}
+
+// RefreshTokenScope returns the scope of the given refresh token.
+func (p *Provider) RefreshTokenScope(refreshToken string) (string, error) {
+	t, err := p.token(RefreshToken, refreshToken)
+	if err != nil {
+		return "", err
+	}
+	return t.Scope, nil
+}
+
+// AccessTokenScope returns the scope of the given access token.
+func (p *Provider) AccessTokenScope(accessToken string) (string, error) {
+	t, err := p.token(AccessToken, accessToken)
+	if err != nil {
+		return "", err
+	}
+	return t.Scope, nil
+}
+
+// AccessTokenAuthorizationDetails returns the authorization details granted to the given access
+// token.
+func (p *Provider) AccessTokenAuthorizationDetails(ctx context.Context, accessToken string) ([]oauth2.AuthorizationDetail, error) {
+	t, err := p.token(AccessToken, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return t.AuthorizationDetails, nil
+}
+
+// AccessTokenJKT returns the thumbprint of the DPoP key the given access token is bound to.
+func (p *Provider) AccessTokenJKT(ctx context.Context, accessToken string) (string, error) {
+	t, err := p.token(AccessToken, accessToken)
+	if err != nil {
+		return "", err
+	}
+	return t.DPoPJKT, nil
+}
+
+// IntrospectToken describes the given access or refresh token. Expired and unknown tokens are
+// inactive. Refresh tokens are only described to the client they were issued to.
+func (p *Provider) IntrospectToken(ctx context.Context, token, tokenTypeHint string) (*oauth2.TokenIntrospection, error) {
+	t, err := p.store.Token(signature(token))
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Expired(p.Now()) || t.Kind == RefreshToken && t.ClientID != oauth2.ContextClientID(ctx) {
+		return nil, nil
+	}
+	ti := &oauth2.TokenIntrospection{
+		Active:               true,
+		Scope:                t.Scope,
+		ClientID:             t.ClientID,
+		Subject:              t.Subject,
+		ExpiresAt:            t.ExpiresAt,
+		Audience:             t.Audience,
+		AuthorizationDetails: t.AuthorizationDetails,
+	}
+	if t.Kind == AccessToken {
+		ti.TokenType = "Bearer"
+	}
+	if t.DPoPJKT != "" {
+		ti.Confirmation = &oauth2.Confirmation{JKT: t.DPoPJKT}
+		if t.Kind == AccessToken {
+			ti.TokenType = oauth2.DPoPTokenType
+		}
+	}
+	return ti, nil
+}
+
+// ValidateAccessToken returns the token record of the given access token if it is valid.
+// Resource servers may use it to authenticate requests made with the tokens issued by the
+// provider.
+func (p *Provider) ValidateAccessToken(accessToken string) (*Token, error) {
+	return p.token(AccessToken, accessToken)
+}
+
+// RevokeToken revokes the given access or refresh token. Revoking a refresh token also
+// revokes all the tokens issued for the same grant.
+func (p *Provider) RevokeToken(token string) error {
+	t, err := p.store.Token(signature(token))
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if t.Kind == RefreshToken {
+		return p.store.RevokeGrant(t.GrantID)
+	}
+	return p.store.DeleteToken(t.Signature)
+}
+
+// Client returns the client with the given identifier so that the provider can be used as the
+// controller client registry, see oauth2.WithClientRegistry.
+func (p *Provider) Client(ctx context.Context, id string) (*oauth2.Client, error) {
+	c, err := p.store.Client(id)
+	if err == ErrNotFound {
+		return nil, oauth2.ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return oauth2Client(c), nil
+}
+
+// client loads the client with the given identifier.
+func (p *Provider) client(id string) (*Client, error) {
+	c, err := p.store.Client(id)
+	if err == ErrNotFound {
+		return nil, oauth2.NewError(oauth2.ErrInvalidClient, "unknown client", "")
+	}
+	return c, err
+}
+
+// token loads the token with the given value and kind and makes sure it has not expired.
+func (p *Provider) token(kind TokenKind, value string) (*Token, error) {
+	t, err := p.store.Token(signature(value))
+	if err == ErrNotFound {
+		return nil, oauth2.NewError(oauth2.ErrInvalidGrant, "invalid "+string(kind), "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Kind != kind || t.Expired(p.Now()) {
+		return nil, oauth2.NewError(oauth2.ErrInvalidGrant, "invalid "+string(kind), "")
+	}
+	return t, nil
+}
+
+// issueGrant creates a new grant and issues its refresh and access tokens initialized from the
+// given token fields.
+func (p *Provider) issueGrant(refresh, access Token) (string, string, int, error) {
+	grantID, err := newSecret()
+	if err != nil {
+		return "", "", 0, err
+	}
+	refresh.GrantID, access.GrantID = grantID, grantID
+	refreshToken, err := p.issue(RefreshToken, refresh)
+	if err != nil {
+		return "", "", 0, err
+	}
+	accessToken, err := p.issue(AccessToken, access)
+	if err != nil {
+		return "", "", 0, err
+	}
+	return refreshToken, accessToken, p.expiresIn(access), nil
+}
+
+// issue generates and persists a new token of the given kind initialized from the given grant
+// fields.
+func (p *Provider) issue(kind TokenKind, t Token) (string, error) {
+	value, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	t.Signature = signature(value)
+	t.Kind = kind
+	lifetime := p.accessTokenLifetime(t)
+	if kind == RefreshToken {
+		lifetime = p.RefreshTokenLifetime
+	}
+	if lifetime > 0 {
+		t.ExpiresAt = p.Now().Add(lifetime)
+	}
+	if err := p.store.SaveToken(&t); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// bind binds the given access token fields to the given DPoP key thumbprint if any. The refresh
+// tokens of public clients are also bound to the key, see
+// https://tools.ietf.org/html/rfc9449#section-5
+func (p *Provider) bind(client *Client, refresh, access *Token, jkt string) {
+	access.DPoPJKT = jkt
+	if len(client.SecretHash) == 0 {
+		refresh.DPoPJKT = jkt
+	}
+}
+
+// accessTokenLifetime returns the lifetime of the access tokens issued with the given token
+// fields.
+func (p *Provider) accessTokenLifetime(t Token) time.Duration {
+	if t.AccessTokenLifetime > 0 {
+		return t.AccessTokenLifetime
+	}
+	return p.AccessTokenLifetime
+}
+
+// expiresIn returns the lifetime in seconds of the access tokens issued with the given token
+// fields.
+func (p *Provider) expiresIn(t Token) int {
+	return int(p.accessTokenLifetime(t).Seconds())
+}
+
+// oauth2Client converts the given client record.
+func oauth2Client(c *Client) *oauth2.Client {
+	return &oauth2.Client{
+		ID:                                c.ID,
+		RedirectURIs:                      c.RedirectURIs,
+		AllowLoopbackPort:                 c.AllowLoopbackPort,
+		Native:                            c.Native,
+		ResponseMode:                      c.ResponseMode,
+		ResponseTypes:                     c.ResponseTypes,
+		RequirePushedRequests:             c.RequirePushedRequests,
+		JWKS:                              c.JWKS,
+		RequireSignedRequestObject:        c.RequireSignedRequestObject,
+		RequestURIs:                       c.RequestURIs,
+		ResponseEncryptionAlg:             c.ResponseEncryptionAlg,
+		ResponseEncryptionEnc:             c.ResponseEncryptionEnc,
+		PostLogoutRedirectURIs:            c.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:              c.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:  c.BackchannelLogoutSessionRequired,
+		FrontchannelLogoutURI:             c.FrontchannelLogoutURI,
+		FrontchannelLogoutSessionRequired: c.FrontchannelLogoutSessionRequired,
+	}
+}
+
+// clientScope validates the requested scope against the client scope. It returns the client
+// scope if the requested scope is empty.
+func clientScope(c *Client, scope string) (oauth2.ScopeSet, error) {
+	requested, err := oauth2.ParseScope(scope)
+	if err != nil {
+		return nil, err
+	}
+	if c.Scope == "" {
+		return requested, nil
+	}
+	allowed, err := oauth2.ParseScope(c.Scope)
+	if err != nil {
+		return nil, err
+	}
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+	if !requested.IsSubsetOf(allowed) {
+		return nil, oauth2.NewError(oauth2.ErrInvalidScope, "requested scope exceeds the client scope", "")
+	}
+	return requested, nil
+}
+
+// narrowDetails returns the requested authorization details after making sure that each was
+// granted. It returns the granted authorization details if none are requested.
+func narrowDetails(granted, requested []oauth2.AuthorizationDetail) ([]oauth2.AuthorizationDetail, error) {
+	if requested == nil {
+		return granted, nil
+	}
+	for _, r := range requested {
+		found := false
+		for _, g := range granted {
+			if reflect.DeepEqual(r, g) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, oauth2.NewError(oauth2.ErrInvalidAuthorizationDetails, "requested authorization details exceed the authorization details originally granted", "")
+		}
+	}
+	return requested, nil
+}
+
+// checkResources makes sure that the requested resource indicators, if any, were granted and that
+// the given scope is accepted by the requested resource servers.
+func checkResources(granted, requested []string, checkScope func(string) error, scope string) error {
+	for _, r := range requested {
+		found := false
+		for _, g := range granted {
+			found = found || r == g
+		}
+		if !found {
+			return oauth2.NewError(oauth2.ErrInvalidTarget, "requested resource was not originally granted", "")
+		}
+	}
+	if len(requested) > 0 && checkScope != nil {
+		return checkScope(scope)
+	}
+	return nil
+}
+
+// newSecret generates a random URL safe value with 256 bits of entropy.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// signature returns the URL safe base64 encoding of the SHA256 hash of the given value.
+func signature(value string) string {
+	h := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
@@ -0,0 +1,279 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/goadesign/oauth2"
+	"github.com/goadesign/oauth2/store"
+	"github.com/goadesign/oauth2/store/memory"
+)
+
+// newTestProvider creates a provider backed by a memory store with the "client" and "other"
+// clients registered.
+func newTestProvider(t *testing.T) *store.Provider {
+	s := memory.New(memory.WithSweepInterval(0))
+	t.Cleanup(func() { s.Close() })
+	for _, id := range []string{"client", "other"} {
+		if err := s.SaveClient(&store.Client{ID: id, RedirectURIs: []string{"https://client.example.com/cb"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store.NewProvider(s)
+}
+
+func TestExchangeChecksBindingBeforeConsumingCode(t *testing.T) {
+	p := newTestProvider(t)
+	code, err := p.Authorize("client", "", "https://client.example.com/cb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []*oauth2.ExchangeRequest{
+		{ClientID: "other", Code: code, RedirectURI: "https://client.example.com/cb"},
+		{ClientID: "client", Code: code, RedirectURI: "https://attacker.example.com/cb"},
+	}
+	for _, req := range invalid {
+		if _, _, _, err := p.ExchangeRequest(context.Background(), req); err == nil {
+			t.Fatalf("exchange by %q with %q succeeded, expected an error", req.ClientID, req.RedirectURI)
+		}
+	}
+	req := &oauth2.ExchangeRequest{ClientID: "client", Code: code, RedirectURI: "https://client.example.com/cb"}
+	if _, _, _, err := p.ExchangeRequest(context.Background(), req); err != nil {
+		t.Fatalf("got error %v, expected the code to still be valid", err)
+	}
+	if _, _, _, err := p.ExchangeRequest(context.Background(), req); err == nil {
+		t.Error("expected an error when redeeming the code twice")
+	}
+}
+
+func TestAuthorizationDetails(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		p       = newTestProvider(t)
+		account = oauth2.AuthorizationDetail{"type": "account_information", "actions": []interface{}{"read"}}
+		payment = oauth2.AuthorizationDetail{"type": "payment_initiation", "creditorName": "Merchant"}
+	)
+	authorize := func() string {
+		code, err := p.AuthorizeRequest(ctx, &oauth2.AuthorizationRequest{
+			ClientID:             "client",
+			RedirectURI:          "https://client.example.com/cb",
+			AuthorizationDetails: []oauth2.AuthorizationDetail{account, payment},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	req := &oauth2.ExchangeRequest{
+		ClientID:             "client",
+		Code:                 authorize(),
+		RedirectURI:          "https://client.example.com/cb",
+		AuthorizationDetails: []oauth2.AuthorizationDetail{{"type": "payment_initiation", "creditorName": "Attacker"}},
+	}
+	if _, _, _, err := p.ExchangeRequest(ctx, req); err == nil {
+		t.Fatal("expected an error when requesting authorization details that were not granted")
+	}
+
+	req.AuthorizationDetails = []oauth2.AuthorizationDetail{payment}
+	refreshToken, accessToken, _, err := p.ExchangeRequest(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	details, err := p.AccessTokenAuthorizationDetails(ctx, accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(details) != 1 || details[0].Type() != "payment_initiation" {
+		t.Errorf("got access token authorization details %v, expected the payment only", details)
+	}
+	_, accessToken, _, err = p.Refresh(refreshToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details, _ := p.AccessTokenAuthorizationDetails(ctx, accessToken); len(details) != 2 {
+		t.Errorf("got refreshed access token authorization details %v, expected the granted details", details)
+	}
+}
+
+func TestIntrospectToken(t *testing.T) {
+	var (
+		p   = newTestProvider(t)
+		ctx = oauth2.WithClientID(context.Background(), "client")
+	)
+	code, err := p.Authorize("client", "api:read", "https://client.example.com/cb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, accessToken, _, err := p.Exchange("client", code, "https://client.example.com/cb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ti, err := p.IntrospectToken(ctx, accessToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti == nil || !ti.Active || ti.ClientID != "client" || ti.Scope != "api:read" || ti.TokenType != "Bearer" || ti.ExpiresAt.IsZero() {
+		t.Errorf("got access token introspection %+v", ti)
+	}
+	if ti, _ := p.IntrospectToken(ctx, refreshToken, "refresh_token"); ti == nil || !ti.Active {
+		t.Errorf("got refresh token introspection %+v, expected an active token", ti)
+	}
+	other := oauth2.WithClientID(context.Background(), "other")
+	if ti, _ := p.IntrospectToken(other, refreshToken, ""); ti != nil && ti.Active {
+		t.Error("expected the refresh token to be inactive for other clients")
+	}
+	if err := p.RevokeToken(refreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ := p.IntrospectToken(ctx, accessToken, ""); ti != nil && ti.Active {
+		t.Error("expected the access token to be inactive once revoked")
+	}
+}
+
+func TestResources(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		p         = newTestProvider(t)
+		billing   = "https://billing.example.com"
+		admin     = "https://admin.example.com"
+		checked   string
+		authorize = func() string {
+			code, err := p.AuthorizeRequest(ctx, &oauth2.AuthorizationRequest{
+				ClientID:            "client",
+				RedirectURI:         "https://client.example.com/cb",
+				Scope:               "billing:read admin",
+				Resources:           []string{billing, admin},
+				Audience:            []string{billing, "admin"},
+				AccessTokenLifetime: 5 * time.Minute,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return code
+		}
+	)
+	req := &oauth2.ExchangeRequest{
+		ClientID:           "client",
+		Code:               authorize(),
+		RedirectURI:        "https://client.example.com/cb",
+		Resources:          []string{"https://other.example.com"},
+		CheckResourceScope: func(scope string) error { return nil },
+	}
+	if _, _, _, err := p.ExchangeRequest(ctx, req); err == nil {
+		t.Fatal("expected an error when requesting a resource that was not granted")
+	}
+
+	req.Resources, req.Audience = []string{billing}, []string{billing}
+	req.CheckResourceScope = func(scope string) error {
+		checked = scope
+		return oauth2.NewError(oauth2.ErrInvalidScope, "scope not accepted", "")
+	}
+	if _, _, _, err := p.ExchangeRequest(ctx, req); err == nil || checked != "admin billing:read" {
+		t.Fatalf("got error %v after checking scope %q, expected the granted scope to be rejected", err, checked)
+	}
+
+	req.CheckResourceScope = nil
+	refreshToken, accessToken, expiresIn, err := p.ExchangeRequest(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresIn != int(store.DefaultAccessTokenLifetime.Seconds()) {
+		t.Errorf("got lifetime %d, expected the default lifetime", expiresIn)
+	}
+	if at, _ := p.ValidateAccessToken(accessToken); len(at.Audience) != 1 || at.Audience[0] != billing {
+		t.Errorf("got access token audience %v, expected %q", at.Audience, billing)
+	}
+
+	_, accessToken, expiresIn, err = p.RefreshRequest(ctx, &oauth2.RefreshRequest{ClientID: "client", RefreshToken: refreshToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresIn != 300 {
+		t.Errorf("got lifetime %d, expected the lifetime of the granted resources", expiresIn)
+	}
+	if at, _ := p.ValidateAccessToken(accessToken); len(at.Audience) != 2 {
+		t.Errorf("got refreshed access token audience %v, expected the granted audience", at.Audience)
+	}
+	if _, _, _, err := p.RefreshRequest(ctx, &oauth2.RefreshRequest{ClientID: "other", RefreshToken: refreshToken}); err == nil {
+		t.Error("expected an error when refreshing the token of another client")
+	}
+}
+
+func TestDPoPBinding(t *testing.T) {
+	var (
+		p   = newTestProvider(t)
+		ctx = oauth2.WithClientID(context.Background(), "client")
+	)
+	code, err := p.Authorize("client", "api:read", "https://client.example.com/cb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, accessToken, _, err := p.ExchangeRequest(ctx, &oauth2.ExchangeRequest{
+		ClientID:    "client",
+		Code:        code,
+		RedirectURI: "https://client.example.com/cb",
+		DPoPJKT:     "jkt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jkt, err := p.AccessTokenJKT(ctx, accessToken); err != nil || jkt != "jkt" {
+		t.Errorf("got thumbprint %q and error %v, expected the access token to be bound", jkt, err)
+	}
+	ti, err := p.IntrospectToken(ctx, accessToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.TokenType != oauth2.DPoPTokenType || ti.Confirmation == nil || ti.Confirmation.JKT != "jkt" {
+		t.Errorf("got access token introspection %+v, expected a DPoP-bound token", ti)
+	}
+
+	if _, _, _, err := p.RefreshRequest(ctx, &oauth2.RefreshRequest{ClientID: "client", RefreshToken: refreshToken}); err == nil {
+		t.Error("expected an error when refreshing a bound token without a DPoP proof")
+	}
+	if _, _, _, err := p.RefreshRequest(ctx, &oauth2.RefreshRequest{ClientID: "client", RefreshToken: refreshToken, DPoPJKT: "other"}); err == nil {
+		t.Error("expected an error when refreshing a bound token with another DPoP key")
+	}
+	_, accessToken, _, err = p.RefreshRequest(ctx, &oauth2.RefreshRequest{ClientID: "client", RefreshToken: refreshToken, DPoPJKT: "jkt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jkt, _ := p.AccessTokenJKT(ctx, accessToken); jkt != "jkt" {
+		t.Errorf("got thumbprint %q, expected the refreshed access token to be bound", jkt)
+	}
+}
+
+func TestExchangeAuthentication(t *testing.T) {
+	var (
+		ctx = context.Background()
+		p   = newTestProvider(t)
+	)
+	code, err := p.AuthorizeRequest(ctx, &oauth2.AuthorizationRequest{
+		ClientID:    "client",
+		RedirectURI: "https://client.example.com/cb",
+		Scope:       "openid",
+		Subject:     "alice",
+		Nonce:       "nonce",
+		AuthTime:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		ACR:         "urn:mace:incommon:iap:silver",
+		SessionID:   "sid",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &oauth2.ExchangeRequest{ClientID: "client", Code: code, RedirectURI: "https://client.example.com/cb"}
+	if _, _, _, err := p.ExchangeRequest(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	a := req.Authentication
+	if a == nil || a.Subject != "alice" || a.Nonce != "nonce" || a.ACR != "urn:mace:incommon:iap:silver" || a.SessionID != "sid" {
+		t.Fatalf("got authentication %+v, expected the one of the authorization request", a)
+	}
+	if !a.AuthTime.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got authentication time %v", a.AuthTime)
+	}
+}
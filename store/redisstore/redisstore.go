@@ -0,0 +1,378 @@
+/*
+Package redisstore provides an implementation of store.Store on top of Redis or any server that
+speaks the Redis protocol. It lets many replicas of a service share the state of the provider and
+relies on native key expiration to purge expired authorization codes and tokens.
+
+Authorization codes are deleted by a Lua script that checks they were not redeemed concurrently
+so that each code can be redeemed at most once across all replicas. No command or script
+accesses more than one key so that the store can be used with Redis Cluster. The store also implements oauth2.ReplayCache and
+oauth2.PushedRequestStore and provides fixed window counters that services may use to rate limit
+requests.
+*/
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/goadesign/oauth2"
+	"github.com/goadesign/oauth2/store"
+)
+
+// DefaultKeyPrefix is the default prefix of the keys created by the store.
+const DefaultKeyPrefix = "oauth2:"
+
+type (
+	// Store is a Redis implementation of store.Store.
+	Store struct {
+		client redis.Cmdable
+		prefix string
+		now    func() time.Time
+	}
+
+	// Option configures a Store.
+	Option func(*Store)
+)
+
+var (
+	// Make sure Store implements store.Store, oauth2.ReplayCache and
+	// oauth2.PushedRequestStore.
+	_ store.Store               = (*Store)(nil)
+	_ oauth2.ReplayCache        = (*Store)(nil)
+	_ oauth2.PushedRequestStore = (*Store)(nil)
+)
+
+// consumeScript deletes a key if it still holds the given value. KEYS[1] is the key and ARGV[1]
+// the value previously loaded, the script returns 1 if the key was deleted. Only one of the
+// concurrent attempts to consume the same value succeeds.
+var consumeScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// takeScript loads and deletes a key atomically. It is equivalent to GETDEL which is not
+// available before Redis 6.2.
+var takeScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v then
+	redis.call('DEL', KEYS[1])
+end
+return v
+`)
+
+// indexTokenScript adds a token to its grant index. The grant index lives as long as the
+// longest lived token of the grant. KEYS[1] is the grant key, ARGV[1] the token signature and
+// ARGV[2] the token lifetime in milliseconds or 0 if the token does not expire. The script only
+// accesses the grant key so that it works with Redis Cluster where the token and grant keys may
+// belong to different slots.
+var indexTokenScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+local ttl = tonumber(ARGV[2])
+redis.call('SADD', KEYS[1], ARGV[1])
+if ttl == 0 then
+	redis.call('PERSIST', KEYS[1])
+	return 1
+end
+local current = redis.call('PTTL', KEYS[1])
+if existed == 0 or (current >= 0 and current < ttl) then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+// countScript increments a counter and sets its expiration when it is created. KEYS[1] is the
+// counter key and ARGV[1] the window in milliseconds.
+var countScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// WithKeyPrefix sets the prefix of the keys created by the store. It defaults to
+// DefaultKeyPrefix. Use distinct prefixes to share a Redis database between multiple providers.
+func WithKeyPrefix(prefix string) Option {
+	return func(s *Store) {
+		s.prefix = prefix
+	}
+}
+
+// WithClock sets the function used by the store to compute the time to live of keys from
+// expiration times. It defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(s *Store) {
+		s.now = now
+	}
+}
+
+// New creates a store that uses the given Redis client, e.g. a *redis.Client.
+func New(client redis.Cmdable, opts ...Option) *Store {
+	s := &Store{client: client, prefix: DefaultKeyPrefix, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Use records the given identifier until the given expiration time. It returns false if the
+// identifier was already recorded and has not expired yet.
+func (s *Store) Use(id string, expiresAt time.Time) (bool, error) {
+	ttl := expiresAt.Sub(s.now())
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	return s.client.SetNX(s.prefix+"replay:"+id, 1, ttl).Result()
+}
+
+// Count increments the counter with the given key and returns its new value. The counter is
+// reset once the given window has elapsed since its first increment. Services may use Count to
+// rate limit requests, for example to the token endpoint:
+//
+//	n, err := s.Count("token:"+clientID, time.Minute)
+//	if err == nil && n > 100 {
+//		// Reject request
+//	}
+func (s *Store) Count(key string, window time.Duration) (int64, error) {
+	return countScript.Run(s.client, []string{s.prefix + "count:" + key}, milliseconds(window)).Int64()
+}
+
+// SavePushedRequest persists a pushed authorization request. The request key expires with the
+// request URI.
+func (s *Store) SavePushedRequest(ctx context.Context, requestURI string, r *oauth2.PushedRequest) error {
+	ttl := r.ExpiresAt.Sub(s.now())
+	if ttl < time.Millisecond {
+		return nil
+	}
+	return s.save(s.pushedRequestKey(requestURI), r, ttl)
+}
+
+// PushedRequest loads a pushed authorization request.
+func (s *Store) PushedRequest(ctx context.Context, requestURI string) (*oauth2.PushedRequest, error) {
+	var r oauth2.PushedRequest
+	err := s.load(s.pushedRequestKey(requestURI), &r)
+	if err == store.ErrNotFound {
+		return nil, oauth2.ErrPushedRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// TakePushedRequest loads and deletes a pushed authorization request atomically.
+func (s *Store) TakePushedRequest(ctx context.Context, requestURI string) (*oauth2.PushedRequest, error) {
+	data, err := takeScript.Run(s.client, []string{s.pushedRequestKey(requestURI)}).String()
+	if err == redis.Nil {
+		return nil, oauth2.ErrPushedRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r oauth2.PushedRequest
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Client loads a client.
+func (s *Store) Client(id string) (*store.Client, error) {
+	var c store.Client
+	if err := s.load(s.clientKey(id), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveClient creates or updates a client.
+func (s *Store) SaveClient(c *store.Client) error {
+	return s.save(s.clientKey(c.ID), c, 0)
+}
+
+// DeleteClient deletes a client.
+func (s *Store) DeleteClient(id string) error {
+	return s.client.Del(s.clientKey(id)).Err()
+}
+
+// SaveCode persists an authorization code. The code key expires with the code.
+func (s *Store) SaveCode(c *store.Code) error {
+	ttl := c.ExpiresAt.Sub(s.now())
+	if ttl < time.Millisecond {
+		return nil
+	}
+	return s.save(s.codeKey(c.Signature), c, ttl)
+}
+
+// ConsumeCode loads and checks an authorization code and deletes it if it was not consumed
+// concurrently.
+func (s *Store) ConsumeCode(signature string, check func(*store.Code) error) (*store.Code, error) {
+	key := s.codeKey(signature)
+	data, err := s.client.Get(key).Result()
+	if err == redis.Nil {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c store.Code
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		return nil, err
+	}
+	if err := check(&c); err != nil {
+		return nil, err
+	}
+	n, err := consumeScript.Run(s.client, []string{key}, data).Int()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, store.ErrNotFound
+	}
+	return &c, nil
+}
+
+// SaveToken persists a token. The token key expires with the token.
+func (s *Store) SaveToken(t *store.Token) error {
+	var ttl int64
+	if !t.ExpiresAt.IsZero() {
+		ttl = milliseconds(t.ExpiresAt.Sub(s.now()))
+		if ttl < 1 {
+			return nil
+		}
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := indexTokenScript.Run(s.client, []string{s.grantKey(t.GrantID)}, t.Signature, ttl).Err(); err != nil {
+		return err
+	}
+	return s.client.Set(s.tokenKey(t.Signature), data, time.Duration(ttl)*time.Millisecond).Err()
+}
+
+// Token loads a token.
+func (s *Store) Token(signature string) (*store.Token, error) {
+	var t store.Token
+	if err := s.load(s.tokenKey(signature), &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DeleteToken deletes a token.
+func (s *Store) DeleteToken(signature string) error {
+	t, err := s.Token(signature)
+	if err == store.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Pipelined(func(p redis.Pipeliner) error {
+		p.Del(s.tokenKey(signature))
+		p.SRem(s.grantKey(t.GrantID), signature)
+		return nil
+	})
+	return err
+}
+
+// RevokeGrant deletes all the tokens of a grant. The token keys are deleted one by one after
+// loading the grant index so that the store works with Redis Cluster.
+func (s *Store) RevokeGrant(grantID string) error {
+	key := s.grantKey(grantID)
+	sigs, err := s.client.SMembers(key).Result()
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Pipelined(func(p redis.Pipeliner) error {
+		for _, sig := range sigs {
+			p.Del(s.tokenKey(sig))
+		}
+		p.Del(key)
+		return nil
+	})
+	return err
+}
+
+// Consent loads a consent.
+func (s *Store) Consent(subject, clientID string) (*store.Consent, error) {
+	var c store.Consent
+	if err := s.load(s.consentKey(subject, clientID), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveConsent creates or updates a consent.
+func (s *Store) SaveConsent(c *store.Consent) error {
+	return s.save(s.consentKey(c.Subject, c.ClientID), c, 0)
+}
+
+// DeleteConsent deletes a consent.
+func (s *Store) DeleteConsent(subject, clientID string) error {
+	return s.client.Del(s.consentKey(subject, clientID)).Err()
+}
+
+// load decodes the value of the given key into v. It returns store.ErrNotFound if there is no
+// such key.
+func (s *Store) load(key string, v interface{}) error {
+	data, err := s.client.Get(key).Bytes()
+	if err == redis.Nil {
+		return store.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// save encodes v and stores it under the given key with the given time to live, the key never
+// expires if ttl is zero.
+func (s *Store) save(key string, v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(key, data, ttl).Err()
+}
+
+// clientKey returns the key of the client with the given identifier.
+func (s *Store) clientKey(id string) string {
+	return s.prefix + "client:" + id
+}
+
+// codeKey returns the key of the authorization code with the given signature.
+func (s *Store) codeKey(signature string) string {
+	return s.prefix + "code:" + signature
+}
+
+// tokenKey returns the key of the token with the given signature.
+func (s *Store) tokenKey(signature string) string {
+	return s.prefix + "token:" + signature
+}
+
+// grantKey returns the key of the set of signatures of the tokens issued for the given grant.
+func (s *Store) grantKey(grantID string) string {
+	return s.prefix + "grant:" + grantID
+}
+
+// consentKey returns the key of the consent given by the given subject to the given client.
+func (s *Store) consentKey(subject, clientID string) string {
+	return s.prefix + "consent:" + subject + "\x00" + clientID
+}
+
+// pushedRequestKey returns the key of the pushed authorization request with the given request
+// URI.
+func (s *Store) pushedRequestKey(requestURI string) string {
+	return s.prefix + "par:" + requestURI
+}
+
+// milliseconds returns the given duration in milliseconds.
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
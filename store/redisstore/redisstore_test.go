@@ -0,0 +1,154 @@
+package redisstore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/goadesign/oauth2"
+	"github.com/goadesign/oauth2/store"
+)
+
+// newTestStore creates a store backed by an in-process miniredis server.
+func newTestStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client), m
+}
+
+func TestConsumeCode(t *testing.T) {
+	s, _ := newTestStore(t)
+	code := &store.Code{Signature: "sig", ClientID: "client", ExpiresAt: time.Now().Add(time.Minute)}
+	if err := s.SaveCode(code); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ConsumeCode("sig", func(*store.Code) error { return store.ErrNotFound }); err == nil {
+		t.Fatal("expected the check error")
+	}
+
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		successes int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := s.ConsumeCode("sig", func(*store.Code) error { return nil })
+			switch {
+			case err == nil:
+				if c.ClientID != "client" {
+					t.Errorf("got client %q, expected %q", c.ClientID, "client")
+				}
+				lock.Lock()
+				successes++
+				lock.Unlock()
+			case err != store.ErrNotFound:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if successes != 1 {
+		t.Errorf("got %d successful redemptions, expected 1", successes)
+	}
+}
+
+func TestCodeExpiry(t *testing.T) {
+	s, m := newTestStore(t)
+	if err := s.SaveCode(&store.Code{Signature: "sig", ExpiresAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	m.FastForward(time.Minute)
+	if _, err := s.ConsumeCode("sig", func(*store.Code) error { return nil }); err != store.ErrNotFound {
+		t.Errorf("got error %v, expected ErrNotFound", err)
+	}
+}
+
+func TestUse(t *testing.T) {
+	s, m := newTestStore(t)
+	expiresAt := time.Now().Add(time.Minute)
+	if ok, err := s.Use("jti", expiresAt); err != nil || !ok {
+		t.Fatalf("got %v, %v for the first use, expected true", ok, err)
+	}
+	if ok, err := s.Use("jti", expiresAt); err != nil || ok {
+		t.Fatalf("got %v, %v for a replay, expected false", ok, err)
+	}
+	m.FastForward(time.Minute)
+	if ok, err := s.Use("jti", time.Now().Add(time.Minute)); err != nil || !ok {
+		t.Errorf("got %v, %v once expired, expected true", ok, err)
+	}
+}
+
+func TestCount(t *testing.T) {
+	s, m := newTestStore(t)
+	for i := int64(1); i <= 3; i++ {
+		n, err := s.Count("token:client", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != i {
+			t.Errorf("got count %d, expected %d", n, i)
+		}
+	}
+	m.FastForward(time.Minute)
+	if n, err := s.Count("token:client", time.Minute); err != nil || n != 1 {
+		t.Errorf("got count %d, %v once the window elapsed, expected 1", n, err)
+	}
+}
+
+func TestRevokeGrant(t *testing.T) {
+	s, m := newTestStore(t)
+	tokens := []*store.Token{
+		{Signature: "access", Kind: store.AccessToken, GrantID: "grant", ExpiresAt: time.Now().Add(time.Hour)},
+		{Signature: "refresh", Kind: store.RefreshToken, GrantID: "grant"},
+		{Signature: "other", Kind: store.AccessToken, GrantID: "other", ExpiresAt: time.Now().Add(time.Hour)},
+	}
+	for _, tok := range tokens {
+		if err := s.SaveToken(tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ttl := m.TTL(s.grantKey("grant")); ttl != 0 {
+		t.Errorf("got grant index TTL %v, expected none since the refresh token does not expire", ttl)
+	}
+
+	if err := s.RevokeGrant("grant"); err != nil {
+		t.Fatal(err)
+	}
+	for _, sig := range []string{"access", "refresh"} {
+		if _, err := s.Token(sig); err != store.ErrNotFound {
+			t.Errorf("got error %v for token %q, expected ErrNotFound", err, sig)
+		}
+	}
+	if m.Exists(s.grantKey("grant")) {
+		t.Error("expected the grant index to be deleted")
+	}
+	if _, err := s.Token("other"); err != nil {
+		t.Errorf("got error %v for the token of another grant, expected none", err)
+	}
+}
+
+func TestTakePushedRequest(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	r := &oauth2.PushedRequest{ClientID: "client", ExpiresAt: time.Now().Add(time.Minute)}
+	if err := s.SavePushedRequest(ctx, "uri", r); err != nil {
+		t.Fatal(err)
+	}
+	taken, err := s.TakePushedRequest(ctx, "uri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if taken.ClientID != "client" {
+		t.Errorf("got client %q, expected %q", taken.ClientID, "client")
+	}
+	if _, err := s.TakePushedRequest(ctx, "uri"); err != oauth2.ErrPushedRequestNotFound {
+		t.Errorf("got error %v when taking the request twice, expected ErrPushedRequestNotFound", err)
+	}
+}
@@ -0,0 +1,206 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is a versioned schema change.
+type migration struct {
+	version    int
+	statements func(d *Dialect) []string
+}
+
+// migrations lists the schema changes in order. Never modify a migration once released, add a
+// new one instead.
+var migrations = []migration{
+	{1, func(d *Dialect) []string {
+		return []string{
+			`CREATE TABLE oauth2_clients (
+				id VARCHAR(255) PRIMARY KEY,
+				secret_hash ` + d.bytes + `,
+				redirect_uris TEXT NOT NULL,
+				scope TEXT NOT NULL
+			)`,
+			`CREATE TABLE oauth2_codes (
+				signature VARCHAR(64) PRIMARY KEY,
+				client_id VARCHAR(255) NOT NULL,
+				redirect_uri TEXT NOT NULL,
+				scope TEXT NOT NULL,
+				subject VARCHAR(255) NOT NULL,
+				expires_at BIGINT NOT NULL
+			)`,
+			`CREATE INDEX oauth2_codes_expires_at ON oauth2_codes (expires_at)`,
+			`CREATE TABLE oauth2_tokens (
+				signature VARCHAR(64) PRIMARY KEY,
+				kind VARCHAR(32) NOT NULL,
+				grant_id VARCHAR(64) NOT NULL,
+				client_id VARCHAR(255) NOT NULL,
+				subject VARCHAR(255) NOT NULL,
+				scope TEXT NOT NULL,
+				expires_at BIGINT
+			)`,
+			`CREATE INDEX oauth2_tokens_grant_id ON oauth2_tokens (grant_id)`,
+			`CREATE INDEX oauth2_tokens_expires_at ON oauth2_tokens (expires_at)`,
+			`CREATE TABLE oauth2_consents (
+				subject VARCHAR(255) NOT NULL,
+				client_id VARCHAR(255) NOT NULL,
+				scope TEXT NOT NULL,
+				granted_at BIGINT NOT NULL,
+				PRIMARY KEY (subject, client_id)
+			)`,
+		}
+	}},
+	{2, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_codes ADD COLUMN code_challenge VARCHAR(128) NOT NULL DEFAULT ''`,
+			`ALTER TABLE oauth2_codes ADD COLUMN code_challenge_method VARCHAR(16) NOT NULL DEFAULT ''`,
+		}
+	}},
+	{3, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_clients ADD COLUMN allow_loopback_port BOOLEAN NOT NULL DEFAULT FALSE`,
+		}
+	}},
+	{4, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_clients ADD COLUMN native BOOLEAN NOT NULL DEFAULT FALSE`,
+		}
+	}},
+	{5, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_clients ADD COLUMN response_mode VARCHAR(32) NOT NULL DEFAULT ''`,
+		}
+	}},
+	{6, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_clients ADD COLUMN response_types TEXT`,
+		}
+	}},
+	{7, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_clients ADD COLUMN require_pushed_requests BOOLEAN NOT NULL DEFAULT FALSE`,
+		}
+	}},
+	{8, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_clients ADD COLUMN jwks TEXT`,
+			`ALTER TABLE oauth2_clients ADD COLUMN require_signed_request_object BOOLEAN NOT NULL DEFAULT FALSE`,
+		}
+	}},
+	{9, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_clients ADD COLUMN response_encryption_alg VARCHAR(32) NOT NULL DEFAULT ''`,
+			`ALTER TABLE oauth2_clients ADD COLUMN response_encryption_enc VARCHAR(32) NOT NULL DEFAULT ''`,
+		}
+	}},
+	{10, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_clients ADD COLUMN post_logout_redirect_uris TEXT`,
+		}
+	}},
+	{11, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_clients ADD COLUMN backchannel_logout_uri TEXT`,
+			`ALTER TABLE oauth2_clients ADD COLUMN backchannel_logout_session_required BOOLEAN NOT NULL DEFAULT FALSE`,
+			`ALTER TABLE oauth2_clients ADD COLUMN frontchannel_logout_uri TEXT`,
+			`ALTER TABLE oauth2_clients ADD COLUMN frontchannel_logout_session_required BOOLEAN NOT NULL DEFAULT FALSE`,
+		}
+	}},
+	{12, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_clients ADD COLUMN request_uris TEXT`,
+		}
+	}},
+	{13, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_codes ADD COLUMN authorization_details TEXT`,
+			`ALTER TABLE oauth2_tokens ADD COLUMN authorization_details TEXT`,
+		}
+	}},
+	{14, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_codes ADD COLUMN resources TEXT`,
+			`ALTER TABLE oauth2_codes ADD COLUMN audience TEXT`,
+			`ALTER TABLE oauth2_codes ADD COLUMN access_token_lifetime BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE oauth2_tokens ADD COLUMN resources TEXT`,
+			`ALTER TABLE oauth2_tokens ADD COLUMN audience TEXT`,
+			`ALTER TABLE oauth2_tokens ADD COLUMN access_token_lifetime BIGINT NOT NULL DEFAULT 0`,
+		}
+	}},
+	{15, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_tokens ADD COLUMN dpop_jkt VARCHAR(64) NOT NULL DEFAULT ''`,
+		}
+	}},
+	{16, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_codes ADD COLUMN nonce VARCHAR(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE oauth2_codes ADD COLUMN session_id VARCHAR(255) NOT NULL DEFAULT ''`,
+		}
+	}},
+	{17, func(d *Dialect) []string {
+		return []string{
+			`ALTER TABLE oauth2_codes ADD COLUMN auth_time BIGINT`,
+			`ALTER TABLE oauth2_codes ADD COLUMN acr VARCHAR(255) NOT NULL DEFAULT ''`,
+		}
+	}},
+}
+
+// Migrate creates the schema migrations table if needed then applies the migrations that have
+// not been applied yet in order. Each migration runs in its own transaction on databases that
+// support transactional DDL.
+func (s *Store) Migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS oauth2_schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := s.apply(m); err != nil {
+			return fmt.Errorf("migration %d: %s", m.version, err)
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the version of the last migration applied to the database, 0 if none
+// was.
+func (s *Store) SchemaVersion() (int, error) {
+	var version sql.NullInt64
+	err := s.db.QueryRow(`SELECT MAX(version) FROM oauth2_schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// apply runs the statements of the given migration and records it.
+func (s *Store) apply(m migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range m.statements(s.dialect) {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	q := s.dialect.rebind(`INSERT INTO oauth2_schema_migrations (version, applied_at) VALUES (?, ?)`)
+	if _, err := tx.Exec(q, m.version, time.Now().UnixNano()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
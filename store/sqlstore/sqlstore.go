@@ -0,0 +1,417 @@
+/*
+Package sqlstore provides an implementation of store.Store on top of database/sql. It supports
+PostgreSQL, MySQL and SQLite through the corresponding dialects. The database schema is created
+and upgraded with versioned migrations applied by Migrate.
+
+The store only ever sees the signatures (SHA256 hashes) of authorization codes and tokens
+computed by store.Provider so that raw values are never persisted.
+*/
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goadesign/oauth2/store"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+type (
+	// Store is a database/sql implementation of store.Store.
+	Store struct {
+		db      *sql.DB
+		dialect *Dialect
+	}
+
+	// Dialect captures the differences between the SQL databases supported by Store.
+	Dialect struct {
+		// Name is the name of the dialect.
+		Name string
+		// numbered is true if bind parameters are numbered ($1, $2...) rather than "?".
+		numbered bool
+		// bytes is the column type used to store binary data.
+		bytes string
+	}
+
+	// queryer is implemented by both *sql.DB and *sql.Tx.
+	queryer interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+		QueryRow(query string, args ...interface{}) *sql.Row
+	}
+)
+
+var (
+	// Postgres is the PostgreSQL dialect.
+	Postgres = &Dialect{Name: "postgres", numbered: true, bytes: "BYTEA"}
+	// MySQL is the MySQL dialect.
+	MySQL = &Dialect{Name: "mysql", bytes: "VARBINARY(255)"}
+	// SQLite is the SQLite dialect.
+	SQLite = &Dialect{Name: "sqlite", bytes: "BLOB"}
+)
+
+// Make sure Store implements store.Store.
+var _ store.Store = (*Store)(nil)
+
+// New creates a store that uses the given database and dialect. Call Migrate to create or
+// upgrade the database schema before using the store.
+func New(db *sql.DB, d *Dialect) *Store {
+	return &Store{db: db, dialect: d}
+}
+
+// DeleteExpired deletes the authorization codes and tokens that expired at the given time. It
+// relies on the indexes on the expiration columns and should be called periodically.
+func (s *Store) DeleteExpired(now time.Time) error {
+	n := now.UnixNano()
+	if _, err := s.exec(s.db, `DELETE FROM oauth2_codes WHERE expires_at <= ?`, n); err != nil {
+		return err
+	}
+	_, err := s.exec(s.db, `DELETE FROM oauth2_tokens WHERE expires_at IS NOT NULL AND expires_at <= ?`, n)
+	return err
+}
+
+// Client loads a client.
+func (s *Store) Client(id string) (*store.Client, error) {
+	var (
+		c     = store.Client{ID: id}
+		uris  string
+		types sql.NullString
+		jwks  sql.NullString
+		plrs  sql.NullString
+		bclu  sql.NullString
+		fclu  sql.NullString
+		rqus  sql.NullString
+	)
+	err := s.queryRow(s.db, `SELECT secret_hash, redirect_uris, scope, allow_loopback_port, native, response_mode, response_types, require_pushed_requests, jwks, require_signed_request_object, response_encryption_alg, response_encryption_enc, post_logout_redirect_uris, backchannel_logout_uri, backchannel_logout_session_required, frontchannel_logout_uri, frontchannel_logout_session_required, request_uris FROM oauth2_clients WHERE id = ?`, id).
+		Scan(&c.SecretHash, &uris, &c.Scope, &c.AllowLoopbackPort, &c.Native, &c.ResponseMode, &types, &c.RequirePushedRequests, &jwks, &c.RequireSignedRequestObject, &c.ResponseEncryptionAlg, &c.ResponseEncryptionEnc, &plrs,
+			&bclu, &c.BackchannelLogoutSessionRequired, &fclu, &c.FrontchannelLogoutSessionRequired, &rqus)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(uris), &c.RedirectURIs); err != nil {
+		return nil, err
+	}
+	if types.Valid && types.String != "" {
+		if err := json.Unmarshal([]byte(types.String), &c.ResponseTypes); err != nil {
+			return nil, err
+		}
+	}
+	if jwks.Valid && jwks.String != "" {
+		c.JWKS = &jose.JSONWebKeySet{}
+		if err := json.Unmarshal([]byte(jwks.String), c.JWKS); err != nil {
+			return nil, err
+		}
+	}
+	if plrs.Valid && plrs.String != "" {
+		if err := json.Unmarshal([]byte(plrs.String), &c.PostLogoutRedirectURIs); err != nil {
+			return nil, err
+		}
+	}
+	if rqus.Valid && rqus.String != "" {
+		if err := json.Unmarshal([]byte(rqus.String), &c.RequestURIs); err != nil {
+			return nil, err
+		}
+	}
+	c.BackchannelLogoutURI, c.FrontchannelLogoutURI = bclu.String, fclu.String
+	return &c, nil
+}
+
+// SaveClient creates or updates a client.
+func (s *Store) SaveClient(c *store.Client) error {
+	uris, err := json.Marshal(c.RedirectURIs)
+	if err != nil {
+		return err
+	}
+	types, err := json.Marshal(c.ResponseTypes)
+	if err != nil {
+		return err
+	}
+	plrs, err := json.Marshal(c.PostLogoutRedirectURIs)
+	if err != nil {
+		return err
+	}
+	rqus, err := json.Marshal(c.RequestURIs)
+	if err != nil {
+		return err
+	}
+	var jwks sql.NullString
+	if c.JWKS != nil {
+		b, err := json.Marshal(c.JWKS)
+		if err != nil {
+			return err
+		}
+		jwks = sql.NullString{String: string(b), Valid: true}
+	}
+	return s.replace(`DELETE FROM oauth2_clients WHERE id = ?`, []interface{}{c.ID},
+		`INSERT INTO oauth2_clients (id, secret_hash, redirect_uris, scope, allow_loopback_port, native, response_mode, response_types, require_pushed_requests, jwks, require_signed_request_object, response_encryption_alg, response_encryption_enc, post_logout_redirect_uris, backchannel_logout_uri, backchannel_logout_session_required, frontchannel_logout_uri, frontchannel_logout_session_required, request_uris) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.SecretHash, string(uris), c.Scope, c.AllowLoopbackPort, c.Native, c.ResponseMode, string(types), c.RequirePushedRequests, jwks, c.RequireSignedRequestObject,
+		c.ResponseEncryptionAlg, c.ResponseEncryptionEnc, string(plrs), c.BackchannelLogoutURI, c.BackchannelLogoutSessionRequired,
+		c.FrontchannelLogoutURI, c.FrontchannelLogoutSessionRequired, string(rqus))
+}
+
+// DeleteClient deletes a client.
+func (s *Store) DeleteClient(id string) error {
+	_, err := s.exec(s.db, `DELETE FROM oauth2_clients WHERE id = ?`, id)
+	return err
+}
+
+// SaveCode persists an authorization code.
+func (s *Store) SaveCode(c *store.Code) error {
+	details, err := nullJSON(c.AuthorizationDetails, c.AuthorizationDetails != nil)
+	if err != nil {
+		return err
+	}
+	resources, err := nullJSON(c.Resources, len(c.Resources) > 0)
+	if err != nil {
+		return err
+	}
+	audience, err := nullJSON(c.Audience, len(c.Audience) > 0)
+	if err != nil {
+		return err
+	}
+	var authTime sql.NullInt64
+	if !c.AuthTime.IsZero() {
+		authTime = sql.NullInt64{Int64: c.AuthTime.UnixNano(), Valid: true}
+	}
+	_, err = s.exec(s.db, `INSERT INTO oauth2_codes (signature, client_id, redirect_uri, scope, subject, code_challenge, code_challenge_method, authorization_details, nonce, auth_time, acr, session_id, resources, audience, access_token_lifetime, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.Signature, c.ClientID, c.RedirectURI, c.Scope, c.Subject, c.CodeChallenge, c.CodeChallengeMethod, details, c.Nonce, authTime, c.ACR, c.SessionID, resources, audience, int64(c.AccessTokenLifetime), c.ExpiresAt.UnixNano())
+	return err
+}
+
+// ConsumeCode loads, checks and deletes an authorization code in a single transaction.
+// Concurrent attempts to consume the same code result in at most one success.
+func (s *Store) ConsumeCode(signature string, check func(*store.Code) error) (*store.Code, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		c         = store.Code{Signature: signature}
+		details   sql.NullString
+		resources sql.NullString
+		audience  sql.NullString
+		authTime  sql.NullInt64
+		lifetime  int64
+		expiresAt int64
+	)
+	err = s.queryRow(tx, `SELECT client_id, redirect_uri, scope, subject, code_challenge, code_challenge_method, authorization_details, nonce, auth_time, acr, session_id, resources, audience, access_token_lifetime, expires_at FROM oauth2_codes WHERE signature = ?`, signature).
+		Scan(&c.ClientID, &c.RedirectURI, &c.Scope, &c.Subject, &c.CodeChallenge, &c.CodeChallengeMethod, &details, &c.Nonce, &authTime, &c.ACR, &c.SessionID, &resources, &audience, &lifetime, &expiresAt)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+	for _, col := range []struct {
+		value sql.NullString
+		dest  interface{}
+	}{{details, &c.AuthorizationDetails}, {resources, &c.Resources}, {audience, &c.Audience}} {
+		if err := scanJSON(col.value, col.dest); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if authTime.Valid {
+		c.AuthTime = time.Unix(0, authTime.Int64)
+	}
+	c.AccessTokenLifetime = time.Duration(lifetime)
+	c.ExpiresAt = time.Unix(0, expiresAt)
+	if err := check(&c); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	res, err := s.exec(tx, `DELETE FROM oauth2_codes WHERE signature = ?`, signature)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		tx.Rollback()
+		if err != nil {
+			return nil, err
+		}
+		return nil, store.ErrNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveToken persists a token.
+func (s *Store) SaveToken(t *store.Token) error {
+	var expiresAt sql.NullInt64
+	if !t.ExpiresAt.IsZero() {
+		expiresAt = sql.NullInt64{Int64: t.ExpiresAt.UnixNano(), Valid: true}
+	}
+	details, err := nullJSON(t.AuthorizationDetails, t.AuthorizationDetails != nil)
+	if err != nil {
+		return err
+	}
+	resources, err := nullJSON(t.Resources, len(t.Resources) > 0)
+	if err != nil {
+		return err
+	}
+	audience, err := nullJSON(t.Audience, len(t.Audience) > 0)
+	if err != nil {
+		return err
+	}
+	return s.replace(`DELETE FROM oauth2_tokens WHERE signature = ?`, []interface{}{t.Signature},
+		`INSERT INTO oauth2_tokens (signature, kind, grant_id, client_id, subject, scope, authorization_details, resources, audience, access_token_lifetime, dpop_jkt, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.Signature, string(t.Kind), t.GrantID, t.ClientID, t.Subject, t.Scope, details, resources, audience, int64(t.AccessTokenLifetime), t.DPoPJKT, expiresAt)
+}
+
+// Token loads a token.
+func (s *Store) Token(signature string) (*store.Token, error) {
+	var (
+		t         = store.Token{Signature: signature}
+		kind      string
+		details   sql.NullString
+		resources sql.NullString
+		audience  sql.NullString
+		lifetime  int64
+		expiresAt sql.NullInt64
+	)
+	err := s.queryRow(s.db, `SELECT kind, grant_id, client_id, subject, scope, authorization_details, resources, audience, access_token_lifetime, dpop_jkt, expires_at FROM oauth2_tokens WHERE signature = ?`, signature).
+		Scan(&kind, &t.GrantID, &t.ClientID, &t.Subject, &t.Scope, &details, &resources, &audience, &lifetime, &t.DPoPJKT, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range []struct {
+		value sql.NullString
+		dest  interface{}
+	}{{details, &t.AuthorizationDetails}, {resources, &t.Resources}, {audience, &t.Audience}} {
+		if err := scanJSON(col.value, col.dest); err != nil {
+			return nil, err
+		}
+	}
+	t.AccessTokenLifetime = time.Duration(lifetime)
+	t.Kind = store.TokenKind(kind)
+	if expiresAt.Valid {
+		t.ExpiresAt = time.Unix(0, expiresAt.Int64)
+	}
+	return &t, nil
+}
+
+// DeleteToken deletes a token.
+func (s *Store) DeleteToken(signature string) error {
+	_, err := s.exec(s.db, `DELETE FROM oauth2_tokens WHERE signature = ?`, signature)
+	return err
+}
+
+// RevokeGrant deletes all the tokens of a grant.
+func (s *Store) RevokeGrant(grantID string) error {
+	_, err := s.exec(s.db, `DELETE FROM oauth2_tokens WHERE grant_id = ?`, grantID)
+	return err
+}
+
+// Consent loads a consent.
+func (s *Store) Consent(subject, clientID string) (*store.Consent, error) {
+	var (
+		c         = store.Consent{Subject: subject, ClientID: clientID}
+		grantedAt int64
+	)
+	err := s.queryRow(s.db, `SELECT scope, granted_at FROM oauth2_consents WHERE subject = ? AND client_id = ?`, subject, clientID).
+		Scan(&c.Scope, &grantedAt)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.GrantedAt = time.Unix(0, grantedAt)
+	return &c, nil
+}
+
+// SaveConsent creates or updates a consent.
+func (s *Store) SaveConsent(c *store.Consent) error {
+	return s.replace(`DELETE FROM oauth2_consents WHERE subject = ? AND client_id = ?`, []interface{}{c.Subject, c.ClientID},
+		`INSERT INTO oauth2_consents (subject, client_id, scope, granted_at) VALUES (?, ?, ?, ?)`,
+		c.Subject, c.ClientID, c.Scope, c.GrantedAt.UnixNano())
+}
+
+// DeleteConsent deletes a consent.
+func (s *Store) DeleteConsent(subject, clientID string) error {
+	_, err := s.exec(s.db, `DELETE FROM oauth2_consents WHERE subject = ? AND client_id = ?`, subject, clientID)
+	return err
+}
+
+// replace runs the given delete and insert statements in a single transaction. It provides
+// upsert semantics portable across dialects.
+func (s *Store) replace(del string, delArgs []interface{}, ins string, insArgs ...interface{}) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := s.exec(tx, del, delArgs...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := s.exec(tx, ins, insArgs...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// nullJSON returns the JSON encoding of the given value for a nullable column, NULL if set is
+// false.
+func nullJSON(v interface{}, set bool) (sql.NullString, error) {
+	if !set {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// scanJSON decodes the value of a nullable JSON column into v unless it is NULL.
+func scanJSON(s sql.NullString, v interface{}) error {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s.String), v)
+}
+
+// exec runs the given statement after rebinding its parameters for the store dialect.
+func (s *Store) exec(q queryer, query string, args ...interface{}) (sql.Result, error) {
+	return q.Exec(s.dialect.rebind(query), args...)
+}
+
+// queryRow runs the given query after rebinding its parameters for the store dialect.
+func (s *Store) queryRow(q queryer, query string, args ...interface{}) *sql.Row {
+	return q.QueryRow(s.dialect.rebind(query), args...)
+}
+
+// rebind replaces the "?" bind parameters of the given query with numbered parameters if the
+// dialect requires it.
+func (d *Dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,225 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goadesign/oauth2"
+	"github.com/goadesign/oauth2/store"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestStore creates a store backed by a migrated SQLite database in a temporary directory.
+func newTestStore(t *testing.T) *Store {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "oauth2.db")+"?_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := New(db, SQLite)
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// accept is a ConsumeCode check that accepts any code.
+func accept(*store.Code) error { return nil }
+
+func TestMigrate(t *testing.T) {
+	s := newTestStore(t)
+	version, err := s.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest := migrations[len(migrations)-1].version; version != latest {
+		t.Errorf("got schema version %d, expected %d", version, latest)
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatalf("got error %v when migrating twice, expected none", err)
+	}
+	c := &store.Client{
+		ID:                   "client",
+		SecretHash:           []byte("hash"),
+		RedirectURIs:         []string{"https://client.example.com/cb"},
+		BackchannelLogoutURI: "https://client.example.com/logout",
+	}
+	if err := s.SaveClient(c); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := s.Client("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.RedirectURIs[0] != c.RedirectURIs[0] || loaded.BackchannelLogoutURI != c.BackchannelLogoutURI {
+		t.Errorf("got client %+v, expected %+v", loaded, c)
+	}
+}
+
+func TestHashedLookup(t *testing.T) {
+	s := newTestStore(t)
+	err := s.SaveClient(&store.Client{ID: "client", RedirectURIs: []string{"https://client.example.com/cb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := store.NewProvider(s)
+	code, err := p.Authorize("client", "", "https://client.example.com/cb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, _, _, err := p.Exchange("client", code, "https://client.example.com/cb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM oauth2_tokens WHERE signature = ?`, refreshToken).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("found the raw refresh token in the database, expected only its signature")
+	}
+	if _, _, _, err := p.Refresh(refreshToken, ""); err != nil {
+		t.Errorf("got error %v, expected the refresh token to be found by signature", err)
+	}
+}
+
+func TestConsumeCodeSingleUse(t *testing.T) {
+	s := newTestStore(t)
+	code := &store.Code{Signature: "sig", ClientID: "client", ExpiresAt: time.Now().Add(time.Minute)}
+	if err := s.SaveCode(code); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ConsumeCode("sig", func(*store.Code) error { return store.ErrNotFound }); err == nil {
+		t.Fatal("expected the check error")
+	}
+
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		successes int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := s.ConsumeCode("sig", accept)
+			switch {
+			case err == nil:
+				if c.ClientID != "client" {
+					t.Errorf("got client %q, expected %q", c.ClientID, "client")
+				}
+				lock.Lock()
+				successes++
+				lock.Unlock()
+			case err != store.ErrNotFound:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if successes != 1 {
+		t.Errorf("got %d successful redemptions, expected 1", successes)
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Now()
+	codes := []*store.Code{
+		{Signature: "expired", ExpiresAt: now.Add(-time.Second)},
+		{Signature: "valid", ExpiresAt: now.Add(time.Minute)},
+	}
+	for _, c := range codes {
+		if err := s.SaveCode(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tokens := []*store.Token{
+		{Signature: "expired", Kind: store.AccessToken, ExpiresAt: now.Add(-time.Second)},
+		{Signature: "valid", Kind: store.AccessToken, ExpiresAt: now.Add(time.Minute)},
+		{Signature: "eternal", Kind: store.RefreshToken},
+	}
+	for _, tok := range tokens {
+		if err := s.SaveToken(tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.DeleteExpired(now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ConsumeCode("expired", accept); err != store.ErrNotFound {
+		t.Errorf("got error %v for the expired code, expected ErrNotFound", err)
+	}
+	if _, err := s.ConsumeCode("valid", accept); err != nil {
+		t.Errorf("got error %v for the valid code, expected none", err)
+	}
+	if _, err := s.Token("expired"); err != store.ErrNotFound {
+		t.Errorf("got error %v for the expired token, expected ErrNotFound", err)
+	}
+	for _, sig := range []string{"valid", "eternal"} {
+		if _, err := s.Token(sig); err != nil {
+			t.Errorf("got error %v for token %q, expected none", err, sig)
+		}
+	}
+}
+
+func TestGrantFields(t *testing.T) {
+	s := newTestStore(t)
+	details := []oauth2.AuthorizationDetail{{"type": "account_information", "actions": []interface{}{"read"}}}
+	code := &store.Code{
+		Signature:            "code",
+		ClientID:             "client",
+		AuthorizationDetails: details,
+		Nonce:                "nonce",
+		AuthTime:             time.Unix(1577836800, 0),
+		ACR:                  "urn:mace:incommon:iap:silver",
+		SessionID:            "sid",
+		Resources:            []string{"https://billing.example.com"},
+		Audience:             []string{"billing"},
+		AccessTokenLifetime:  5 * time.Minute,
+		ExpiresAt:            time.Now().Add(time.Minute),
+	}
+	if err := s.SaveCode(code); err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.ConsumeCode("code", accept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.AuthorizationDetails, details) {
+		t.Errorf("got code authorization details %v, expected %v", c.AuthorizationDetails, details)
+	}
+	if !reflect.DeepEqual(c.Resources, code.Resources) || !reflect.DeepEqual(c.Audience, code.Audience) || c.AccessTokenLifetime != code.AccessTokenLifetime {
+		t.Errorf("got code resources %v, audience %v and lifetime %v", c.Resources, c.Audience, c.AccessTokenLifetime)
+	}
+	if c.Nonce != code.Nonce || !c.AuthTime.Equal(code.AuthTime) || c.ACR != code.ACR || c.SessionID != code.SessionID {
+		t.Errorf("got code nonce %q, authentication time %v, class %q and session %q", c.Nonce, c.AuthTime, c.ACR, c.SessionID)
+	}
+	if err := s.SaveCode(&store.Code{Signature: "unauthenticated", ExpiresAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := s.ConsumeCode("unauthenticated", accept); err != nil || !c.AuthTime.IsZero() {
+		t.Errorf("got authentication time %v and error %v, expected the zero time", c.AuthTime, err)
+	}
+	if err := s.SaveToken(&store.Token{Signature: "token", Kind: store.AccessToken, AuthorizationDetails: details, Audience: code.Audience, DPoPJKT: "jkt"}); err != nil {
+		t.Fatal(err)
+	}
+	tok, err := s.Token("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tok.AuthorizationDetails, details) {
+		t.Errorf("got token authorization details %v, expected %v", tok.AuthorizationDetails, details)
+	}
+	if !reflect.DeepEqual(tok.Audience, code.Audience) || tok.Resources != nil {
+		t.Errorf("got token audience %v and resources %v", tok.Audience, tok.Resources)
+	}
+	if tok.DPoPJKT != "jkt" {
+		t.Errorf("got token DPoP thumbprint %q, expected %q", tok.DPoPJKT, "jkt")
+	}
+}
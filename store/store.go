@@ -0,0 +1,226 @@
+/*
+Package store contains a reference implementation of the oauth2.Provider interface built on top
+of a pluggable persistence layer. Users only need to supply an implementation of the Store
+interface.
+
+The provider never gives raw secrets to the store: client secrets are hashed with bcrypt and
+authorization codes and tokens are identified by the SHA256 hash of their value (their
+signature).
+*/
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/goadesign/oauth2"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+type (
+	// Store is the interface implemented by the persistence layer used by Provider.
+	Store interface {
+		// Client loads the client with the given identifier. It returns ErrNotFound if
+		// there is no such client.
+		Client(id string) (*Client, error)
+		// SaveClient creates or updates a client.
+		SaveClient(c *Client) error
+		// DeleteClient deletes the client with the given identifier.
+		DeleteClient(id string) error
+
+		// SaveCode persists an authorization code.
+		SaveCode(c *Code) error
+		// ConsumeCode atomically loads the authorization code with the given signature,
+		// calls check with it and deletes it if check succeeds so that each code can be
+		// redeemed at most once and only by the client it was issued to. It returns the
+		// error returned by check if any, the code is then left in place. It returns
+		// ErrNotFound if there is no such code.
+		ConsumeCode(signature string, check func(*Code) error) (*Code, error)
+
+		// SaveToken persists an access or refresh token.
+		SaveToken(t *Token) error
+		// Token loads the token with the given signature. It returns ErrNotFound if
+		// there is no such token.
+		Token(signature string) (*Token, error)
+		// DeleteToken deletes the token with the given signature.
+		DeleteToken(signature string) error
+		// RevokeGrant deletes all the tokens issued for the grant with the given
+		// identifier.
+		RevokeGrant(grantID string) error
+
+		// Consent loads the consent given by the resource owner with the given
+		// identifier to the client with the given identifier. It returns ErrNotFound if
+		// there is no such consent.
+		Consent(subject, clientID string) (*Consent, error)
+		// SaveConsent creates or updates a consent.
+		SaveConsent(c *Consent) error
+		// DeleteConsent deletes the consent given by the resource owner with the given
+		// identifier to the client with the given identifier.
+		DeleteConsent(subject, clientID string) error
+	}
+
+	// Client is a registered OAuth2 client.
+	Client struct {
+		// ID is the client identifier.
+		ID string
+		// SecretHash is the bcrypt hash of the client secret, see HashSecret.
+		SecretHash []byte
+		// RedirectURIs lists the registered redirection endpoints.
+		RedirectURIs []string
+		// AllowLoopbackPort allows authorization requests to use any port with loopback
+		// redirect URIs, see oauth2.Client.
+		AllowLoopbackPort bool
+		// Native indicates that the client is a native app which must use PKCE.
+		Native bool
+		// ResponseMode is the default response mode of the client, see oauth2.Client.
+		ResponseMode string
+		// ResponseTypes lists the response types the client may use, see oauth2.Client.
+		ResponseTypes []string
+		// RequirePushedRequests requires the client to use pushed authorization requests,
+		// see oauth2.Client.
+		RequirePushedRequests bool
+		// JWKS contains the public keys of the client, see oauth2.Client.
+		JWKS *jose.JSONWebKeySet
+		// RequireSignedRequestObject requires the client to use signed request objects,
+		// see oauth2.Client.
+		RequireSignedRequestObject bool
+		// RequestURIs lists the URIs of the request objects the client may pass by
+		// reference, see oauth2.Client.
+		RequestURIs []string
+		// ResponseEncryptionAlg is the JWE algorithm used to encrypt the JWT authorization
+		// responses sent to the client, see oauth2.Client.
+		ResponseEncryptionAlg string
+		// ResponseEncryptionEnc is the JWE content encryption algorithm used with
+		// ResponseEncryptionAlg, see oauth2.Client.
+		ResponseEncryptionEnc string
+		// PostLogoutRedirectURIs lists the URIs where the user agent may be redirected
+		// after a logout initiated by the client, see oauth2.Client.
+		PostLogoutRedirectURIs []string
+		// BackchannelLogoutURI is the URI where logout tokens are sent when a session the
+		// client takes part in ends, see oauth2.Client.
+		BackchannelLogoutURI string
+		// BackchannelLogoutSessionRequired requires the "sid" claim in logout tokens, see
+		// oauth2.Client.
+		BackchannelLogoutSessionRequired bool
+		// FrontchannelLogoutURI is the URI rendered in an iframe by the logout page when a
+		// session the client takes part in ends, see oauth2.Client.
+		FrontchannelLogoutURI string
+		// FrontchannelLogoutSessionRequired requires the "iss" and "sid" query parameters
+		// in the front-channel logout URI, see oauth2.Client.
+		FrontchannelLogoutSessionRequired bool
+		// Scope is the maximum scope the client may request, the client may request any
+		// scope if empty. It is also the scope used when authorization requests do not
+		// specify one.
+		Scope string
+	}
+
+	// Code is an authorization code.
+	Code struct {
+		// Signature is the SHA256 hash of the code value.
+		Signature string
+		// ClientID is the identifier of the client the code was issued to.
+		ClientID string
+		// RedirectURI is the redirection endpoint used in the authorization request.
+		RedirectURI string
+		// Scope is the scope granted by the resource owner.
+		Scope string
+		// Subject is the identifier of the resource owner.
+		Subject string
+		// CodeChallenge is the PKCE code challenge if any.
+		CodeChallenge string
+		// CodeChallengeMethod is the PKCE code challenge method if any.
+		CodeChallengeMethod string
+		// AuthorizationDetails contains the authorization details granted by the resource
+		// owner if any.
+		AuthorizationDetails []oauth2.AuthorizationDetail
+		// Nonce is the OpenID Connect nonce of the authorization request if any.
+		Nonce string
+		// AuthTime is the time when the resource owner authenticated, the zero time if
+		// unknown.
+		AuthTime time.Time
+		// ACR is the authentication context class reference satisfied by the
+		// authentication if any.
+		ACR string
+		// SessionID is the identifier of the session of the resource owner with the
+		// authorization server if any.
+		SessionID string
+		// Resources lists the resource indicators of the authorization request if any.
+		Resources []string
+		// Audience lists the audience of the access tokens issued for Resources.
+		Audience []string
+		// AccessTokenLifetime is the lifetime of the access tokens issued for Resources,
+		// zero if the provider default lifetime applies.
+		AccessTokenLifetime time.Duration
+		// ExpiresAt is the code expiration time.
+		ExpiresAt time.Time
+	}
+
+	// Token is an access or refresh token.
+	Token struct {
+		// Signature is the SHA256 hash of the token value.
+		Signature string
+		// Kind indicates whether the token is an access or refresh token.
+		Kind TokenKind
+		// GrantID identifies the grant the token was issued for. All the tokens issued
+		// from the same authorization code share the same grant identifier.
+		GrantID string
+		// ClientID is the identifier of the client the token was issued to.
+		ClientID string
+		// Subject is the identifier of the resource owner.
+		Subject string
+		// Scope is the scope granted to the token.
+		Scope string
+		// AuthorizationDetails contains the authorization details granted to the token if
+		// any.
+		AuthorizationDetails []oauth2.AuthorizationDetail
+		// Resources lists the resource indicators of the resource servers the token was
+		// issued for if any.
+		Resources []string
+		// Audience lists the audience of the access tokens issued for Resources.
+		Audience []string
+		// AccessTokenLifetime is the lifetime of the access tokens issued for Resources,
+		// zero if the provider default lifetime applies. Refresh tokens record it so that
+		// refreshed access tokens get the same lifetime.
+		AccessTokenLifetime time.Duration
+		// DPoPJKT is the JWK SHA-256 thumbprint of the DPoP key the token is bound to if
+		// any.
+		DPoPJKT string
+		// ExpiresAt is the token expiration time, the token never expires if zero.
+		ExpiresAt time.Time
+	}
+
+	// Consent records the scope the resource owner granted to a client.
+	Consent struct {
+		// Subject is the identifier of the resource owner.
+		Subject string
+		// ClientID is the client identifier.
+		ClientID string
+		// Scope is the scope granted by the resource owner.
+		Scope string
+		// GrantedAt is the time the consent was last given.
+		GrantedAt time.Time
+	}
+
+	// TokenKind is the kind of a token.
+	TokenKind string
+)
+
+const (
+	// AccessToken is the kind of access tokens.
+	AccessToken TokenKind = "access_token"
+	// RefreshToken is the kind of refresh tokens.
+	RefreshToken TokenKind = "refresh_token"
+)
+
+// ErrNotFound is the error returned by Store implementations when a record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Expired returns true if the code expired at the given time.
+func (c *Code) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+// Expired returns true if the token expired at the given time.
+func (t *Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,221 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/goadesign/oauth2/app"
+)
+
+// TokenExchangeGrantType is the grant type used by token exchange requests, see
+// https://tools.ietf.org/html/rfc8693#section-2.1
+const TokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// Token type identifiers defined by https://tools.ietf.org/html/rfc8693#section-3
+const (
+	// AccessTokenType indicates that the token is an OAuth 2.0 access token.
+	AccessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+
+	// RefreshTokenType indicates that the token is an OAuth 2.0 refresh token.
+	RefreshTokenType = "urn:ietf:params:oauth:token-type:refresh_token"
+
+	// IDTokenType indicates that the token is an ID Token as defined by OpenID Connect.
+	IDTokenType = "urn:ietf:params:oauth:token-type:id_token"
+
+	// SAML1TokenType indicates that the token is a base64url-encoded SAML 1.1 assertion.
+	SAML1TokenType = "urn:ietf:params:oauth:token-type:saml1"
+
+	// SAML2TokenType indicates that the token is a base64url-encoded SAML 2.0 assertion.
+	SAML2TokenType = "urn:ietf:params:oauth:token-type:saml2"
+
+	// JWTTokenType indicates that the token is a JWT.
+	JWTTokenType = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+type (
+	// TokenExchanger is the interface optionally implemented by providers that support the
+	// token exchange grant described in https://tools.ietf.org/html/rfc8693. Token exchange
+	// requests are rejected with an "unsupported_grant_type" error if the provider given to
+	// NewProviderController does not implement it.
+	TokenExchanger interface {
+		// ExchangeToken implements https://tools.ietf.org/html/rfc8693#section-2.1
+		// It must validate the subject token and the actor token if any and apply the
+		// impersonation or delegation policy for the client with the given identifier. A
+		// request without actor token asks for a token that impersonates the subject while
+		// a request with an actor token asks for a token that lets the actor act on behalf
+		// of the subject. The resources, audiences, scope and requested token type should
+		// be used to downscope the issued token, access tokens issued for resources
+		// should be restricted to ResourceAudience and AccessTokenLifetime. Upon success ExchangeToken returns the
+		// issued token. Upon failure the error should implement Error otherwise a generic
+		// error HTTP response is sent back to the client.
+		ExchangeToken(clientID string, req *TokenExchangeRequest) (*ExchangedToken, error)
+	}
+
+	// TokenExchangeRequest contains the parameters of a token exchange request.
+	TokenExchangeRequest struct {
+		// SubjectToken represents the identity of the party on behalf of whom the request
+		// is being made.
+		SubjectToken string
+		// SubjectTokenType is the identifier of the type of SubjectToken.
+		SubjectTokenType string
+		// ActorToken represents the identity of the acting party if any.
+		ActorToken string
+		// ActorTokenType is the identifier of the type of ActorToken, it is set if and
+		// only if ActorToken is.
+		ActorTokenType string
+		// Resources lists the absolute URIs of the target services or resources. They
+		// identify resource servers registered with WithResourceServers.
+		Resources []string
+		// ResourceAudience lists the audiences of the resource servers identified by
+		// Resources as registered with WithResourceServers.
+		ResourceAudience []string
+		// AccessTokenLifetime is the lifetime of the issued access token set by the
+		// resource servers identified by Resources, zero if none of them has one.
+		AccessTokenLifetime time.Duration
+		// Audiences lists the logical names of the target services.
+		Audiences []string
+		// Scope is the scope of the requested token.
+		Scope string
+		// RequestedTokenType is the identifier of the type of the requested token if any.
+		RequestedTokenType string
+		// DPoPJKT is the JWK SHA-256 thumbprint of the key used to sign the DPoP proof of
+		// the request if any. Issued access tokens must be bound to the key.
+		DPoPJKT string
+	}
+
+	// ExchangedToken is the token issued in response to a token exchange request.
+	ExchangedToken struct {
+		// Token is the issued security token, it is returned in the "access_token" field
+		// of the response even if it is not an access token.
+		Token string
+		// IssuedTokenType is the identifier of the type of Token. It defaults to the
+		// requested token type if any, AccessTokenType otherwise.
+		IssuedTokenType string
+		// TokenType is the OAuth2 token type of Token. It defaults to "Bearer" if Token is
+		// an access token, or "DPoP" if the provider implements DPoPBinder and confirms
+		// that the token is bound to the key of the request DPoP proof, "N_A" otherwise.
+		TokenType string
+		// RefreshToken is an optional refresh token. It starts a new token family if
+		// refresh token rotation is enabled, see WithRefreshTokenRotation.
+		RefreshToken string
+		// Scope is the scope of the issued token if different from the requested scope.
+		Scope string
+		// ExpiresIn is the optional lifetime in seconds of the issued token.
+		ExpiresIn int
+	}
+)
+
+// exchangeToken exchanges the subject token and optional actor token for a new token.
+func (c *ProviderController) exchangeToken(ctx context.Context, rw http.ResponseWriter, p *app.TokenPayload) error {
+	// Make sure the provider supports token exchange
+	exchanger, ok := c.provider.(TokenExchanger)
+	if !ok {
+		return c.Service.Send(ctx, http.StatusBadRequest, UnsupportedTokenExchange)
+	}
+
+	// Ensure there is a client identifier
+	clientID := ContextClientID(ctx)
+	if clientID == "" {
+		return c.Service.Send(ctx, http.StatusBadRequest, MissingClientID)
+	}
+
+	// Validate subject and actor tokens
+	req := TokenExchangeRequest{
+		SubjectToken:       stringValue(p.SubjectToken),
+		SubjectTokenType:   stringValue(p.SubjectTokenType),
+		ActorToken:         stringValue(p.ActorToken),
+		ActorTokenType:     stringValue(p.ActorTokenType),
+		Resources:          p.Resource,
+		Audiences:          p.Audience,
+		RequestedTokenType: stringValue(p.RequestedTokenType),
+		DPoPJKT:            ContextDPoPThumbprint(ctx),
+	}
+	if req.SubjectToken == "" {
+		return c.Service.Send(ctx, http.StatusBadRequest, MissingSubjectToken)
+	}
+	if req.SubjectTokenType == "" {
+		return c.Service.Send(ctx, http.StatusBadRequest, MissingSubjectTokenType)
+	}
+	if req.ActorToken != "" && req.ActorTokenType == "" {
+		return c.Service.Send(ctx, http.StatusBadRequest, MissingActorTokenType)
+	}
+	if req.ActorToken == "" && req.ActorTokenType != "" {
+		return c.Service.Send(ctx, http.StatusBadRequest, MissingActorToken)
+	}
+
+	// Validate scope
+	if p.Scope != nil {
+		scope, err := ParseScope(*p.Scope)
+		if err != nil {
+			return c.Service.Send(ctx, http.StatusBadRequest, MalformedScope)
+		}
+		if c.scopes != nil {
+			if scope, err = c.scopes.Resolve(scope); err != nil {
+				return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
+			}
+		}
+		req.Scope = scope.String()
+	}
+
+	// Validate resources against the registered resource servers
+	target, err := c.resourceTarget(req.Resources, req.Scope)
+	if err != nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
+	}
+	if target != nil {
+		req.ResourceAudience, req.AccessTokenLifetime = target.audience, target.lifetime
+	}
+
+	// Retrieve token
+	t, err := exchanger.ExchangeToken(clientID, &req)
+	if err != nil {
+		return c.Service.Send(ctx, http.StatusBadRequest, errorToMedia(err))
+	}
+
+	issuedTokenType := t.IssuedTokenType
+	if issuedTokenType == "" {
+		issuedTokenType = req.RequestedTokenType
+		if issuedTokenType == "" {
+			issuedTokenType = AccessTokenType
+		}
+	}
+	tokenType := t.TokenType
+	if tokenType == "" {
+		tokenType = "N_A"
+		if issuedTokenType == AccessTokenType {
+			tokenType = accessTokenType(c.boundJKT(ctx, t.Token))
+		}
+	}
+	m := app.TokenMedia{
+		AccessToken:     t.Token,
+		TokenType:       tokenType,
+		IssuedTokenType: &issuedTokenType,
+	}
+	if t.RefreshToken != "" {
+		refreshToken := t.RefreshToken
+		if c.refreshTokens != nil {
+			var err error
+			if refreshToken, err = c.refreshTokens.issue(clientID, refreshToken); err != nil {
+				return err
+			}
+		}
+		m.RefreshToken = &refreshToken
+	}
+	if t.ExpiresIn != 0 {
+		m.ExpiresIn = &t.ExpiresIn
+	}
+	if t.Scope != "" {
+		m.Scope = &t.Scope
+	}
+
+	return c.sendToken(ctx, rw, &m)
+}
+
+// stringValue returns the value pointed to by s or the empty string if s is nil.
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
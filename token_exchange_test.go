@@ -0,0 +1,185 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goadesign/goa"
+	"github.com/goadesign/oauth2/app"
+)
+
+// tokenExchanger is a provider that records the token exchange requests and returns a copy of
+// its token.
+type tokenExchanger struct {
+	Provider
+	token *ExchangedToken
+	req   *TokenExchangeRequest
+}
+
+func (p *tokenExchanger) ExchangeToken(clientID string, req *TokenExchangeRequest) (*ExchangedToken, error) {
+	p.req = req
+	t := *p.token
+	return &t, nil
+}
+
+// exchangeTestToken sends the given token exchange request on behalf of the "client" client and
+// returns the response status and decoded body.
+func exchangeTestToken(t *testing.T, c *ProviderController, p *app.TokenPayload) (int, map[string]interface{}) {
+	var (
+		rw  = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/oauth2/token", nil)
+		ctx = goa.NewContext(WithClientID(context.Background(), "client"), rw, req, nil)
+	)
+	p.GrantType = TokenExchangeGrantType
+	if err := c.exchangeToken(ctx, rw, p); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return rw.Code, body
+}
+
+// str returns a pointer to the given string.
+func str(s string) *string {
+	return &s
+}
+
+func TestExchangeTokenValidation(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Payload app.TokenPayload
+		Error   string
+	}{
+		{"missing subject token", app.TokenPayload{SubjectTokenType: str(AccessTokenType)}, `token exchange requires a "subject_token" value`},
+		{"missing subject token type", app.TokenPayload{SubjectToken: str("subject")}, `token exchange requires a "subject_token_type" value`},
+		{"actor token without type", app.TokenPayload{SubjectToken: str("subject"), SubjectTokenType: str(AccessTokenType), ActorToken: str("actor")}, `"actor_token" requires a "actor_token_type" value`},
+		{"actor type without token", app.TokenPayload{SubjectToken: str("subject"), SubjectTokenType: str(AccessTokenType), ActorTokenType: str(JWTTokenType)}, `"actor_token_type" must not be set without "actor_token"`},
+		{"malformed scope", app.TokenPayload{SubjectToken: str("subject"), SubjectTokenType: str(AccessTokenType), Scope: str("api:read \"")}, "malformed scope"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			p := &tokenExchanger{token: &ExchangedToken{Token: "token"}}
+			c := NewProviderController(newTestService(), p)
+			code, body := exchangeTestToken(t, c, &tc.Payload)
+			if code != http.StatusBadRequest || body["error_description"] != tc.Error {
+				t.Errorf("got status %d and body %v, expected %q", code, body, tc.Error)
+			}
+			if p.req != nil {
+				t.Error("got the invalid request given to the provider")
+			}
+		})
+	}
+}
+
+func TestExchangeTokenUnsupported(t *testing.T) {
+	c := NewProviderController(newTestService(), struct{ Provider }{})
+	payload := &app.TokenPayload{SubjectToken: str("subject"), SubjectTokenType: str(AccessTokenType)}
+	if code, body := exchangeTestToken(t, c, payload); code != http.StatusBadRequest || body["error"] != string(ErrUnsupportedGrantType) {
+		t.Errorf("got status %d and body %v, expected an %q error", code, body, ErrUnsupportedGrantType)
+	}
+}
+
+func TestExchangeTokenTypes(t *testing.T) {
+	cases := []struct {
+		Name            string
+		Requested       string
+		Token           ExchangedToken
+		IssuedTokenType string
+		TokenType       string
+		Full            bool
+	}{
+		{"default", "", ExchangedToken{Token: "token"}, AccessTokenType, "Bearer", false},
+		{"requested type", IDTokenType, ExchangedToken{Token: "token"}, IDTokenType, "N_A", false},
+		{"issued type", "", ExchangedToken{Token: "token", IssuedTokenType: JWTTokenType}, JWTTokenType, "N_A", false},
+		{"access token type", JWTTokenType, ExchangedToken{Token: "token", IssuedTokenType: AccessTokenType}, AccessTokenType, "Bearer", false},
+		{"provider token type", "", ExchangedToken{Token: "token", TokenType: "mac"}, AccessTokenType, "mac", false},
+		{"full", "", ExchangedToken{Token: "token", RefreshToken: "refresh", ExpiresIn: 60, Scope: "api:read"}, AccessTokenType, "Bearer", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := NewProviderController(newTestService(), &tokenExchanger{token: &tc.Token})
+			payload := &app.TokenPayload{SubjectToken: str("subject"), SubjectTokenType: str(AccessTokenType)}
+			if tc.Requested != "" {
+				payload.RequestedTokenType = str(tc.Requested)
+			}
+			code, body := exchangeTestToken(t, c, payload)
+			if code != http.StatusOK {
+				t.Fatalf("got status %d and body %v", code, body)
+			}
+			if body["access_token"] != "token" || body["issued_token_type"] != tc.IssuedTokenType || body["token_type"] != tc.TokenType {
+				t.Errorf("got body %v, expected issued token type %q and token type %q", body, tc.IssuedTokenType, tc.TokenType)
+			}
+			if tc.Full && (body["refresh_token"] != "refresh" || body["expires_in"] != float64(60) || body["scope"] != "api:read") {
+				t.Errorf("got body %v, expected the refresh token, lifetime and scope", body)
+			}
+			if !tc.Full && len(body) != 3 {
+				t.Errorf("got body %v, expected no optional field", body)
+			}
+		})
+	}
+}
+
+func TestExchangeTokenScope(t *testing.T) {
+	r := NewScopeRegistry()
+	r.Register("api:read", "Read access")
+	r.Register("api:write", "Write access")
+	cases := []struct {
+		Name     string
+		Scope    *string
+		Expected string
+		Error    string
+	}{
+		{"no scope", nil, "", ""},
+		{"normalized", str("api:write  api:read api:read"), "api:read api:write", ""},
+		{"pattern", str("api:*"), "api:read api:write", ""},
+		{"unknown", str("api:delete"), "", string(ErrInvalidScope)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			p := &tokenExchanger{token: &ExchangedToken{Token: "token"}}
+			c := NewProviderController(newTestService(), p, WithScopeRegistry(r))
+			payload := &app.TokenPayload{SubjectToken: str("subject"), SubjectTokenType: str(AccessTokenType), Scope: tc.Scope}
+			code, body := exchangeTestToken(t, c, payload)
+			if tc.Error != "" {
+				if code != http.StatusBadRequest || body["error"] != tc.Error {
+					t.Errorf("got status %d and body %v, expected an %q error", code, body, tc.Error)
+				}
+				return
+			}
+			if code != http.StatusOK {
+				t.Fatalf("got status %d and body %v", code, body)
+			}
+			if p.req.Scope != tc.Expected {
+				t.Errorf("got scope %q given to the provider, expected %q", p.req.Scope, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestExchangeTokenRefreshRotation(t *testing.T) {
+	m := NewRefreshTokenManager(NewRefreshTokenMemoryStore(0))
+	c := NewProviderController(newTestService(), &tokenExchanger{token: &ExchangedToken{Token: "token", RefreshToken: "grant"}}, WithRefreshTokenRotation(m))
+	code, body := exchangeTestToken(t, c, &app.TokenPayload{SubjectToken: str("subject"), SubjectTokenType: str(AccessTokenType)})
+	if code != http.StatusOK {
+		t.Fatalf("got status %d and body %v", code, body)
+	}
+	token, _ := body["refresh_token"].(string)
+	if token == "" || token == "grant" {
+		t.Fatalf("got refresh token %q, expected a token issued by the manager", token)
+	}
+	var refreshed string
+	if _, err := m.rotate(context.Background(), "client", token, func(grant string) (string, error) {
+		refreshed = grant
+		return "", nil
+	}); err != nil {
+		t.Fatalf("got error %v, expected the exchanged refresh token to be rotated", err)
+	}
+	if refreshed != "grant" {
+		t.Errorf("got grant %q, expected the provider refresh token", refreshed)
+	}
+}